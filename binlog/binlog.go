@@ -0,0 +1,453 @@
+/*
+	Compact binary encoding of golog log records
+
+	A binary golog file is a sequence of frames. Every frame is a uvarint length followed by that many bytes, the
+	first of which is the frame type:
+
+		frameSession: starts an encoder session. Holds the magic bytes and format version, and clears the string table
+		frameString:  interns a string. Holds the uvarint string id followed by the string bytes
+		frameRecord:  holds a log record
+
+	A record frame holds the zig-zag varint unix nanosecond timestamp, the level byte, the uvarint id of the interned
+	context ( 0 when there is no context ), the uvarint length prefixed message, and the uvarint field count followed
+	by each field as the uvarint id of its interned key, a type byte and the typed value.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	formatMagic   = "GLOG"
+	formatVersion = 1
+
+	// maxFrameSize guards the decoder against allocating absurd amounts of memory for a corrupt length prefix
+	maxFrameSize = 64 << 20
+)
+
+const (
+	frameSession byte = iota + 1
+	frameString
+	frameRecord
+)
+
+const (
+	valueNil byte = iota
+	valueString
+	valueInt
+	valueUint
+	valueFloat
+	valueBool
+	valueTime
+	valueDuration
+)
+
+// levelNames maps the level byte written in a record to the golog level name
+var levelNames = []string{"", "DEBUG", "INFO", "WARNING", "ERROR", "FATAL", "PANIC"}
+
+// Field is a single key/value pair of a record. Decoded values are one of: nil, string, int64, uint64, float64,
+// bool, time.Time or time.Duration
+type Field struct {
+	Key   string      // The name of the field
+	Value interface{} // The value of the field
+}
+
+// Record is a single log record
+type Record struct {
+	Time    time.Time // The time the record was logged at
+	Level   string    // The golog level name, e.g.: 'WARNING'
+	Context string    // The context of the logger that wrote the record
+	Message string    // The log text
+	Fields  []Field   // The fields attached to the record
+}
+
+// Encoder encodes records into frames. An encoder is not safe for concurrent use, and the frames it returns must be
+// written in the order they were produced since later records may reference strings interned by earlier ones
+type Encoder struct {
+	strings      map[string]uint64 // The id of every string interned during this session
+	hasStarted   bool              // If true, the session frame has been emitted
+	buffer       []byte            // Scratch space reused between calls to 'Encode'
+	recordBuffer []byte            // Scratch space for the body of the record frame
+}
+
+// Decoder decodes records from a stream of frames
+type Decoder struct {
+	reader  *bufio.Reader     // The stream being decoded
+	strings map[uint64]string // The strings interned by the current session
+	frame   []byte            // Scratch space reused between frames
+}
+
+// NewEncoder returns an encoder that starts a new session on its first call to 'Encode'
+func NewEncoder() *Encoder {
+	return &Encoder{strings: make(map[string]uint64)}
+}
+
+// Reset makes the encoder start a new session on its next call to 'Encode'. Call this whenever the frames will be
+// written to a new destination, such as a freshly rotated file
+func (encoder *Encoder) Reset() {
+	encoder.strings = make(map[string]uint64)
+	encoder.hasStarted = false
+}
+
+// Encode returns the frames encoding 'record', preceded by any session or string frames it depends on. The returned
+// slice is only valid until the next call to 'Encode'
+func (encoder *Encoder) Encode(record Record) []byte {
+	encoder.buffer = encoder.buffer[:0]
+
+	if !encoder.hasStarted {
+		encoder.buffer = appendFrame(encoder.buffer, frameSession, append([]byte(formatMagic), formatVersion))
+		encoder.hasStarted = true
+	}
+
+	body := encoder.recordBuffer[:0]
+	body = appendVarint(body, record.Time.UnixNano())
+	body = append(body, levelByte(record.Level))
+	body = appendUvarint(body, encoder.intern(record.Context))
+	body = appendString(body, record.Message)
+	body = appendUvarint(body, uint64(len(record.Fields)))
+	for _, field := range record.Fields {
+		body = appendUvarint(body, encoder.intern(field.Key))
+		body = appendValue(body, field.Value)
+	}
+	encoder.recordBuffer = body
+
+	encoder.buffer = appendFrame(encoder.buffer, frameRecord, body)
+
+	return encoder.buffer
+}
+
+// intern returns the id of 's', appending a string frame to the output if it was not interned yet. The empty string
+// always has id 0
+func (encoder *Encoder) intern(s string) uint64 {
+	if s == "" {
+		return 0
+	}
+
+	if id, ok := encoder.strings[s]; ok {
+		return id
+	}
+
+	id := uint64(len(encoder.strings) + 1)
+	encoder.strings[s] = id
+
+	body := appendUvarint(nil, id)
+	body = append(body, s...)
+	encoder.buffer = appendFrame(encoder.buffer, frameString, body)
+
+	return id
+}
+
+// NewDecoder returns a decoder reading frames from 'reader'
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{reader: bufio.NewReader(reader), strings: make(map[uint64]string)}
+}
+
+// Decode returns the next record of the stream. io.EOF is returned once the stream ends cleanly, and
+// io.ErrUnexpectedEOF if it ends in the middle of a frame
+func (decoder *Decoder) Decode() (Record, error) {
+	for {
+		frameType, body, err := decoder.readFrame()
+		if err != nil {
+			return Record{}, err
+		}
+
+		switch frameType {
+		case frameSession:
+			if len(body) != len(formatMagic)+1 || string(body[:len(formatMagic)]) != formatMagic {
+				return Record{}, errors.New("binlog: invalid session frame, this is not a binary golog stream")
+			}
+			if body[len(formatMagic)] != formatVersion {
+				return Record{}, errors.New("binlog: unsupported format version " + strconv.Itoa(int(body[len(formatMagic)])))
+			}
+			decoder.strings = make(map[uint64]string)
+		case frameString:
+			id, size := binary.Uvarint(body)
+			if size <= 0 {
+				return Record{}, errors.New("binlog: corrupt string frame")
+			}
+			decoder.strings[id] = string(body[size:])
+		case frameRecord:
+			return decoder.decodeRecord(body)
+		default:
+			return Record{}, errors.New("binlog: unknown frame type " + strconv.Itoa(int(frameType)))
+		}
+	}
+}
+
+// readFrame reads the next frame, returning its type and body
+func (decoder *Decoder) readFrame() (byte, []byte, error) {
+	length, err := binary.ReadUvarint(decoder.reader)
+	if err != nil {
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+
+	if length == 0 || length > maxFrameSize {
+		return 0, nil, errors.New("binlog: invalid frame length " + strconv.FormatUint(length, 10))
+	}
+
+	if uint64(cap(decoder.frame)) < length {
+		decoder.frame = make([]byte, length)
+	}
+	frame := decoder.frame[:length]
+	if _, err := io.ReadFull(decoder.reader, frame); err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+
+	return frame[0], frame[1:], nil
+}
+
+// decodeRecord decodes the body of a record frame
+func (decoder *Decoder) decodeRecord(body []byte) (Record, error) {
+	var record Record
+	reader := byteReader{body: body}
+
+	nanoseconds := reader.varint()
+	level := reader.byte()
+	contextID := reader.uvarint()
+	record.Message = reader.string()
+	fieldCount := reader.uvarint()
+	if reader.err != nil {
+		return Record{}, reader.err
+	}
+
+	record.Time = time.Unix(0, nanoseconds)
+	if int(level) < len(levelNames) {
+		record.Level = levelNames[level]
+	}
+
+	context, ok := decoder.lookup(contextID)
+	if !ok {
+		return Record{}, errors.New("binlog: record references unknown context string " + strconv.FormatUint(contextID, 10))
+	}
+	record.Context = context
+
+	if fieldCount > uint64(len(body)) {
+		return Record{}, errors.New("binlog: corrupt record field count")
+	}
+	if fieldCount > 0 {
+		record.Fields = make([]Field, 0, fieldCount)
+	}
+	for index := uint64(0); index < fieldCount; index++ {
+		keyID := reader.uvarint()
+		value := reader.value()
+		if reader.err != nil {
+			return Record{}, reader.err
+		}
+
+		key, ok := decoder.lookup(keyID)
+		if !ok {
+			return Record{}, errors.New("binlog: record references unknown field key string " + strconv.FormatUint(keyID, 10))
+		}
+		record.Fields = append(record.Fields, Field{key, value})
+	}
+
+	return record, nil
+}
+
+// lookup returns the interned string 'id'
+func (decoder *Decoder) lookup(id uint64) (string, bool) {
+	if id == 0 {
+		return "", true
+	}
+
+	s, ok := decoder.strings[id]
+	return s, ok
+}
+
+// levelByte returns the byte written for the golog level name 'level'
+func levelByte(level string) byte {
+	for index, levelName := range levelNames {
+		if levelName == level {
+			return byte(index)
+		}
+	}
+
+	return 0
+}
+
+// appendFrame appends a frame of 'frameType' holding 'body' to 'buffer'
+func appendFrame(buffer []byte, frameType byte, body []byte) []byte {
+	buffer = appendUvarint(buffer, uint64(len(body)+1))
+	buffer = append(buffer, frameType)
+	return append(buffer, body...)
+}
+
+// appendUvarint appends the uvarint encoding of 'value' to 'buffer'
+func appendUvarint(buffer []byte, value uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	size := binary.PutUvarint(scratch[:], value)
+	return append(buffer, scratch[:size]...)
+}
+
+// appendVarint appends the zig-zag varint encoding of 'value' to 'buffer'
+func appendVarint(buffer []byte, value int64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	size := binary.PutVarint(scratch[:], value)
+	return append(buffer, scratch[:size]...)
+}
+
+// appendUint64 appends the little endian encoding of 'value' to 'buffer'
+func appendUint64(buffer []byte, value uint64) []byte {
+	var scratch [8]byte
+	binary.LittleEndian.PutUint64(scratch[:], value)
+	return append(buffer, scratch[:]...)
+}
+
+// appendString appends the uvarint length prefixed 's' to 'buffer'
+func appendString(buffer []byte, s string) []byte {
+	buffer = appendUvarint(buffer, uint64(len(s)))
+	return append(buffer, s...)
+}
+
+// appendValue appends the type byte and encoding of 'value' to 'buffer'. Values of types without a dedicated
+// encoding are written as their string representation
+func appendValue(buffer []byte, value interface{}) []byte {
+	switch typedValue := value.(type) {
+	case nil:
+		return append(buffer, valueNil)
+	case string:
+		return appendString(append(buffer, valueString), typedValue)
+	case bool:
+		if typedValue {
+			return append(buffer, valueBool, 1)
+		}
+		return append(buffer, valueBool, 0)
+	case int:
+		return appendVarint(append(buffer, valueInt), int64(typedValue))
+	case int8:
+		return appendVarint(append(buffer, valueInt), int64(typedValue))
+	case int16:
+		return appendVarint(append(buffer, valueInt), int64(typedValue))
+	case int32:
+		return appendVarint(append(buffer, valueInt), int64(typedValue))
+	case int64:
+		return appendVarint(append(buffer, valueInt), typedValue)
+	case uint:
+		return appendUvarint(append(buffer, valueUint), uint64(typedValue))
+	case uint8:
+		return appendUvarint(append(buffer, valueUint), uint64(typedValue))
+	case uint16:
+		return appendUvarint(append(buffer, valueUint), uint64(typedValue))
+	case uint32:
+		return appendUvarint(append(buffer, valueUint), uint64(typedValue))
+	case uint64:
+		return appendUvarint(append(buffer, valueUint), typedValue)
+	case float32:
+		return appendUint64(append(buffer, valueFloat), math.Float64bits(float64(typedValue)))
+	case float64:
+		return appendUint64(append(buffer, valueFloat), math.Float64bits(typedValue))
+	case time.Time:
+		return appendVarint(append(buffer, valueTime), typedValue.UnixNano())
+	case time.Duration:
+		return appendVarint(append(buffer, valueDuration), int64(typedValue))
+	case error:
+		return appendString(append(buffer, valueString), typedValue.Error())
+	case fmt.Stringer:
+		return appendString(append(buffer, valueString), typedValue.String())
+	}
+
+	return appendString(append(buffer, valueString), fmt.Sprint(value))
+}
+
+// byteReader reads the values of a record body, remembering the first error encountered
+type byteReader struct {
+	body []byte // The bytes left to read
+	err  error  // The first error encountered
+}
+
+var errCorruptRecord = errors.New("binlog: corrupt record frame")
+
+func (reader *byteReader) byte() byte {
+	if reader.err != nil || len(reader.body) == 0 {
+		reader.err = errCorruptRecord
+		return 0
+	}
+
+	b := reader.body[0]
+	reader.body = reader.body[1:]
+	return b
+}
+
+func (reader *byteReader) uvarint() uint64 {
+	if reader.err != nil {
+		return 0
+	}
+
+	value, size := binary.Uvarint(reader.body)
+	if size <= 0 {
+		reader.err = errCorruptRecord
+		return 0
+	}
+	reader.body = reader.body[size:]
+	return value
+}
+
+func (reader *byteReader) varint() int64 {
+	if reader.err != nil {
+		return 0
+	}
+
+	value, size := binary.Varint(reader.body)
+	if size <= 0 {
+		reader.err = errCorruptRecord
+		return 0
+	}
+	reader.body = reader.body[size:]
+	return value
+}
+
+func (reader *byteReader) string() string {
+	length := reader.uvarint()
+	if reader.err != nil || length > uint64(len(reader.body)) {
+		reader.err = errCorruptRecord
+		return ""
+	}
+
+	s := string(reader.body[:length])
+	reader.body = reader.body[length:]
+	return s
+}
+
+func (reader *byteReader) value() interface{} {
+	switch reader.byte() {
+	case valueNil:
+		return nil
+	case valueString:
+		return reader.string()
+	case valueInt:
+		return reader.varint()
+	case valueUint:
+		return reader.uvarint()
+	case valueFloat:
+		if reader.err != nil || len(reader.body) < 8 {
+			reader.err = errCorruptRecord
+			return nil
+		}
+		bits := binary.LittleEndian.Uint64(reader.body)
+		reader.body = reader.body[8:]
+		return math.Float64frombits(bits)
+	case valueBool:
+		return reader.byte() != 0
+	case valueTime:
+		return time.Unix(0, reader.varint())
+	case valueDuration:
+		return time.Duration(reader.varint())
+	}
+
+	if reader.err == nil {
+		reader.err = errCorruptRecord
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package binlog
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDecodeReturnsTheRecordsThatWereEncoded(t *testing.T) {
+	logTime := time.Unix(1500000000, 123456789)
+	records := []Record{
+		{Time: logTime, Level: "INFO", Context: "billing", Message: "first", Fields: []Field{{"user", "alice"}, {"attempt", int64(-3)}}},
+		{Time: logTime.Add(time.Second), Level: "WARNING", Context: "billing", Message: "second\nline", Fields: []Field{{"ratio", 0.5}, {"ok", true}, {"size", uint64(7)}, {"took", time.Millisecond}, {"none", nil}}},
+		{Time: logTime.Add(2 * time.Second), Level: "PANIC", Message: ""},
+	}
+
+	var stream bytes.Buffer
+	encoder := NewEncoder()
+	for _, record := range records {
+		stream.Write(encoder.Encode(record))
+	}
+
+	decoder := NewDecoder(&stream)
+	for index, wantRecord := range records {
+		gotRecord, err := decoder.Decode()
+		if err != nil {
+			t.Errorf("Expected record %d to decode but got error '%s'", index, err.Error())
+			return
+		}
+
+		if !gotRecord.Time.Equal(wantRecord.Time) || gotRecord.Level != wantRecord.Level || gotRecord.Context != wantRecord.Context || gotRecord.Message != wantRecord.Message {
+			t.Errorf("Expected record %d to be '%v' but got '%v'", index, wantRecord, gotRecord)
+		}
+
+		if len(gotRecord.Fields) != len(wantRecord.Fields) {
+			t.Errorf("Expected record %d to have fields '%v' but got '%v'", index, wantRecord.Fields, gotRecord.Fields)
+			continue
+		}
+		for fieldIndex, wantField := range wantRecord.Fields {
+			if gotRecord.Fields[fieldIndex] != wantField {
+				t.Errorf("Expected field '%v' but got '%v'", wantField, gotRecord.Fields[fieldIndex])
+			}
+		}
+	}
+
+	if _, err := decoder.Decode(); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end of the stream but got '%v'", err)
+	}
+}
+
+func TestEncodeInternsRepeatedStrings(t *testing.T) {
+	encoder := NewEncoder()
+	record := Record{Time: time.Now(), Level: "DEBUG", Context: "a rather long context string", Message: "m", Fields: []Field{{"a rather long field key", 1}}}
+
+	firstLength := len(encoder.Encode(record))
+	secondLength := len(encoder.Encode(record))
+	if secondLength >= firstLength-2*len(record.Context) {
+		t.Errorf("Expected the second record to reference interned strings, but it was %d bytes against %d", secondLength, firstLength)
+	}
+}
+
+func TestDecodeHandlesAppendedSessions(t *testing.T) {
+	// a restarted process appends a new session to the same file, reusing string ids
+	var stream bytes.Buffer
+	stream.Write(NewEncoder().Encode(Record{Time: time.Now(), Level: "INFO", Context: "first run", Message: "a"}))
+	stream.Write(NewEncoder().Encode(Record{Time: time.Now(), Level: "INFO", Context: "second run", Message: "b"}))
+
+	decoder := NewDecoder(&stream)
+	for _, wantContext := range []string{"first run", "second run"} {
+		record, err := decoder.Decode()
+		if err != nil {
+			t.Errorf("Expected record to decode but got error '%s'", err.Error())
+			return
+		}
+		if record.Context != wantContext {
+			t.Errorf("Expected context '%s' but got '%s'", wantContext, record.Context)
+		}
+	}
+}
+
+func TestDecodeReportsTruncatedStreams(t *testing.T) {
+	frames := NewEncoder().Encode(Record{Time: time.Now(), Level: "INFO", Message: "truncated"})
+
+	decoder := NewDecoder(bytes.NewReader(frames[:len(frames)-3]))
+	if _, err := decoder.Decode(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF for a truncated stream but got '%v'", err)
+	}
+}
+
+func TestDecodeRejectsStreamsThatAreNotBinaryGolog(t *testing.T) {
+	decoder := NewDecoder(bytes.NewReader([]byte("[2020-01-01] INFO: text log\n")))
+	if _, err := decoder.Decode(); err == nil || err == io.EOF {
+		t.Errorf("Expected an error decoding a text log but got '%v'", err)
+	}
+}
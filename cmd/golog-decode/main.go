@@ -0,0 +1,147 @@
+/*
+	golog-decode converts binary golog files back into text or JSON lines
+
+	Usage:
+
+		golog-decode [-format text|json] [file ...]
+
+	Standard input is decoded when no files are given.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gnikonorov/golog"
+	"github.com/gnikonorov/golog/binlog"
+)
+
+// jsonRecord is the layout of a record printed with '-format json'
+type jsonRecord struct {
+	Time    string                 `json:"time"`
+	Level   string                 `json:"level"`
+	Context string                 `json:"context,omitempty"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+func main() {
+	format := flag.String("format", "text", "the output format, either 'text' or 'json'")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "golog-decode: unknown format '%s'. Use 'text' or 'json'\n", *format)
+		os.Exit(2)
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+
+	if flag.NArg() == 0 {
+		if err := decodeStream(os.Stdin, writer, *format); err != nil {
+			writer.Flush()
+			fmt.Fprintf(os.Stderr, "golog-decode: <stdin>: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, filePath := range flag.Args() {
+		fileHandle, err := os.Open(filePath)
+		if err != nil {
+			writer.Flush()
+			fmt.Fprintf(os.Stderr, "golog-decode: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		err = decodeStream(fileHandle, writer, *format)
+		fileHandle.Close()
+		if err != nil {
+			writer.Flush()
+			fmt.Fprintf(os.Stderr, "golog-decode: %s: %s\n", filePath, err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// decodeStream writes every record of 'reader' to 'writer' in 'format'
+func decodeStream(reader io.Reader, writer io.Writer, format string) error {
+	decoder := binlog.NewDecoder(reader)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+
+	for {
+		record, err := decoder.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if format == "json" {
+			err = encoder.Encode(toJSONRecord(record))
+		} else {
+			_, err = io.WriteString(writer, formatText(record))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// formatText renders 'record' the way golog's text format does, followed by its fields. Control characters and ANSI
+// escape sequences in the record are escaped, so they never reach the terminal
+func formatText(record binlog.Record) string {
+	var stringBuilder strings.Builder
+
+	stringBuilder.WriteString("[")
+	stringBuilder.WriteString(record.Time.String())
+	stringBuilder.WriteString("] ")
+	stringBuilder.WriteString(golog.EscapeLogText(record.Level))
+	stringBuilder.WriteString(": ")
+	stringBuilder.WriteString(golog.EscapeLogText(record.Context))
+	stringBuilder.WriteString(golog.EscapeLogText(record.Message))
+	for _, field := range record.Fields {
+		stringBuilder.WriteString(" ")
+		stringBuilder.WriteString(golog.EscapeLogText(field.Key))
+		stringBuilder.WriteString("=")
+		stringBuilder.WriteString(golog.EscapeLogText(fmt.Sprint(field.Value)))
+	}
+	stringBuilder.WriteString("\n")
+
+	return stringBuilder.String()
+}
+
+// toJSONRecord converts 'record' into its JSON layout
+func toJSONRecord(record binlog.Record) jsonRecord {
+	converted := jsonRecord{Time: record.Time.Format(time.RFC3339Nano), Level: record.Level, Context: record.Context, Message: record.Message}
+	if len(record.Fields) > 0 {
+		converted.Fields = make(map[string]interface{}, len(record.Fields))
+		for _, field := range record.Fields {
+			var value = field.Value
+			switch typedValue := value.(type) {
+			case time.Duration:
+				value = typedValue.String()
+			case float64:
+				// JSON has no NaN or infinity, so they are written as strings
+				if math.IsNaN(typedValue) || math.IsInf(typedValue, 0) {
+					value = strconv.FormatFloat(typedValue, 'g', -1, 64)
+				}
+			}
+			converted.Fields[field.Key] = value
+		}
+	}
+
+	return converted
+}
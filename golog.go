@@ -7,111 +7,71 @@
 package golog
 
 import (
+	"errors"
+	"runtime"
 	"time"
 )
 
-const (
-	outStreamStdErr = 10
-	outStreamStdOut = 11
-)
-
 // Debug Outputs debug log information to the logging destination
 func (logger *Logger) Debug(logText string) {
-	var paintColor = colorNone
-	var resetColor = colorNone
-	if logger.colorize {
-		paintColor = colorDebug
-		resetColor = colorReset
-	}
-
-	loggingMessage := logMessage{time.Now().String(), levelDebug.String(), paintColor.String(), resetColor.String(), logText, outStreamStdOut, false, logger}
-	if logger.isAsynch {
-		logger.queueMgr.enqueue(loggingMessage)
-	} else {
-		writeLog(loggingMessage)
-	}
+	logger.log(LevelDebug, logText, false)
 }
 
 // Info Outputs info log information to the logging destination
 func (logger *Logger) Info(logText string) {
-	var paintColor = colorNone
-	var resetColor = colorNone
-
-	loggingMessage := logMessage{time.Now().String(), levelInfo.String(), paintColor.String(), resetColor.String(), logText, outStreamStdOut, false, logger}
-	if logger.isAsynch {
-		logger.queueMgr.enqueue(loggingMessage)
-	} else {
-		writeLog(loggingMessage)
-	}
+	logger.log(LevelInfo, logText, false)
 }
 
 // Warning Outputs warning information to the logging destination
 func (logger *Logger) Warning(logText string) {
-	var paintColor = colorNone
-	var resetColor = colorNone
-	if logger.colorize {
-		paintColor = colorWarn
-		resetColor = colorReset
-	}
-
-	loggingMessage := logMessage{time.Now().String(), levelWarn.String(), paintColor.String(), resetColor.String(), logText, outStreamStdOut, false, logger}
-	if logger.isAsynch {
-		logger.queueMgr.enqueue(loggingMessage)
-	} else {
-		writeLog(loggingMessage)
-	}
+	logger.log(LevelWarn, logText, false)
 }
 
 // Err Outputs error information to the logging destination
 func (logger *Logger) Err(logText string) {
-	var paintColor = colorNone
-	var resetColor = colorNone
-	if logger.colorize {
-		paintColor = colorErr
-		resetColor = colorReset
-	}
-
-	loggingMessage := logMessage{time.Now().String(), levelErr.String(), paintColor.String(), resetColor.String(), logText, outStreamStdErr, false, logger}
-	if logger.isAsynch {
-		logger.queueMgr.enqueue(loggingMessage)
-	} else {
-		writeLog(loggingMessage)
-	}
+	logger.log(LevelErr, logText, false)
 }
 
 // Fatal Outputs fatal information to the logging desination but does not cause a panic,
 // use 'Panic' instead.
 func (logger *Logger) Fatal(logText string) {
-	var paintColor = colorNone
-	var resetColor = colorNone
-	if logger.colorize {
-		paintColor = colorFatal
-		resetColor = colorReset
-	}
-
-	loggingMessage := logMessage{time.Now().String(), levelFatal.String(), paintColor.String(), resetColor.String(), logText, outStreamStdErr, false, logger}
-	if logger.isAsynch {
-		logger.queueMgr.enqueue(loggingMessage)
-	} else {
-		writeLog(loggingMessage)
-	}
+	logger.log(LevelFatal, logText, false)
 }
 
 // Panic Outputs fatal information to the logging desination and causes a panic
 func (logger *Logger) Panic(logText string) {
-	var paintColor = colorNone
-	var resetColor = colorNone
-	if logger.colorize {
-		paintColor = colorPanic
-		resetColor = colorReset
-	}
+	logger.log(LevelPanic, logText, true)
+}
 
-	loggingMessage := logMessage{time.Now().String(), levelPanic.String(), paintColor.String(), resetColor.String(), logText, outStreamStdErr, true, logger}
-	if logger.isAsynch {
-		logger.queueMgr.enqueue(loggingMessage)
-	} else {
-		writeLog(loggingMessage)
-	}
+// DebugT Outputs debug log information rendered from 'template', in which each '{name}' placeholder is replaced by the next
+// argument of 'args'. The raw template, its hash and the named arguments are kept as fields for structured formats
+func (logger *Logger) DebugT(template string, args ...interface{}) {
+	logger.logTemplate(LevelDebug, template, args, false)
+}
+
+// InfoT Outputs info log information rendered from 'template'. See 'DebugT' for the template syntax
+func (logger *Logger) InfoT(template string, args ...interface{}) {
+	logger.logTemplate(LevelInfo, template, args, false)
+}
+
+// WarningT Outputs warning information rendered from 'template'. See 'DebugT' for the template syntax
+func (logger *Logger) WarningT(template string, args ...interface{}) {
+	logger.logTemplate(LevelWarn, template, args, false)
+}
+
+// ErrT Outputs error information rendered from 'template'. See 'DebugT' for the template syntax
+func (logger *Logger) ErrT(template string, args ...interface{}) {
+	logger.logTemplate(LevelErr, template, args, false)
+}
+
+// FatalT Outputs fatal information rendered from 'template' but does not cause a panic. See 'DebugT' for the template syntax
+func (logger *Logger) FatalT(template string, args ...interface{}) {
+	logger.logTemplate(LevelFatal, template, args, false)
+}
+
+// PanicT Outputs fatal information rendered from 'template' and causes a panic. See 'DebugT' for the template syntax
+func (logger *Logger) PanicT(template string, args ...interface{}) {
+	logger.logTemplate(LevelPanic, template, args, true)
 }
 
 // IsUninitialized Returns true if this structure has not yet been allocated
@@ -127,10 +87,176 @@ func (logger *Logger) SetContext(context string) {
 	logger.context = context
 }
 
-// Shutdown flushes the logger and outputs any remaining messages in its queue if it is asynch
+// SetField attaches the field 'key' with 'value' to every following log message. Fields are written by the structured
+// formats, such as 'FormatGELF' and 'FormatCEF'. Setting a field that already exists replaces its value
+func (logger *Logger) SetField(key string, value interface{}) {
+	// fields are copied on write since queued messages still reference the previous slice
+	fields := make([]Field, len(logger.fields), len(logger.fields)+1)
+	copy(fields, logger.fields)
+
+	for index := range fields {
+		if fields[index].Key == key {
+			fields[index].Value = value
+			logger.fields = fields
+			return
+		}
+	}
+
+	logger.fields = append(fields, Field{key, value})
+}
+
+// RemoveField removes the field 'key' previously attached via 'SetField'
+func (logger *Logger) RemoveField(key string) {
+	fields := make([]Field, 0, len(logger.fields))
+	for _, field := range logger.fields {
+		if field.Key != key {
+			fields = append(fields, field)
+		}
+	}
+
+	logger.fields = fields
+}
+
+// Flush outputs any messages in the logger's queue if it is asynch and writes out the records buffered by its sinks
+func (logger *Logger) Flush() {
+	if logger.isAsynch {
+		logger.queueMgr.flush()
+	}
+
+	for _, sink := range logger.sinks {
+		if err := sink.Flush(); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// Reopen closes the logger's files and opens them again by their paths, for use after a tool such as logrotate moved
+// them. Messages logged before the call are written to the old files, and messages logged after it to the new ones.
+// The first error encountered is returned, after every file was tried
+func (logger *Logger) Reopen() error {
+	var returnError error
+
+	reopenSinks := func() {
+		for _, sink := range logger.sinks {
+			if reopener, ok := sink.(Reopener); ok {
+				if err := reopener.Reopen(); err != nil && returnError == nil {
+					returnError = err
+				}
+			}
+		}
+	}
+
+	if logger.isAsynch {
+		// hold back the queue so no message is written while the files are swapped
+		logger.queueMgr.flushThen(reopenSinks)
+	} else {
+		reopenSinks()
+	}
+
+	return returnError
+}
+
+// DeliveryCounters adds up the counters of the logger's outputs that deliver records to remote endpoints, such as
+// syslog or a collector, to tell how many records were delivered, dropped, retried or are still buffered
+func (logger *Logger) DeliveryCounters() DeliveryCounters {
+	var counters DeliveryCounters
+	for _, sink := range logger.sinks {
+		if counter, ok := sink.(DeliveryCounter); ok {
+			counters = counters.add(counter.DeliveryCounters())
+		}
+	}
+
+	return counters
+}
+
+// Query returns the records kept by the logger's ring buffer that are selected by 'filter', newest first. If 'limit' is
+// above 0, at most that many records are returned. An error is returned if the logger has no ring buffer, configured
+// via 'RingBuffer' in 'LoggingConfig' or passed in 'Sinks', or if the filter is invalid
+func (logger *Logger) Query(filter RecordFilter, limit int) ([]Record, error) {
+	for _, sink := range logger.sinks {
+		// a ring buffer passed in 'Sinks' may be wrapped by 'NewFilteredSink'
+		for filtered, ok := sink.(*filteredSink); ok; filtered, ok = sink.(*filteredSink) {
+			sink = filtered.unwrap()
+		}
+
+		if ringBuffer, ok := sink.(*RingBuffer); ok {
+			return ringBuffer.Query(filter, limit)
+		}
+	}
+
+	return nil, errors.New("Unable to query records because: the logger has no ring buffer")
+}
+
+// Subscribe returns a channel receiving the records selected by 'filter' as they are logged, until 'Unsubscribe' is
+// called with it or the logger shuts down, which closes it. The channel holds up to 'bufferSize' records, 100 if 0 is
+// passed. Records logged while it is full are not sent to it, so a slow consumer misses records rather than slowing
+// down logging. An error is returned if the filter or buffer size is invalid, or the logger is shut down
+func (logger *Logger) Subscribe(filter RecordFilter, bufferSize int) (<-chan Record, error) {
+	if logger.subscriptions == nil {
+		return nil, errors.New("Unable to subscribe because: the logger was not set up")
+	}
+
+	return logger.subscriptions.subscribe(filter, bufferSize)
+}
+
+// Unsubscribe stops sending records to 'records', a channel returned by 'Subscribe', and closes it. Records still
+// buffered in the channel can be read until it is drained
+func (logger *Logger) Unsubscribe(records <-chan Record) {
+	if logger.subscriptions != nil {
+		logger.subscriptions.unsubscribe(records)
+	}
+}
+
+// Shutdown flushes the logger, outputs any remaining messages in its queue if it is asynch and closes its sinks
 // one should always call shutdown to ensure all messages are logged correctly
 func (logger *Logger) Shutdown() {
+	if logger.signalHandler != nil {
+		logger.signalHandler.stop()
+	}
+
 	if logger.isAsynch {
 		logger.queueMgr.stop()
 	}
+
+	for _, sink := range logger.sinks {
+		sink.Close()
+	}
+
+	if logger.subscriptions != nil {
+		logger.subscriptions.close()
+	}
+}
+
+// log builds a log message for 'logText' at 'level' and hands it off for writing, queueing it first if the logger is asynch
+func (logger *Logger) log(level LoggingLevel, logText string, shouldPanic bool) {
+	logger.logWithFields(level, logText, logger.fields, shouldPanic)
+}
+
+// logWithFields is 'log' for messages carrying 'fields' rather than just the fields of the logger. It must be called
+// through exactly one helper by the public logging methods so the caller's source location is found
+func (logger *Logger) logWithFields(level LoggingLevel, logText string, fields []Field, shouldPanic bool) {
+	var clock = logger.clock
+	if clock == nil {
+		// the logger was not set up
+		clock = time.Now
+	}
+
+	record := Record{Time: clock(), Level: level, Context: logger.context, Message: logText, Fields: fields}
+	if logger.captureCaller {
+		// skip this function, the helper that called it and the public logging method
+		if programCounter, file, line, ok := runtime.Caller(3); ok {
+			record.CallerFile = file
+			record.CallerLine = line
+			if function := runtime.FuncForPC(programCounter); function != nil {
+				record.CallerFunction = function.Name()
+			}
+		}
+	}
+
+	loggingMessage := logMessage{record, shouldPanic, logger}
+	if logger.isAsynch {
+		logger.queueMgr.enqueue(loggingMessage)
+	} else {
+		writeLog(loggingMessage)
+	}
 }
@@ -0,0 +1,161 @@
+//go:build !windows
+// +build !windows
+
+package golog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// listenJournald returns a unixgram socket standing in for journald, and the directory holding it
+func listenJournald(t *testing.T) (*net.UnixConn, string) {
+	directory, err := ioutil.TempDir("", "golog-journald")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory because: '%s'", err.Error())
+	}
+
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(directory, "socket"), Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(directory)
+		t.Skipf("Could not listen on a unixgram socket because: '%s'", err.Error())
+	}
+
+	return listener, directory
+}
+
+// parseJournalPayload returns the fields of a native protocol message
+func parseJournalPayload(payload []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(payload) > 0 {
+		lineEnd := bytes.IndexByte(payload, '\n')
+		if lineEnd < 0 {
+			break
+		}
+
+		line := string(payload[:lineEnd])
+		if separator := strings.IndexByte(line, '='); separator >= 0 {
+			fields[line[:separator]] = line[separator+1:]
+			payload = payload[lineEnd+1:]
+			continue
+		}
+
+		length := int(binary.LittleEndian.Uint64(payload[lineEnd+1 : lineEnd+9]))
+		fields[line] = string(payload[lineEnd+9 : lineEnd+9+length])
+		payload = payload[lineEnd+9+length+1:]
+	}
+
+	return fields
+}
+
+func TestJournaldReceivesPriorityCallerAndFields(t *testing.T) {
+	listener, directory := listenJournald(t)
+	defer os.RemoveAll(directory)
+	defer listener.Close()
+
+	journaldConfig := JournaldConfig{SocketPath: listener.LocalAddr().String(), SyslogIdentifier: "golog-test"}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Journald: &journaldConfig}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.SetField("request id", 42)
+	logger.SetField("_trusted", "spoofed")
+	_, _, line, _ := runtime.Caller(0)
+	logger.Warning("first line\nsecond line")
+
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buffer := make([]byte, 65536)
+	size, err := listener.Read(buffer)
+	if err != nil {
+		t.Errorf("Failed to receive the journal entry because: '%s'", err.Error())
+		return
+	}
+
+	fields := parseJournalPayload(buffer[:size])
+	var expectedFields = map[string]string{"MESSAGE": "first line\nsecond line", "PRIORITY": "4", "SYSLOG_IDENTIFIER": "golog-test", "CODE_LINE": strconv.Itoa(line + 1), "REQUEST_ID": "42", "TRUSTED": "spoofed"}
+	for name, expectedValue := range expectedFields {
+		if fields[name] != expectedValue {
+			t.Errorf("Expected journal field '%s' to be %q but got %q", name, expectedValue, fields[name])
+		}
+	}
+
+	if !strings.HasSuffix(fields["CODE_FILE"], "golog_journald_test.go") || !strings.HasSuffix(fields["CODE_FUNC"], "TestJournaldReceivesPriorityCallerAndFields") {
+		t.Errorf("Expected the caller's file and function but got %q and %q", fields["CODE_FILE"], fields["CODE_FUNC"])
+	}
+}
+
+func TestJournaldPassesPayloadsTooLargeForADatagramAsFiles(t *testing.T) {
+	listener, directory := listenJournald(t)
+	defer os.RemoveAll(directory)
+	defer listener.Close()
+
+	sink, err := NewJournaldSink(JournaldConfig{SocketPath: listener.LocalAddr().String()})
+	if err != nil {
+		t.Errorf("Failed to create journald sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	message := strings.Repeat("x", 4*1024*1024)
+	sink.Write(Record{Level: LevelInfo, Message: message})
+
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	oob := make([]byte, 128)
+	_, oobSize, _, _, err := listener.ReadMsgUnix(make([]byte, 16), oob)
+	if err != nil {
+		t.Errorf("Failed to receive the journal entry because: '%s'", err.Error())
+		return
+	}
+
+	controlMessages, err := syscall.ParseSocketControlMessage(oob[:oobSize])
+	if err != nil || len(controlMessages) != 1 {
+		t.Errorf("Expected a single control message carrying a file descriptor but got %d and error '%v'", len(controlMessages), err)
+		return
+	}
+
+	descriptors, err := syscall.ParseUnixRights(&controlMessages[0])
+	if err != nil || len(descriptors) != 1 {
+		t.Errorf("Expected a single file descriptor but got %d and error '%v'", len(descriptors), err)
+		return
+	}
+
+	file := os.NewFile(uintptr(descriptors[0]), "journal-payload")
+	defer file.Close()
+
+	// on linux the payload comes in a sealed memory file, which journald takes whatever the sender's temporary directory
+	if runtime.GOOS == "linux" {
+		const sealSealShrinkGrowWrite = 0xF
+		seals, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), 1034, 0)
+		if errno != 0 || seals&sealSealShrinkGrowWrite != sealSealShrinkGrowWrite {
+			t.Errorf("Expected the payload file to be sealed but got seals %#x and error '%v'", seals, errno)
+		}
+	}
+
+	// journald reads the file from its start regardless of the offset the sender left it at
+	file.Seek(0, io.SeekStart)
+
+	payload, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Errorf("Failed to read the passed payload because: '%s'", err.Error())
+		return
+	}
+
+	if fields := parseJournalPayload(payload); fields["MESSAGE"] != message || fields["PRIORITY"] != "6" {
+		t.Errorf("Expected the passed payload to hold the whole message at priority 6 but got a %d byte message at priority %q", len(fields["MESSAGE"]), fields["PRIORITY"])
+	}
+}
@@ -1,6 +1,41 @@
 package golog
 
-import "testing"
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gnikonorov/golog/binlog"
+	"github.com/spf13/afero"
+)
 
 func makeLoggerInstance() (*Logger, error) {
 	logDirectory := ""
@@ -62,3 +97,2610 @@ func TestIsUninitializedReturnsTrueWhenLoggingModeIsUnset(t *testing.T) {
 		t.Errorf("Expected logger to be uninitialized, but it was initialized")
 	}
 }
+
+func TestSetFieldAndRemoveFieldMaintainTheLoggerFields(t *testing.T) {
+	logger, err := makeLoggerInstance()
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.SetField("first", 1)
+	logger.SetField("second", "two")
+	previousFields := logger.fields
+
+	logger.SetField("first", "one")
+	if len(logger.fields) != 2 || logger.fields[0].Key != "first" || logger.fields[0].Value != "one" {
+		t.Errorf("Expected 'first' to be replaced in place but fields were '%v'", logger.fields)
+	}
+
+	if previousFields[0].Value != 1 {
+		t.Errorf("Expected fields captured by earlier messages to be left untouched but got '%v'", previousFields)
+	}
+
+	logger.RemoveField("first")
+	if len(logger.fields) != 1 || logger.fields[0].Key != "second" {
+		t.Errorf("Expected only 'second' to remain but fields were '%v'", logger.fields)
+	}
+}
+
+func TestRenderTemplateFillsNamedPlaceholdersInOrder(t *testing.T) {
+	logText, fields := renderTemplate("User {user} logged in from {ip} {{literal}} {missing}", []interface{}{"alice", "10.0.0.1"})
+
+	wantText := "User alice logged in from 10.0.0.1 {literal} {missing}"
+	if logText != wantText {
+		t.Errorf("Expected template to render as '%s' but got '%s'", wantText, logText)
+	}
+
+	if len(fields) != 2 || fields[0].Key != "user" || fields[0].Value != "alice" || fields[1].Key != "ip" || fields[1].Value != "10.0.0.1" {
+		t.Errorf("Expected named argument fields for 'user' and 'ip' but got '%v'", fields)
+	}
+}
+
+func TestRenderTemplateKeepsExtraArgumentsAsFields(t *testing.T) {
+	logText, fields := renderTemplate("Retrying {operation}", []interface{}{"upload", 3})
+
+	if logText != "Retrying upload" {
+		t.Errorf("Expected template to render as 'Retrying upload' but got '%s'", logText)
+	}
+
+	if len(fields) != 2 || fields[1].Key != "arg1" || fields[1].Value != 3 {
+		t.Errorf("Expected the extra argument to be kept as field 'arg1' but got '%v'", fields)
+	}
+}
+
+func TestRenderTemplateKeepsTheFirstArgumentOfARepeatedPlaceholderAsField(t *testing.T) {
+	logText, fields := renderTemplate("{user} invited {guest}, then {user} left", []interface{}{"alice", "bob", "carol"})
+
+	if logText != "alice invited bob, then carol left" {
+		t.Errorf("Expected template to render as 'alice invited bob, then carol left' but got '%s'", logText)
+	}
+
+	if len(fields) != 2 || fields[0].Key != "user" || fields[0].Value != "alice" || fields[1].Key != "guest" {
+		t.Errorf("Expected a single 'user' field holding the first argument but got '%v'", fields)
+	}
+}
+
+func TestTemplateHashIsStableAcrossArguments(t *testing.T) {
+	template := "User {user} logged in from {ip}"
+	if templateHash(template) != templateHash(template) || len(templateHash(template)) != 8 {
+		t.Errorf("Expected a stable 8 digit hash but got '%s'", templateHash(template))
+	}
+
+	if templateHash(template) == templateHash("User {user} logged out") {
+		t.Errorf("Expected different templates to hash differently")
+	}
+}
+
+func TestInfoTKeepsTheTemplateAndArgumentsAsFields(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "template.log", LogFormat: FormatJSON, IsMock: true}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	logger.SetField("service", "auth")
+
+	template := "User {user} logged in from {ip}"
+	logger.InfoT(template, "alice", "10.0.0.1")
+
+	logger.Flush()
+
+	fileBytes, err := afero.ReadFile(logger.osHandle, "/logs/template.log")
+	if err != nil {
+		t.Errorf("Failed to read log file because: '%s'", err.Error())
+		return
+	}
+
+	var document struct {
+		Message string                 `json:"message"`
+		Caller  map[string]interface{} `json:"caller"`
+		Fields  map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(fileBytes, &document); err != nil {
+		t.Errorf("Expected valid JSON but got error '%s' for %q", err.Error(), string(fileBytes))
+		return
+	}
+
+	if document.Message != "User alice logged in from 10.0.0.1" {
+		t.Errorf("Expected the rendered message but got '%s'", document.Message)
+	}
+
+	wantFields := map[string]interface{}{"service": "auth", "message_template": template, "template_hash": templateHash(template), "user": "alice", "ip": "10.0.0.1"}
+	for key, wantValue := range wantFields {
+		if document.Fields[key] != wantValue {
+			t.Errorf("Expected field '%s' to be '%v' but got '%v'", key, wantValue, document.Fields[key])
+		}
+	}
+
+	if file, _ := document.Caller["file"].(string); !strings.HasSuffix(file, "golog_test.go") {
+		t.Errorf("Expected the caller to be the test file but got '%v'", document.Caller["file"])
+	}
+}
+
+func TestLoggerWritesEveryRecordToEachConfiguredSink(t *testing.T) {
+	var textBuffer, jsonBuffer strings.Builder
+
+	textFormatter, _ := NewFormatter(FormatText)
+	jsonFormatter, _ := NewFormatter(FormatJSON)
+
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Sinks: []Sink{NewWriterSink(&textBuffer, textFormatter), NewWriterSink(&jsonBuffer, jsonFormatter)}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger with only sinks because: '%s'", err.Error())
+		return
+	}
+
+	logger.Info("hello")
+	logger.Err("world")
+
+	if strings.Count(textBuffer.String(), "\n") != 2 || !strings.Contains(textBuffer.String(), "INFO: hello") || !strings.Contains(textBuffer.String(), "ERROR: world") {
+		t.Errorf("Expected both records as text lines but got %q", textBuffer.String())
+	}
+
+	jsonLines := strings.Split(strings.TrimSuffix(jsonBuffer.String(), "\n"), "\n")
+	if len(jsonLines) != 2 {
+		t.Errorf("Expected both records as JSON lines but got %q", jsonBuffer.String())
+		return
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonLines[1]), &document); err != nil || document["message"] != "world" {
+		t.Errorf("Expected the second JSON line to hold the second record but got %q", jsonLines[1])
+	}
+}
+
+func TestLoggerWritesToBuiltInAndConfiguredSinks(t *testing.T) {
+	var sinkBuffer strings.Builder
+
+	textFormatter, _ := NewFormatter(FormatText)
+
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "sinks.log", IsMock: true, Sinks: []Sink{NewWriterSink(&sinkBuffer, textFormatter)}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.Warning("both")
+
+	logger.Flush()
+
+	fileBytes, err := afero.ReadFile(logger.osHandle, "/logs/sinks.log")
+	if err != nil {
+		t.Errorf("Failed to read log file because: '%s'", err.Error())
+		return
+	}
+
+	if string(fileBytes) != sinkBuffer.String() {
+		t.Errorf("Expected the log file and the sink to receive the same line but got %q and %q", string(fileBytes), sinkBuffer.String())
+	}
+}
+
+func TestSetupRejectsMissingModeWithoutSinks(t *testing.T) {
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true}
+	if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+		t.Errorf("Expected a logger without a mode or sinks to be rejected")
+	}
+}
+
+func TestAsynchLoggerWritesEveryQueuedMessageInOrderOnShutdown(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "asynch.log", IsMock: true, IsAsynch: true}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	for index := 0; index < 1000; index++ {
+		logger.Info(strconv.Itoa(index))
+	}
+	logger.Shutdown()
+
+	fileBytes, err := afero.ReadFile(logger.osHandle, "/logs/asynch.log")
+	if err != nil {
+		t.Errorf("Failed to read log file because: '%s'", err.Error())
+		return
+	}
+
+	logLines := strings.Split(strings.TrimSuffix(string(fileBytes), "\n"), "\n")
+	if len(logLines) != 1000 {
+		t.Errorf("Expected 1000 log lines but got %d", len(logLines))
+		return
+	}
+
+	for index, logLine := range logLines {
+		if !strings.HasSuffix(logLine, "INFO: "+strconv.Itoa(index)) {
+			t.Errorf("Expected line %d to hold message '%d' but got %q", index, index, logLine)
+			return
+		}
+	}
+}
+
+func TestFileSinkBuffersRecordsUntilFlushed(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "buffered.log", IsMock: true, FileFlushInterval: -1}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.Info("buffered")
+
+	fileBytes, _ := afero.ReadFile(logger.osHandle, "/logs/buffered.log")
+	if len(fileBytes) != 0 {
+		t.Errorf("Expected the record to stay buffered until flushed but the file holds %q", string(fileBytes))
+	}
+
+	logger.Flush()
+
+	fileBytes, _ = afero.ReadFile(logger.osHandle, "/logs/buffered.log")
+	if !strings.HasSuffix(string(fileBytes), "INFO: buffered\n") {
+		t.Errorf("Expected the record to be written once flushed but the file holds %q", string(fileBytes))
+	}
+}
+
+func TestFileSinkFlushesOnTheConfiguredInterval(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "interval.log", IsMock: true, FileFlushInterval: 10 * time.Millisecond}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.Info("eventually")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		fileBytes, _ := afero.ReadFile(logger.osHandle, "/logs/interval.log")
+		if strings.HasSuffix(string(fileBytes), "INFO: eventually\n") {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Errorf("Expected the record to be flushed to the log file within the flush interval")
+}
+
+// benchmarkFileLogging measures logging to a log file on disk with 'logConfig', which has its directory filled in
+func benchmarkFileLogging(b *testing.B, logConfig LoggingConfig) {
+	logDirectory, err := ioutil.TempDir("", "golog-benchmark")
+	if err != nil {
+		b.Fatalf("Failed to create log directory because: '%s'", err.Error())
+	}
+	defer os.RemoveAll(logDirectory)
+
+	logConfig.LogMode = ModeFile
+	logConfig.LogFileStartupAction = FileActionAppend
+	logConfig.LogDirectory = logDirectory
+	logConfig.LogFile = "benchmark.log"
+
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		b.Fatalf("Failed to set up logger because: '%s'", err.Error())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for index := 0; index < b.N; index++ {
+		logger.Info("benchmarking the file sink with a message of a typical length")
+	}
+	logger.Shutdown()
+}
+
+func BenchmarkFileLoggingSynch(b *testing.B) {
+	benchmarkFileLogging(b, LoggingConfig{})
+}
+
+func BenchmarkFileLoggingSynchUnbuffered(b *testing.B) {
+	benchmarkFileLogging(b, LoggingConfig{FileBufferSize: -1})
+}
+
+func BenchmarkFileLoggingAsynch(b *testing.B) {
+	benchmarkFileLogging(b, LoggingConfig{IsAsynch: true})
+}
+
+// readLogFiles returns the contents of every file in 'logDirectory' whose name starts with 'logFile', decompressing
+// compressed files
+func readLogFiles(osPtr afero.Fs, logDirectory string, logFile string) (map[string]string, error) {
+	fileInfos, err := afero.ReadDir(osPtr, logDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	logFiles := make(map[string]string)
+	for _, fileInfo := range fileInfos {
+		if !strings.HasPrefix(fileInfo.Name(), logFile) {
+			continue
+		}
+
+		fileBytes, err := afero.ReadFile(osPtr, logDirectory+"/"+fileInfo.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		var decompressor io.Reader
+		switch filepath.Ext(fileInfo.Name()) {
+		case ".gz":
+			decompressor, err = gzip.NewReader(bytes.NewReader(fileBytes))
+		case ".zz":
+			decompressor, err = zlib.NewReader(bytes.NewReader(fileBytes))
+		case ".deflate":
+			decompressor = flate.NewReader(bytes.NewReader(fileBytes))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if decompressor != nil {
+			fileBytes, err = ioutil.ReadAll(decompressor)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		logFiles[fileInfo.Name()] = string(fileBytes)
+	}
+
+	return logFiles, nil
+}
+
+func TestMaxFileSizeBytesRotatesWithoutLosingOrSplittingMessages(t *testing.T) {
+	for _, shouldCompress := range []bool{false, true} {
+		logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "rotate.log", IsMock: true, MaxFileSizeBytes: 200, CompressRotatedFiles: shouldCompress}
+		logger, err := SetupLoggerFromStruct(&logConfig)
+		if err != nil {
+			t.Errorf("Failed to set up logger because: '%s'", err.Error())
+			return
+		}
+
+		for index := 0; index < 20; index++ {
+			logger.Info("message " + strconv.Itoa(index))
+		}
+		logger.Shutdown()
+
+		logFiles, err := readLogFiles(logger.osHandle, "/logs", "rotate.log")
+		if err != nil {
+			t.Errorf("Failed to read log files because: '%s'", err.Error())
+			return
+		}
+
+		if len(logFiles) < 2 {
+			t.Errorf("Expected the log file to be rotated but found files %v", logFiles)
+		}
+
+		var loggedMessages = 0
+		for fileName, fileContents := range logFiles {
+			if shouldCompress != strings.HasSuffix(fileName, ".gz") && fileName != "rotate.log" {
+				t.Errorf("Expected rotated files to be compressed only if configured to but found '%s'", fileName)
+			}
+
+			if len(fileContents) > 200 {
+				t.Errorf("Expected '%s' to not exceed the maximum size but it holds %d bytes", fileName, len(fileContents))
+			}
+
+			if !strings.HasSuffix(fileContents, "\n") {
+				t.Errorf("Expected '%s' to end with a whole message but got %q", fileName, fileContents)
+			}
+
+			loggedMessages += strings.Count(fileContents, "INFO: message ")
+		}
+
+		if loggedMessages != 20 {
+			t.Errorf("Expected all 20 messages across the log files but found %d", loggedMessages)
+		}
+	}
+}
+
+// renameFailingFs is an in-memory filesystem on which renaming always fails
+type renameFailingFs struct {
+	afero.Fs
+}
+
+func (fs renameFailingFs) Rename(oldName string, newName string) error {
+	return errors.New("permission denied")
+}
+
+func TestFailedRotationKeepsLoggingToTheCurrentFileAndReportsTheFailure(t *testing.T) {
+	osPtr := renameFailingFs{afero.NewMemMapFs()}
+	formatter, _ := NewFormatter(FormatText)
+	fileSink, err := newFileSink("/logs/rotate.log", osPtr, formatter, fileSinkOptions{bufferSize: -1, maxFileSizeBytes: 1000})
+	if err != nil {
+		t.Errorf("Failed to create file sink because: '%s'", err.Error())
+		return
+	}
+
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Sinks: []Sink{fileSink}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				t.Errorf("Expected logging to go on when the log file can't be rotated but it panicked with '%v'", recovered)
+			}
+		}()
+
+		for index := 0; index < 50; index++ {
+			logger.Info("message " + strconv.Itoa(index))
+		}
+	}()
+	logger.Shutdown()
+
+	fileBytes, err := afero.ReadFile(osPtr, "/logs/rotate.log")
+	if err != nil {
+		t.Errorf("Failed to read log file because: '%s'", err.Error())
+		return
+	}
+
+	if loggedMessages := strings.Count(string(fileBytes), "INFO: message "); loggedMessages != 50 {
+		t.Errorf("Expected all 50 messages in the log file but found %d in %q", loggedMessages, string(fileBytes))
+	}
+
+	// a failed rotation is retried once the file grew by the maximum size again, not for every record
+	if failures := strings.Count(string(fileBytes), "Could not rotate log file '/logs/rotate.log' because: permission denied"); failures == 0 || failures > len(fileBytes)/1000 {
+		t.Errorf("Expected the failed rotations to be reported once per maximum size but found %d reports in %q", failures, string(fileBytes))
+	}
+}
+
+func TestMaxFileSizeBytesStartsANewBinarySessionInEachFile(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "rotate.bin", LogFormat: FormatBinary, IsMock: true, MaxFileSizeBytes: 64}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	for index := 0; index < 10; index++ {
+		logger.Info("binary message")
+	}
+	logger.Shutdown()
+
+	logFiles, err := readLogFiles(logger.osHandle, "/logs", "rotate.bin")
+	if err != nil {
+		t.Errorf("Failed to read log files because: '%s'", err.Error())
+		return
+	}
+
+	var decodedRecords = 0
+	for fileName, fileContents := range logFiles {
+		decoder := binlog.NewDecoder(strings.NewReader(fileContents))
+		for {
+			record, err := decoder.Decode()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil || record.Message != "binary message" {
+				t.Errorf("Expected '%s' to decode on its own but got error '%v'", fileName, err)
+				break
+			}
+			decodedRecords++
+		}
+	}
+
+	if len(logFiles) < 2 || decodedRecords != 10 {
+		t.Errorf("Expected 10 records across several files but decoded %d from %d files", decodedRecords, len(logFiles))
+	}
+}
+
+func TestCompressStartupFileStreamsEachFormatThroughTheLoggerFilesystem(t *testing.T) {
+	// large enough to take several reads and writes
+	oldLog := strings.Repeat("an old log line that compresses well\n", 20000)
+
+	for _, compression := range []LoggingCompression{CompressionGzip, CompressionZlib, CompressionFlate} {
+		osPtr := afero.NewMemMapFs()
+		afero.WriteFile(osPtr, "/logs/old.log", []byte(oldLog), 0644)
+
+		compressor := newFileCompressor(osPtr, compressionOptions{compression, 9, false})
+		if err := compressor.compressStartupFile("/logs/old.log"); err != nil {
+			t.Errorf("Failed to compress log file because: '%s'", err.Error())
+			continue
+		}
+
+		logFiles, err := readLogFiles(osPtr, "/logs", "old.log")
+		if err != nil {
+			t.Errorf("Failed to read log files because: '%s'", err.Error())
+			continue
+		}
+
+		if len(logFiles) != 1 {
+			t.Errorf("Expected only the compressed log file but found %d files", len(logFiles))
+		}
+
+		for fileName, fileContents := range logFiles {
+			if !strings.HasSuffix(fileName, compression.extension()) || fileContents != oldLog {
+				t.Errorf("Expected a '%s' file holding the old log but found '%s' holding %d bytes", compression.extension(), fileName, len(fileContents))
+			}
+		}
+	}
+}
+
+func TestCompressInBackgroundDoesNotBlockAndFinishesByShutdown(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, MaxFileSizeBytes: 100, CompressRotatedFiles: true, Compression: CompressionZlib, CompressInBackground: true, Retention: &RetentionPolicy{MaxArchives: 3}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	for index := 0; index < 20; index++ {
+		logger.Info("message " + strconv.Itoa(index))
+	}
+	logger.Shutdown()
+
+	logFiles, err := readLogFiles(logger.osHandle, "/logs", "app.log")
+	if err != nil {
+		t.Errorf("Failed to read log files because: '%s'", err.Error())
+		return
+	}
+
+	if len(logFiles) != 4 {
+		t.Errorf("Expected the log file and 3 archives but found %v", logFiles)
+	}
+
+	for fileName := range logFiles {
+		if fileName != "app.log" && !strings.HasSuffix(fileName, ".zz") {
+			t.Errorf("Expected every archive to be compressed by shutdown but found '%s'", fileName)
+		}
+	}
+}
+
+func TestSetupRejectsInvalidCompressionSettings(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, Compression: 4}
+	if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+		t.Errorf("Expected an invalid compression format to be rejected")
+	}
+
+	logConfig = LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, CompressionLevel: 10}
+	if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+		t.Errorf("Expected an invalid compression level to be rejected")
+	}
+}
+
+// fakeClock is a clock for tests that only moves when told to
+type fakeClock struct {
+	mux sync.Mutex
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mux.Lock()
+	defer clock.mux.Unlock()
+
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(duration time.Duration) {
+	clock.mux.Lock()
+	defer clock.mux.Unlock()
+
+	clock.now = clock.now.Add(duration)
+}
+
+func TestRotationScheduleRotatesAtDayBoundariesWithTheFilenamePattern(t *testing.T) {
+	for _, isAsynch := range []bool{false, true} {
+		clock := &fakeClock{now: time.Date(2020, time.January, 1, 22, 0, 0, 0, time.Local)}
+		rotation := RotationSchedule{Interval: RotateDaily, FilenamePattern: "app-2006-01-02.log"}
+
+		logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, IsAsynch: isAsynch, Rotation: &rotation, Clock: clock.Now}
+		logger, err := SetupLoggerFromStruct(&logConfig)
+		if err != nil {
+			t.Errorf("Failed to set up logger because: '%s'", err.Error())
+			return
+		}
+
+		logger.Info("first day")
+		clock.Advance(time.Hour)
+		logger.Info("still first day")
+		clock.Advance(2 * time.Hour)
+		logger.Info("second day")
+		clock.Advance(48 * time.Hour)
+		logger.Info("fourth day")
+		logger.Shutdown()
+
+		logFiles, err := readLogFiles(logger.osHandle, "/logs", "app")
+		if err != nil {
+			t.Errorf("Failed to read log files because: '%s'", err.Error())
+			return
+		}
+
+		wantMessages := map[string][]string{
+			"app-2020-01-01.log": {"first day", "still first day"},
+			"app-2020-01-02.log": {"second day"},
+			"app.log":            {"fourth day"},
+		}
+
+		if len(logFiles) != len(wantMessages) {
+			t.Errorf("Expected log files %v but found %v", wantMessages, logFiles)
+		}
+
+		for fileName, messages := range wantMessages {
+			logLines := strings.Split(strings.TrimSuffix(logFiles[fileName], "\n"), "\n")
+			if len(logLines) != len(messages) {
+				t.Errorf("Expected '%s' to hold %v but got %q", fileName, messages, logFiles[fileName])
+				continue
+			}
+
+			for index, message := range messages {
+				if !strings.HasSuffix(logLines[index], "INFO: "+message) {
+					t.Errorf("Expected line %d of '%s' to hold '%s' but got %q", index, fileName, message, logLines[index])
+				}
+			}
+		}
+	}
+}
+
+func TestSetupRejectsInvalidRotationSchedules(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, Rotation: &RotationSchedule{Interval: RotateEvery}}
+	if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+		t.Errorf("Expected a rotation schedule without a duration to be rejected")
+	}
+}
+
+func TestBackgroundCompressionFinishingBeforeTheFileSinkExistsIsStillReported(t *testing.T) {
+	osPtr := afero.NewMemMapFs()
+	compressor := newFileCompressor(osPtr, compressionOptions{inBackground: true})
+
+	// compressing a file that doesn't exist fails at once, long before the sink is created
+	compressor.compress("/logs/app.log.20200101000000")
+	compressor.wait()
+
+	textFormatter, _ := NewFormatter(FormatText)
+	sink, err := newFileSink("/logs/app.log", osPtr, textFormatter, fileSinkOptions{bufferSize: -1, compressor: compressor})
+	if err != nil {
+		t.Errorf("Failed to create file sink because: '%s'", err.Error())
+		return
+	}
+	sink.Close()
+
+	fileBytes, _ := afero.ReadFile(osPtr, "/logs/app.log")
+	if !strings.Contains(string(fileBytes), "ERROR") || !strings.Contains(string(fileBytes), "/logs/app.log.20200101000000") {
+		t.Errorf("Expected the failed compression to be reported in the log file but got %q", string(fileBytes))
+	}
+}
+
+func TestRetentionDeletesTheOldestArchivesAtStartupAndLogsThem(t *testing.T) {
+	osPtr := afero.NewMemMapFs()
+	now := time.Date(2020, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	archiveNames := []string{"app.log.20200101000000.gz", "app-2020-01-02.log", "app-2020-01-03.log.1.gz", "app.log.20200104000000"}
+	for index, archiveName := range archiveNames {
+		afero.WriteFile(osPtr, "/logs/"+archiveName, []byte("old line\n"), 0644)
+		osPtr.Chtimes("/logs/"+archiveName, now, now.AddDate(0, 0, -len(archiveNames)+index))
+	}
+	afero.WriteFile(osPtr, "/logs/unrelated.log", []byte("not an archive\n"), 0644)
+	osPtr.Chtimes("/logs/unrelated.log", now, now.AddDate(-1, 0, 0))
+
+	textFormatter, _ := NewFormatter(FormatText)
+	options := fileSinkOptions{rotationSchedule: &RotationSchedule{Interval: RotateDaily, FilenamePattern: "app-2006-01-02.log"}, retentionPolicy: &RetentionPolicy{MaxArchives: 2}, clock: func() time.Time { return now }}
+	sink, err := newFileSink("/logs/app.log", osPtr, textFormatter, options)
+	if err != nil {
+		t.Errorf("Failed to create file sink because: '%s'", err.Error())
+		return
+	}
+	sink.Close()
+
+	for index, archiveName := range archiveNames {
+		exists, _ := afero.Exists(osPtr, "/logs/"+archiveName)
+		if exists != (index >= 2) {
+			t.Errorf("Expected archive '%s' to exist to be '%t'", archiveName, index >= 2)
+		}
+	}
+
+	if exists, _ := afero.Exists(osPtr, "/logs/unrelated.log"); !exists {
+		t.Errorf("Expected files that aren't archives of the log file to be kept")
+	}
+
+	fileBytes, _ := afero.ReadFile(osPtr, "/logs/app.log")
+	logLines := strings.Split(strings.TrimSuffix(string(fileBytes), "\n"), "\n")
+	if len(logLines) != 2 || !strings.Contains(logLines[0], "/logs/"+archiveNames[0]) || !strings.Contains(logLines[1], "/logs/"+archiveNames[1]) {
+		t.Errorf("Expected a line for each deleted archive, oldest first, but got %q", string(fileBytes))
+	}
+}
+
+func TestRetentionIsEnforcedAfterEachRotation(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, MaxFileSizeBytes: 100, CompressRotatedFiles: true, Retention: &RetentionPolicy{MaxArchives: 2}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	for index := 0; index < 20; index++ {
+		logger.Info("message " + strconv.Itoa(index))
+	}
+	logger.Shutdown()
+
+	logFiles, err := readLogFiles(logger.osHandle, "/logs", "app.log")
+	if err != nil {
+		t.Errorf("Failed to read log files because: '%s'", err.Error())
+		return
+	}
+
+	if len(logFiles) != 3 {
+		t.Errorf("Expected the log file and 2 archives but found %v", logFiles)
+	}
+
+	var allContents strings.Builder
+	for _, fileContents := range logFiles {
+		allContents.WriteString(fileContents)
+	}
+
+	if !strings.Contains(allContents.String(), "Deleted log archive") {
+		t.Errorf("Expected the deleted archives to be logged but found %v", logFiles)
+	}
+}
+
+func TestRetentionOnlyDeletesFilesNamedLikeArchives(t *testing.T) {
+	osPtr := afero.NewMemMapFs()
+	osPtr.MkdirAll("/logs/app.log.old", 0755)
+
+	var modTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, fileName := range []string{"app.log.20200101000000.gz", "app.log.20200102000000.1", "app.log.bak", "app.log.lock", "app.log.20200103000000"} {
+		afero.WriteFile(osPtr, "/logs/"+fileName, []byte("old\n"), 0644)
+		osPtr.Chtimes("/logs/"+fileName, modTime, modTime)
+		modTime = modTime.Add(24 * time.Hour)
+	}
+
+	formatter, _ := NewFormatter(FormatText)
+	fileSink, err := newFileSink("/logs/app.log", osPtr, formatter, fileSinkOptions{bufferSize: -1, retentionPolicy: &RetentionPolicy{MaxArchives: 1}})
+	if err != nil {
+		t.Errorf("Failed to create file sink because: '%s'", err.Error())
+		return
+	}
+	fileSink.Close()
+
+	for _, fileName := range []string{"app.log.20200101000000.gz", "app.log.20200102000000.1"} {
+		if _, err := osPtr.Stat("/logs/" + fileName); err == nil {
+			t.Errorf("Expected expired archive '%s' to be deleted but it was kept", fileName)
+		}
+	}
+
+	for _, fileName := range []string{"app.log.20200103000000", "app.log.bak", "app.log.lock", "app.log.old"} {
+		if _, err := osPtr.Stat("/logs/" + fileName); err != nil {
+			t.Errorf("Expected '%s' to be kept but it was deleted", fileName)
+		}
+	}
+}
+
+// removeFailingFs is an in-memory filesystem on which deleting files always fails
+type removeFailingFs struct {
+	afero.Fs
+}
+
+func (fs removeFailingFs) Remove(name string) error {
+	return errors.New("permission denied")
+}
+
+func TestArchivesThatCantBeDeletedAreReportedAsAWarning(t *testing.T) {
+	osPtr := removeFailingFs{afero.NewMemMapFs()}
+	afero.WriteFile(osPtr, "/logs/app.log.20200101000000", []byte("old\n"), 0644)
+	osPtr.Chtimes("/logs/app.log.20200101000000", time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour))
+
+	formatter, _ := NewFormatter(FormatText)
+	fileSink, err := newFileSink("/logs/app.log", osPtr, formatter, fileSinkOptions{bufferSize: -1, retentionPolicy: &RetentionPolicy{MaxAge: time.Hour}})
+	if err != nil {
+		t.Errorf("Expected an archive that can't be deleted to not fail the sink but got '%s'", err.Error())
+		return
+	}
+	fileSink.Close()
+
+	fileBytes, _ := afero.ReadFile(osPtr, "/logs/app.log")
+	if !strings.Contains(string(fileBytes), "WARNING: Could not delete log archive '/logs/app.log.20200101000000' to enforce the retention policy because: permission denied") {
+		t.Errorf("Expected the failed deletion to be logged as a warning but got %q", string(fileBytes))
+	}
+}
+
+func TestReopenContinuesInTheFileFoundAtTheLogFilePath(t *testing.T) {
+	for _, isAsynch := range []bool{false, true} {
+		// a level filter wraps the file sink, which must not hide it from 'Reopen'
+		logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, IsAsynch: isAsynch, FileLevels: LevelFilter{MinLevel: LevelInfo}}
+		logger, err := SetupLoggerFromStruct(&logConfig)
+		if err != nil {
+			t.Errorf("Failed to set up logger because: '%s'", err.Error())
+			return
+		}
+
+		logger.Info("before rotation")
+
+		// what logrotate does, before signaling the process
+		logger.Flush()
+		logger.osHandle.Rename("/logs/app.log", "/logs/app.log.1")
+
+		if err := logger.Reopen(); err != nil {
+			t.Errorf("Failed to reopen log files because: '%s'", err.Error())
+			return
+		}
+
+		logger.Info("after rotation")
+		logger.Shutdown()
+
+		oldBytes, _ := afero.ReadFile(logger.osHandle, "/logs/app.log.1")
+		newBytes, _ := afero.ReadFile(logger.osHandle, "/logs/app.log")
+		if !strings.HasSuffix(string(oldBytes), "INFO: before rotation\n") || strings.Count(string(oldBytes), "\n") != 1 {
+			t.Errorf("Expected the moved file to hold only the message logged before reopening but got %q", string(oldBytes))
+		}
+
+		if !strings.HasSuffix(string(newBytes), "INFO: after rotation\n") || strings.Count(string(newBytes), "\n") != 1 {
+			t.Errorf("Expected the new file to hold only the message logged after reopening but got %q", string(newBytes))
+		}
+	}
+}
+
+func TestReopenOnSIGHUPReopensTheLogFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not delivered on windows")
+	}
+
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, ReopenOnSIGHUP: true, FileBufferSize: -1}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.osHandle.Rename("/logs/app.log", "/logs/app.log.1")
+
+	process, _ := os.FindProcess(os.Getpid())
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Errorf("Failed to send SIGHUP because: '%s'", err.Error())
+		return
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if exists, _ := afero.Exists(logger.osHandle, "/logs/app.log"); exists {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Errorf("Expected the log file to be recreated after SIGHUP")
+}
+
+func TestDeletedLogFileIsRecreatedWithAWarning(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)}
+
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "app.log", IsMock: true, FileFlushInterval: -1, FileCheckInterval: time.Minute, Clock: clock.Now}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.Info("buffered before deletion")
+	logger.osHandle.Remove("/logs/app.log")
+
+	clock.Advance(time.Second)
+	logger.Info("before the check is due")
+	clock.Advance(time.Minute)
+	logger.Info("after the check")
+	logger.Shutdown()
+
+	fileBytes, err := afero.ReadFile(logger.osHandle, "/logs/app.log")
+	if err != nil {
+		t.Errorf("Expected the log file to be recreated but got error '%s'", err.Error())
+		return
+	}
+
+	logLines := strings.Split(strings.TrimSuffix(string(fileBytes), "\n"), "\n")
+	wantSuffixes := []string{"INFO: buffered before deletion", "INFO: before the check is due", "was deleted or moved while open, so logging continues in a new file at its path", "INFO: after the check"}
+	if len(logLines) != len(wantSuffixes) {
+		t.Errorf("Expected %d lines in the recreated log file but got %q", len(wantSuffixes), string(fileBytes))
+		return
+	}
+
+	for index, wantSuffix := range wantSuffixes {
+		if !strings.HasSuffix(logLines[index], wantSuffix) {
+			t.Errorf("Expected line %d to end with '%s' but got %q", index, wantSuffix, logLines[index])
+		}
+	}
+
+	if !strings.Contains(logLines[2], "WARNING: ") {
+		t.Errorf("Expected the recreation to be logged as a warning but got %q", logLines[2])
+	}
+}
+
+func TestLogFileReplacedOnDiskIsDetectedByIdentity(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "golog-identity")
+	if err != nil {
+		t.Errorf("Failed to create log directory because: '%s'", err.Error())
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+
+	clock := &fakeClock{now: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)}
+
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: logDirectory, LogFile: "app.log", FileBufferSize: -1, FileCheckInterval: time.Second, Clock: clock.Now}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.Info("first")
+
+	// what logrotate does in 'create' mode, without telling the process
+	os.Rename(logDirectory+"/app.log", logDirectory+"/app.log.1")
+	ioutil.WriteFile(logDirectory+"/app.log", nil, 0644)
+
+	clock.Advance(time.Second)
+	logger.Info("second")
+	logger.Shutdown()
+
+	oldBytes, _ := ioutil.ReadFile(logDirectory + "/app.log.1")
+	newBytes, _ := ioutil.ReadFile(logDirectory + "/app.log")
+	if strings.Count(string(oldBytes), "\n") != 1 || !strings.HasSuffix(string(newBytes), "INFO: second\n") || !strings.Contains(string(newBytes), "was deleted or moved") {
+		t.Errorf("Expected logging to continue in the replaced file but got %q and %q", string(oldBytes), string(newBytes))
+	}
+}
+
+func TestSyslogOverUDPWritesRFC5424MessagesWithStructuredData(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Could not listen on UDP because: '%s'", err.Error())
+	}
+	defer listener.Close()
+
+	clock := &fakeClock{now: time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)}
+	syslogConfig := SyslogConfig{Network: "udp", Address: listener.LocalAddr().String(), Facility: "local0", AppName: "golog-test", Hostname: "testhost"}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Syslog: &syslogConfig, Clock: clock.Now}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.SetContext("checkout")
+	logger.SetField("order id", `a"b]c`)
+	logger.Warning("payment declined")
+
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buffer := make([]byte, 2048)
+	size, _, err := listener.ReadFrom(buffer)
+	if err != nil {
+		t.Errorf("Failed to receive the syslog message because: '%s'", err.Error())
+		return
+	}
+
+	expected := "<132>1 2020-01-02T03:04:05.000000Z testhost golog-test " + strconv.Itoa(os.Getpid()) + ` checkout [fields@32473 order_id="a\"b\]c"] payment declined`
+	if string(buffer[:size]) != expected {
+		t.Errorf("Expected syslog message %q but got %q", expected, string(buffer[:size]))
+	}
+}
+
+func TestSyslogStructuredDataNamesAreNeverEmptyOrRepeated(t *testing.T) {
+	sink := &syslogSink{config: SyslogConfig{AppName: "golog-test", Hostname: "testhost", StructuredDataID: defaultSyslogStructuredDataID}, procID: "1"}
+	longKey := strings.Repeat("k", 40)
+	fields := []Field{{"user", "x"}, {"user", "y"}, {"", "anonymous"}, {longKey, "1"}, {longKey, "2"}}
+	record := Record{Time: time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC), Level: LevelInfo, Message: "login", Fields: fields}
+
+	message := sink.formatRFC5424(record, record.Message)
+
+	expected := `[fields@32473 user="x" user_2="y" field="anonymous" ` + strings.Repeat("k", 32) + `="1" ` + strings.Repeat("k", 30) + `_2="2"] login`
+	if !strings.HasSuffix(message, expected) {
+		t.Errorf("Expected structured data %q but got %q", expected, message)
+	}
+}
+
+// readOctetCountedFrame reads one 'LEN SP MSG' frame from 'reader'
+func readOctetCountedFrame(reader *bufio.Reader) (string, error) {
+	lengthText, err := reader.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSuffix(lengthText, " "))
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, length)
+	_, err = io.ReadFull(reader, message)
+	return string(message), err
+}
+
+func TestSyslogOverTCPFramesRFC3164MessagesAndReconnectsAfterTheDaemonRestarts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Could not listen on TCP because: '%s'", err.Error())
+	}
+	address := listener.Addr().String()
+
+	syslogConfig := SyslogConfig{Network: "tcp", Address: address, Protocol: SyslogRFC3164, AppName: "golog-test", Hostname: "testhost", OctetCounting: true}
+	sink, err := NewSyslogSink(syslogConfig)
+	if err != nil {
+		listener.Close()
+		t.Errorf("Failed to create syslog sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		listener.Close()
+		t.Errorf("Failed to accept the syslog connection because: '%s'", err.Error())
+		return
+	}
+
+	recordTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	sink.Write(Record{Time: recordTime, Level: LevelErr, Message: "line one\nline two", Fields: []Field{{"user", "bob smith"}}})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	message, err := readOctetCountedFrame(bufio.NewReader(conn))
+	if err != nil {
+		t.Errorf("Failed to receive the syslog message because: '%s'", err.Error())
+	}
+
+	expected := "<11>Jan  2 03:04:05 testhost golog_test[" + strconv.Itoa(os.Getpid()) + `]: line one` + "\n" + `line two user="bob smith"`
+	if message != expected {
+		t.Errorf("Expected syslog message %q but got %q", expected, message)
+	}
+
+	// restart the daemon on the same address
+	conn.Close()
+	listener.Close()
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("Could not listen on '%s' again because: '%s'", address, err.Error())
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		message, _ := readOctetCountedFrame(bufio.NewReader(conn))
+		received <- message
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		sink.Write(Record{Time: recordTime, Level: LevelInfo, Message: "after restart"})
+
+		select {
+		case message := <-received:
+			if !strings.HasSuffix(message, "]: after restart") {
+				t.Errorf("Expected the restarted daemon to receive 'after restart' but got %q", message)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	t.Errorf("Expected the sink to reconnect to the restarted daemon")
+}
+
+func TestSyslogOverTCPDoesNotBlockLoggingWhenTheDaemonStopsReading(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Could not listen on TCP because: '%s'", err.Error())
+	}
+	defer listener.Close()
+
+	// the daemon accepts the connection but never reads from it, so the socket buffers fill up
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	sink, err := NewSyslogSink(SyslogConfig{Network: "tcp", Address: listener.Addr().String(), WriteTimeout: 50 * time.Millisecond, FlushTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Errorf("Failed to create syslog sink because: '%s'", err.Error())
+		return
+	}
+
+	start := time.Now()
+	record := Record{Time: time.Now(), Level: LevelInfo, Message: strings.Repeat("x", 16*1024)}
+	for index := 0; index < 1000; index++ {
+		sink.Write(record)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected writing to a stalled daemon to not block but 1000 records took %v", elapsed)
+	}
+
+	sink.Close()
+	if conn := <-accepted; conn != nil {
+		conn.Close()
+	}
+}
+
+func TestSetupRejectsInvalidSyslogSettings(t *testing.T) {
+	var badConfigs = []SyslogConfig{
+		{Network: "udp", Address: "127.0.0.1:514", Facility: "nonsense"},
+		{Network: "carrier-pigeon", Address: "127.0.0.1:514"},
+		{Network: "udp", Address: "127.0.0.1:514", Protocol: 3},
+		{Network: "udp", Address: "127.0.0.1:514", Levels: LevelFilter{MinLevel: "LOUD"}},
+	}
+
+	for _, syslogConfig := range badConfigs {
+		syslogConfig := syslogConfig
+		logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Syslog: &syslogConfig}
+		if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+			t.Errorf("Expected syslog config %+v to be rejected but it was accepted", syslogConfig)
+		}
+	}
+}
+
+// listenTCP returns a TCP listener on a free local port, skipping the test if there is none
+func listenTCP(t *testing.T, address string) net.Listener {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("Could not listen on TCP because: '%s'", err.Error())
+	}
+
+	return listener
+}
+
+// acceptLines accepts connections on 'listener' and sends every line received on them to the returned channel
+func acceptLines(listener net.Listener) chan string {
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	return lines
+}
+
+// receiveLine returns the next line sent to 'lines', or fails the test if none arrives in time
+func receiveLine(t *testing.T, lines chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a line to be received but none arrived")
+	}
+
+	return ""
+}
+
+func TestNetworkOutputShipsNewlineFramedJSONOverTCP(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	defer listener.Close()
+	lines := acceptLines(listener)
+
+	networkConfig := NetworkConfig{Network: "tcp", Address: listener.Addr().String(), Levels: LevelFilter{MinLevel: LevelInfo}}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Network: &networkConfig}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.Debug("filtered out")
+	logger.Info("first\nmessage")
+	logger.Warning("second message")
+	logger.Flush()
+
+	for _, expectedMessage := range []string{"first\nmessage", "second message"} {
+		var decoded map[string]interface{}
+		line := receiveLine(t, lines)
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil || decoded["message"] != expectedMessage {
+			t.Errorf("Expected a JSON record with message %q but got %q", expectedMessage, line)
+		}
+	}
+
+	if counters := logger.DeliveryCounters(); counters.Delivered != 2 || counters.Dropped != 0 || counters.Buffered != 0 {
+		t.Errorf("Expected 2 delivered records and none dropped or buffered but got %+v", counters)
+	}
+}
+
+func TestNetworkOutputBuffersWhileTheCollectorIsDownAndReconnects(t *testing.T) {
+	// find a free port, then leave it closed until the collector comes up
+	listener := listenTCP(t, "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	networkConfig := NetworkConfig{Network: "tcp", Address: address, Format: FormatText, Framing: FramingLengthPrefix, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	sink, err := NewNetworkSink(networkConfig)
+	if err != nil {
+		t.Errorf("Failed to create network sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	sink.Write(Record{Level: LevelInfo, Message: "while down 1"})
+	sink.Write(Record{Level: LevelInfo, Message: "while down 2"})
+
+	time.Sleep(50 * time.Millisecond)
+	counters := sink.(DeliveryCounter).DeliveryCounters()
+	if counters.Retries == 0 || counters.Buffered != 2 {
+		t.Errorf("Expected retries and 2 buffered records while the collector is down but got %+v", counters)
+	}
+
+	listener = listenTCP(t, address)
+	defer listener.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Errorf("Failed to accept the connection because: '%s'", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for _, expectedMessage := range []string{"while down 1", "while down 2"} {
+		var length [4]byte
+		io.ReadFull(reader, length[:])
+		frame := make([]byte, binary.BigEndian.Uint32(length[:]))
+		io.ReadFull(reader, frame)
+
+		if !strings.HasSuffix(string(frame), "INFO: "+expectedMessage) {
+			t.Errorf("Expected a frame ending in %q but got %q", "INFO: "+expectedMessage, string(frame))
+		}
+	}
+}
+
+// spoolSegmentSizes returns the sizes of the segment files in 'directory' on 'osPtr'
+func spoolSegmentSizes(osPtr afero.Fs, directory string) []int64 {
+	fileInfos, _ := afero.ReadDir(osPtr, directory)
+
+	var sizes []int64
+	for _, fileInfo := range fileInfos {
+		if strings.HasSuffix(fileInfo.Name(), ".spool") {
+			sizes = append(sizes, fileInfo.Size())
+		}
+	}
+
+	return sizes
+}
+
+func TestNetworkOutputSpillsToTheSpoolWhileTheCollectorIsDownAndReplaysItInOrderAfterARestart(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	osPtr := afero.NewMemMapFs()
+	networkConfig := NetworkConfig{Network: "tcp", Address: address, Format: FormatText, MaxBufferedRecords: 2, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, FlushTimeout: 50 * time.Millisecond, Spool: &SpoolConfig{Directory: "/spool", SegmentBytes: 100}}
+	sink, err := newNetworkSink(networkConfig, osPtr)
+	if err != nil {
+		t.Errorf("Failed to create network sink because: '%s'", err.Error())
+		return
+	}
+
+	for index := 0; index < 10; index++ {
+		sink.Write(Record{Level: LevelInfo, Message: "record " + strconv.Itoa(index)})
+	}
+
+	// spilled records are written to the spool by the delivery goroutine, flushing gives it time to
+	sink.Flush()
+	if counters := sink.(DeliveryCounter).DeliveryCounters(); counters.Buffered != 2 || counters.Spooled != 8 || counters.Dropped != 0 {
+		t.Errorf("Expected 2 records in memory and 8 spooled while the collector is down but got %+v", counters)
+	}
+
+	// the records still in memory are put in front of the spool, so none is lost by the restart
+	sink.Close()
+	if counters := sink.(DeliveryCounter).DeliveryCounters(); counters.Spooled != 10 || counters.Dropped != 0 {
+		t.Errorf("Expected every record to be spooled once the sink closed but got %+v", counters)
+	}
+
+	if segments := spoolSegmentSizes(osPtr, "/spool"); len(segments) < 2 {
+		t.Errorf("Expected the spool to be split into several segments but got %v", segments)
+	}
+
+	listener = listenTCP(t, address)
+	defer listener.Close()
+	lines := acceptLines(listener)
+
+	sink, err = newNetworkSink(networkConfig, osPtr)
+	if err != nil {
+		t.Errorf("Failed to create network sink after the restart because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	for index := 0; index < 10; index++ {
+		if line := receiveLine(t, lines); !strings.HasSuffix(line, "INFO: record "+strconv.Itoa(index)) {
+			t.Errorf("Expected record %d to be replayed in order but got %q", index, line)
+		}
+	}
+
+	sink.Flush()
+	if segments := spoolSegmentSizes(osPtr, "/spool"); len(segments) != 0 {
+		t.Errorf("Expected the replayed segments to be deleted but found %v", segments)
+	}
+}
+
+func TestSpoolDeletesTheOldestSegmentsToStayUnderItsCap(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	osPtr := afero.NewMemMapFs()
+	networkConfig := NetworkConfig{Network: "tcp", Address: address, Format: FormatText, MaxBufferedRecords: 1, MinBackoff: time.Hour, FlushTimeout: time.Millisecond, Spool: &SpoolConfig{Directory: "/spool", MaxBytes: 300, SegmentBytes: 100}}
+	sink, err := newNetworkSink(networkConfig, osPtr)
+	if err != nil {
+		t.Errorf("Failed to create network sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	for index := 0; index < 50; index++ {
+		sink.Write(Record{Level: LevelInfo, Message: "record " + strconv.Itoa(index)})
+	}
+
+	var spoolBytes int64
+	for _, size := range spoolSegmentSizes(osPtr, "/spool") {
+		spoolBytes += size
+	}
+
+	counters := sink.(DeliveryCounter).DeliveryCounters()
+	if spoolBytes > 300 || counters.Dropped == 0 || uint64(counters.Buffered+counters.Spooled)+counters.Dropped != 50 {
+		t.Errorf("Expected the spool to stay under 300 bytes by dropping records but it holds %d bytes with counters %+v", spoolBytes, counters)
+	}
+}
+
+func TestSpoolKeepsASegmentOnDiskUntilItsRecordsAreDelivered(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	osPtr := afero.NewMemMapFs()
+	networkConfig := NetworkConfig{Network: "tcp", Address: address, Format: FormatText, MaxBufferedRecords: 5, MinBackoff: time.Hour, FlushTimeout: 50 * time.Millisecond, Spool: &SpoolConfig{Directory: "/spool"}}
+	sink, err := newNetworkSink(networkConfig, osPtr)
+	if err != nil {
+		t.Errorf("Failed to create network sink because: '%s'", err.Error())
+		return
+	}
+
+	for index := 0; index < 3; index++ {
+		sink.Write(Record{Level: LevelInfo, Message: "record " + strconv.Itoa(index)})
+	}
+	sink.Close()
+
+	// the segment is read back while the collector is still down, and its records keep failing to be delivered
+	crashedSink, err := newNetworkSink(networkConfig, osPtr)
+	if err != nil {
+		t.Errorf("Failed to create network sink after the restart because: '%s'", err.Error())
+		return
+	}
+	defer crashedSink.Close()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if counters := crashedSink.(DeliveryCounter).DeliveryCounters(); counters.Retries > 0 {
+			break
+		}
+	}
+
+	if counters := crashedSink.(DeliveryCounter).DeliveryCounters(); counters.Buffered != 3 || counters.Spooled != 0 {
+		t.Errorf("Expected the spooled records to be read back into memory but got %+v", counters)
+	}
+
+	if segments := spoolSegmentSizes(osPtr, "/spool"); len(segments) != 1 {
+		t.Errorf("Expected the segment being replayed to stay on disk but found %v", segments)
+	}
+
+	// a run that never got to deliver them, as if it crashed, leaves them for the next one
+	listener = listenTCP(t, address)
+	defer listener.Close()
+	lines := acceptLines(listener)
+
+	sink, err = newNetworkSink(networkConfig, osPtr)
+	if err != nil {
+		t.Errorf("Failed to create network sink after the crash because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	for index := 0; index < 3; index++ {
+		if line := receiveLine(t, lines); !strings.HasSuffix(line, "INFO: record "+strconv.Itoa(index)) {
+			t.Errorf("Expected record %d to be replayed in order but got %q", index, line)
+		}
+	}
+
+	sink.Flush()
+	if segments := spoolSegmentSizes(osPtr, "/spool"); len(segments) != 0 {
+		t.Errorf("Expected the segment to be deleted once its records were delivered but found %v", segments)
+	}
+}
+
+// slowFs is a filesystem taking 'delay' to open every file
+type slowFs struct {
+	afero.Fs
+	delay time.Duration
+}
+
+func (fs slowFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	time.Sleep(fs.delay)
+	return fs.Fs.OpenFile(name, flag, perm)
+}
+
+func TestLoggingDoesNotWaitForTheSpoolToBeWritten(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	osPtr := slowFs{afero.NewMemMapFs(), 100 * time.Millisecond}
+	networkConfig := NetworkConfig{Network: "tcp", Address: address, Format: FormatText, MaxBufferedRecords: 1, MinBackoff: time.Hour, FlushTimeout: time.Second, Spool: &SpoolConfig{Directory: "/spool", SegmentBytes: 30}}
+	sink, err := newNetworkSink(networkConfig, osPtr)
+	if err != nil {
+		t.Errorf("Failed to create network sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	// every record starts a segment of its own, so each one opens a file
+	start := time.Now()
+	for index := 0; index < 10; index++ {
+		sink.Write(Record{Level: LevelInfo, Message: "record " + strconv.Itoa(index)})
+	}
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected logging not to wait for the spool but it took %s", elapsed)
+	}
+
+	sink.Close()
+	if counters := sink.(DeliveryCounter).DeliveryCounters(); counters.Spooled != 10 || counters.Dropped != 0 {
+		t.Errorf("Expected every record to be spooled once the sink closed but got %+v", counters)
+	}
+}
+
+func TestNetworkOutputNeverBlocksAndDropsTheOldestRecordsWhenFull(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	networkConfig := NetworkConfig{Network: "tcp", Address: address, MaxBufferedRecords: 5, MinBackoff: time.Hour, FlushTimeout: 50 * time.Millisecond}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Network: &networkConfig}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	start := time.Now()
+	for index := 0; index < 20; index++ {
+		logger.Info("record " + strconv.Itoa(index))
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected logging to a dead collector not to block but it took %s", elapsed)
+	}
+
+	// the first record may already be in flight
+	counters := logger.DeliveryCounters()
+	if counters.Buffered != 5 && counters.Buffered != 6 || counters.Dropped+uint64(counters.Buffered) != 20 {
+		t.Errorf("Expected 5 buffered records and the rest dropped but got %+v", counters)
+	}
+
+	logger.Shutdown()
+
+	if counters = logger.DeliveryCounters(); counters.Dropped != 20 || counters.Buffered != 0 {
+		t.Errorf("Expected every record to be dropped once shut down but got %+v", counters)
+	}
+}
+
+func TestNetworkOutputSendsOneDatagramPerRecordOverUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Could not listen on UDP because: '%s'", err.Error())
+	}
+	defer listener.Close()
+
+	sink, err := NewNetworkSink(NetworkConfig{Network: "udp", Address: listener.LocalAddr().String(), Format: FormatText})
+	if err != nil {
+		t.Errorf("Failed to create network sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	sink.Write(Record{Level: LevelErr, Message: "first"})
+	sink.Write(Record{Level: LevelErr, Message: "second"})
+
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buffer := make([]byte, 2048)
+	for _, expectedMessage := range []string{"first", "second"} {
+		size, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			t.Errorf("Failed to receive a datagram because: '%s'", err.Error())
+			return
+		}
+
+		if !strings.HasSuffix(string(buffer[:size]), "ERROR: "+expectedMessage) {
+			t.Errorf("Expected a datagram ending in %q but got %q", "ERROR: "+expectedMessage, string(buffer[:size]))
+		}
+	}
+}
+
+// selfSignedCertificate returns a certificate for '127.0.0.1' and a pool trusting it
+func selfSignedCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a key because: '%s'", err.Error())
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "golog test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	certificateBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create a certificate because: '%s'", err.Error())
+	}
+
+	certificate, _ := x509.ParseCertificate(certificateBytes)
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+
+	return tls.Certificate{Certificate: [][]byte{certificateBytes}, PrivateKey: key}, pool
+}
+
+func TestNetworkOutputShipsOverTLS(t *testing.T) {
+	certificate, pool := selfSignedCertificate(t)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Skipf("Could not listen on TCP because: '%s'", err.Error())
+	}
+	defer listener.Close()
+	lines := acceptLines(listener)
+
+	sink, err := NewNetworkSink(NetworkConfig{Network: "tcp", Address: listener.Addr().String(), UseTLS: true, TLSConfig: &tls.Config{RootCAs: pool}, Format: FormatText})
+	if err != nil {
+		t.Errorf("Failed to create network sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	sink.Write(Record{Level: LevelInfo, Message: "over tls"})
+	sink.Flush()
+
+	if line := receiveLine(t, lines); !strings.HasSuffix(line, "INFO: over tls") {
+		t.Errorf("Expected a line ending in 'INFO: over tls' but got %q", line)
+	}
+}
+
+func TestSetupRejectsInvalidNetworkSettings(t *testing.T) {
+	var badConfigs = []NetworkConfig{
+		{Network: "sctp", Address: "127.0.0.1:9000"},
+		{Network: "udp", Address: "127.0.0.1:9000", UseTLS: true},
+		{Network: "tcp", Address: "no port"},
+		{Network: "tcp", Address: "127.0.0.1:9000", Format: FormatBinary},
+		{Network: "tcp", Address: "127.0.0.1:9000", Framing: 3},
+		{Network: "tcp", Address: "127.0.0.1:9000", Levels: LevelFilter{MinLevel: "LOUD"}},
+		{Network: "tcp", Address: "127.0.0.1:9000", Spool: &SpoolConfig{}},
+		{Network: "tcp", Address: "127.0.0.1:9000", Spool: &SpoolConfig{Directory: "/spool", MaxBytes: -1}},
+	}
+
+	for _, networkConfig := range badConfigs {
+		networkConfig := networkConfig
+		logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Network: &networkConfig}
+		if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+			t.Errorf("Expected network config %+v to be rejected but it was accepted", networkConfig)
+		}
+	}
+}
+
+// recordingServer is an 'httptest.Server' recording the requests it receives and answering them with queued statuses
+type recordingServer struct {
+	*httptest.Server
+	mux       sync.Mutex
+	requests  []*http.Request // The requests received
+	bodies    []string        // The decompressed bodies of the requests received
+	times     []time.Time     // The times the requests were received at
+	responses []func(http.ResponseWriter)
+}
+
+// newRecordingServer starts a server answering requests with 'responses' in order, and with '200 OK' once they ran out
+func newRecordingServer(responses ...func(http.ResponseWriter)) *recordingServer {
+	server := &recordingServer{responses: responses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var reader io.Reader = request.Body
+		if request.Header.Get("Content-Encoding") == "gzip" {
+			reader, _ = gzip.NewReader(request.Body)
+		}
+		body, _ := ioutil.ReadAll(reader)
+
+		server.mux.Lock()
+		server.requests = append(server.requests, request)
+		server.bodies = append(server.bodies, string(body))
+		server.times = append(server.times, time.Now())
+		var respond func(http.ResponseWriter)
+		if len(server.responses) > 0 {
+			respond = server.responses[0]
+			server.responses = server.responses[1:]
+		}
+		server.mux.Unlock()
+
+		if respond != nil {
+			respond(writer)
+		}
+	}))
+
+	return server
+}
+
+// received returns the bodies received so far
+func (server *recordingServer) received() []string {
+	server.mux.Lock()
+	defer server.mux.Unlock()
+
+	return append([]string(nil), server.bodies...)
+}
+
+// respondWith returns a response writing 'status' with the header 'Retry-After' set to 'retryAfter', if not empty
+func respondWith(status int, retryAfter string) func(http.ResponseWriter) {
+	return func(writer http.ResponseWriter) {
+		if retryAfter != "" {
+			writer.Header().Set("Retry-After", retryAfter)
+		}
+		writer.WriteHeader(status)
+	}
+}
+
+func TestHTTPOutputPostsFullBatchesAsGzippedNDJSONWithHeaders(t *testing.T) {
+	server := newRecordingServer()
+	defer server.Close()
+
+	httpConfig := HTTPConfig{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}, Gzip: true, MaxBatchRecords: 2, BatchInterval: time.Hour}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, HTTP: &httpConfig}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	for index := 1; index <= 5; index++ {
+		logger.Info("record " + strconv.Itoa(index))
+	}
+
+	// full batches go out right away, the partial one waits for the flush
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	logger.Flush()
+
+	bodies := server.received()
+	if len(bodies) != 3 {
+		t.Errorf("Expected 3 requests but got %d: %q", len(bodies), bodies)
+		return
+	}
+
+	for index, body := range bodies {
+		if lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n"); len(lines) != 2 && index < 2 || len(lines) != 1 && index == 2 {
+			t.Errorf("Expected batches of 2, 2 and 1 records but request %d held %q", index+1, body)
+		}
+	}
+
+	if !strings.Contains(bodies[2], `"message":"record 5"`) {
+		t.Errorf("Expected the last batch to hold 'record 5' but got %q", bodies[2])
+	}
+
+	request := server.requests[0]
+	if request.Header.Get("Content-Type") != "application/x-ndjson" || request.Header.Get("Authorization") != "Bearer token" || request.Method != http.MethodPost {
+		t.Errorf("Expected an NDJSON POST with the configured headers but got %s with %v", request.Method, request.Header)
+	}
+}
+
+func TestHTTPOutputRetriesServerErrorsHonoringRetryAfterAndDropsRejectedBatches(t *testing.T) {
+	server := newRecordingServer(respondWith(http.StatusServiceUnavailable, ""), respondWith(http.StatusTooManyRequests, "1"), respondWith(http.StatusOK, ""), respondWith(http.StatusBadRequest, ""))
+	defer server.Close()
+
+	sink, err := NewHTTPSink(HTTPConfig{URL: server.URL, Encoding: BatchJSONArray, MinBackoff: 10 * time.Millisecond, FlushTimeout: 5 * time.Second})
+	if err != nil {
+		t.Errorf("Failed to create HTTP sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	sink.Write(Record{Level: LevelInfo, Message: "retried"})
+	sink.Flush()
+
+	sink.Write(Record{Level: LevelInfo, Message: "rejected"})
+	sink.Flush()
+
+	bodies := server.received()
+	if len(bodies) != 4 || bodies[0] != bodies[2] || !strings.HasPrefix(bodies[2], `[{`) || !strings.Contains(bodies[3], `"message":"rejected"`) {
+		t.Errorf("Expected the first batch to be posted 3 times as a JSON array, then the second once, but got %q", bodies)
+		return
+	}
+
+	if waited := server.times[2].Sub(server.times[1]); waited < time.Second {
+		t.Errorf("Expected the retry to wait the second 'Retry-After' asked for but it waited %s", waited)
+	}
+
+	if counters := sink.(DeliveryCounter).DeliveryCounters(); counters.Delivered != 1 || counters.Dropped != 1 || counters.Retries != 2 {
+		t.Errorf("Expected 1 delivered, 1 dropped and 2 retries but got %+v", counters)
+	}
+}
+
+func TestHTTPOutputPostsBufferedRecordsOnShutdown(t *testing.T) {
+	server := newRecordingServer()
+	defer server.Close()
+
+	httpConfig := HTTPConfig{URL: server.URL, BatchInterval: time.Hour}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, IsAsynch: true, HTTP: &httpConfig}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.Info("first")
+	logger.Info("second")
+	logger.Shutdown()
+
+	bodies := server.received()
+	if len(bodies) != 1 || strings.Count(bodies[0], "\n") != 2 {
+		t.Errorf("Expected both records in a single request by the time 'Shutdown' returned but got %q", bodies)
+	}
+}
+
+func TestParseRetryAfterAcceptsSecondsAndDates(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var expectedDelays = map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 01 Jan 2020 00:00:30 GMT": 30 * time.Second,
+		"Tue, 31 Dec 2019 00:00:00 GMT": 0,
+	}
+
+	for value, expectedDelay := range expectedDelays {
+		if delay := parseRetryAfter(value, now); delay != expectedDelay {
+			t.Errorf("Expected 'Retry-After: %s' to ask for %s but got %s", value, expectedDelay, delay)
+		}
+	}
+}
+
+func TestSetupRejectsInvalidHTTPSettings(t *testing.T) {
+	var badConfigs = []HTTPConfig{
+		{URL: "ftp://example.com/logs"},
+		{URL: "not a url"},
+		{URL: "https://example.com/logs", Format: FormatText},
+		{URL: "https://example.com/logs", Encoding: 3},
+		{URL: "https://example.com/logs", Levels: LevelFilter{MinLevel: "LOUD"}},
+	}
+
+	for _, httpConfig := range badConfigs {
+		httpConfig := httpConfig
+		logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, HTTP: &httpConfig}
+		if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+			t.Errorf("Expected HTTP config %+v to be rejected but it was accepted", httpConfig)
+		}
+	}
+}
+
+// lokiPush is the body of a Loki push request
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][]string        `json:"values"`
+	} `json:"streams"`
+}
+
+func TestLokiOutputPushesStreamsGroupedByLabelsWithNanosecondTimestamps(t *testing.T) {
+	server := newRecordingServer()
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Date(2020, time.January, 2, 3, 4, 5, 123456789, time.UTC)}
+	lokiConfig := LokiConfig{URL: server.URL, Labels: map[string]string{"app": "checkout", "env": "prod"}, LabelFields: []string{"level", "context", "region"}, Format: FormatText, Headers: map[string]string{"X-Scope-OrgID": "tenant"}, BatchInterval: time.Hour}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Clock: clock.Now, Loki: &lokiConfig}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.Info("first info")
+	logger.Warning("a warning")
+	logger.SetContext("payments")
+	logger.SetField("region", "eu")
+	logger.Info("second info")
+	logger.Info("third info")
+	logger.Flush()
+
+	bodies := server.received()
+	if len(bodies) != 1 {
+		t.Errorf("Expected a single push but got %d: %q", len(bodies), bodies)
+		return
+	}
+
+	if server.requests[0].URL.Path != "/loki/api/v1/push" || server.requests[0].Header.Get("X-Scope-OrgID") != "tenant" {
+		t.Errorf("Expected a push to '/loki/api/v1/push' with the tenant header but got '%s' with %v", server.requests[0].URL.Path, server.requests[0].Header)
+	}
+
+	var push lokiPush
+	if err := json.Unmarshal([]byte(bodies[0]), &push); err != nil || len(push.Streams) != 3 {
+		t.Errorf("Expected 3 streams but got %q", bodies[0])
+		return
+	}
+
+	var expectedLabels = []map[string]string{
+		{"app": "checkout", "env": "prod", "level": "info"},
+		{"app": "checkout", "env": "prod", "level": "warning"},
+		{"app": "checkout", "env": "prod", "level": "info", "context": "payments", "region": "eu"},
+	}
+	var expectedCounts = []int{1, 1, 2}
+
+	for index, stream := range push.Streams {
+		if !reflect.DeepEqual(stream.Stream, expectedLabels[index]) || len(stream.Values) != expectedCounts[index] {
+			t.Errorf("Expected stream %d to have labels %v and %d values but got %v and %v", index, expectedLabels[index], expectedCounts[index], stream.Stream, stream.Values)
+			continue
+		}
+
+		if stream.Values[0][0] != "1577934245123456789" {
+			t.Errorf("Expected the timestamp in nanoseconds '1577934245123456789' but got '%s'", stream.Values[0][0])
+		}
+	}
+
+	if values := push.Streams[2].Values; !strings.HasSuffix(values[0][1], "second info") || !strings.HasSuffix(values[1][1], "third info") {
+		t.Errorf("Expected the entries of a stream to keep their order but got %v", values)
+	}
+}
+
+func TestSetupRejectsInvalidLokiSettings(t *testing.T) {
+	var badConfigs = []LokiConfig{
+		{URL: "loki:3100"},
+		{URL: "http://loki:3100", Format: FormatBinary},
+		{URL: "http://loki:3100", Levels: LevelFilter{MinLevel: "LOUD"}},
+		{URL: "http://loki:3100", Labels: map[string]string{"": "checkout"}},
+		{URL: "http://loki:3100", LabelFields: []string{"level", ""}},
+	}
+
+	for _, lokiConfig := range badConfigs {
+		lokiConfig := lokiConfig
+		logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Loki: &lokiConfig}
+		if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+			t.Errorf("Expected Loki config %+v to be rejected but it was accepted", lokiConfig)
+		}
+	}
+}
+
+// respondWithBody returns a response writing 'status' and the JSON 'body'
+func respondWithBody(status int, body string) func(http.ResponseWriter) {
+	return func(writer http.ResponseWriter) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(status)
+		io.WriteString(writer, body)
+	}
+}
+
+func TestElasticsearchOutputIndexesIntoDatedIndicesAndRetriesOnlyFailedDocuments(t *testing.T) {
+	bulkResponse := `{"errors":true,"items":[` +
+		`{"create":{"status":201}},` +
+		`{"create":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}},` +
+		`{"create":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`
+	server := newRecordingServer(respondWithBody(http.StatusOK, bulkResponse), respondWithBody(http.StatusOK, `{"errors":false,"items":[{"create":{"status":201}}]}`))
+	defer server.Close()
+
+	sink, err := NewElasticsearchSink(ElasticsearchConfig{URL: server.URL, MinBackoff: 10 * time.Millisecond, BatchInterval: time.Hour})
+	if err != nil {
+		t.Errorf("Failed to create Elasticsearch sink because: '%s'", err.Error())
+		return
+	}
+	defer sink.Close()
+
+	// the index is picked from the UTC time of each record, so this record belongs to the first of January
+	eastOfUTC := time.FixedZone("UTC+2", 2*60*60)
+	sink.Write(Record{Time: time.Date(2020, time.January, 2, 1, 0, 0, 0, eastOfUTC), Level: LevelInfo, Message: "indexed"})
+	sink.Write(Record{Time: time.Date(2020, time.January, 2, 3, 0, 0, 0, time.UTC), Level: LevelInfo, Message: "retried"})
+	sink.Write(Record{Time: time.Date(2020, time.January, 2, 4, 0, 0, 0, time.UTC), Level: LevelInfo, Message: "rejected"})
+	sink.Flush()
+
+	bodies := server.received()
+	if len(bodies) != 2 {
+		t.Errorf("Expected the bulk request and one retry but got %q", bodies)
+		return
+	}
+
+	if server.requests[0].URL.Path != "/_bulk" || server.requests[0].Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON posted to '/_bulk' but got '%s' with %v", server.requests[0].URL.Path, server.requests[0].Header)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")
+	var expectedActions = []string{
+		`{"create":{"_index":"logs-2020.01.01"}}`,
+		`{"create":{"_index":"logs-2020.01.02"}}`,
+		`{"create":{"_index":"logs-2020.01.02"}}`,
+	}
+	if len(lines) != 6 {
+		t.Errorf("Expected an action and a document for each of the 3 records but got %q", bodies[0])
+		return
+	}
+
+	for index, expectedAction := range expectedActions {
+		if lines[index*2] != expectedAction || !json.Valid([]byte(lines[index*2+1])) {
+			t.Errorf("Expected the action '%s' followed by a JSON document but got '%s' and '%s'", expectedAction, lines[index*2], lines[index*2+1])
+		}
+	}
+
+	if bodies[1] != lines[2]+"\n"+lines[3]+"\n" {
+		t.Errorf("Expected only the document failing with 429 to be sent again but got %q", bodies[1])
+	}
+
+	if counters := sink.(DeliveryCounter).DeliveryCounters(); counters.Delivered != 2 || counters.Dropped != 1 || counters.Rejected != 1 || counters.Retries != 1 {
+		t.Errorf("Expected 2 delivered, 1 dropped and rejected, and 1 retry but got %+v", counters)
+	}
+}
+
+func TestSetupRejectsInvalidElasticsearchSettings(t *testing.T) {
+	var badConfigs = []ElasticsearchConfig{
+		{URL: "localhost:9200"},
+		{URL: "http://localhost:9200", Index: "Logs-2006.01.02"},
+		{URL: "http://localhost:9200", Index: "logs 2006"},
+		{URL: "http://localhost:9200", Format: FormatText},
+		{URL: "http://localhost:9200", Levels: LevelFilter{MinLevel: "LOUD"}},
+	}
+
+	for _, elasticsearchConfig := range badConfigs {
+		elasticsearchConfig := elasticsearchConfig
+		logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Elasticsearch: &elasticsearchConfig}
+		if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+			t.Errorf("Expected Elasticsearch config %+v to be rejected but it was accepted", elasticsearchConfig)
+		}
+	}
+}
+
+// decodeMsgpack reads a MessagePack value from 'reader'. Integers are returned as int64, strings as string, binary data
+// as []byte, arrays as []interface{}, maps as map[string]interface{} and EventTimes as time.Time
+func decodeMsgpack(reader *bufio.Reader) (interface{}, error) {
+	code, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	readBytes := func(length int) ([]byte, error) {
+		bytes := make([]byte, length)
+		_, err := io.ReadFull(reader, bytes)
+		return bytes, err
+	}
+
+	readBigEndian := func(size int) (uint64, error) {
+		bytes, err := readBytes(size)
+		var value uint64
+		for _, b := range bytes {
+			value = value<<8 | uint64(b)
+		}
+		return value, err
+	}
+
+	readArray := func(length int) (interface{}, error) {
+		array := make([]interface{}, length)
+		for index := range array {
+			if array[index], err = decodeMsgpack(reader); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+
+	readMap := func(length int) (interface{}, error) {
+		entries := make(map[string]interface{}, length)
+		for index := 0; index < length; index++ {
+			key, err := decodeMsgpack(reader)
+			if err != nil {
+				return nil, err
+			}
+			if entries[key.(string)], err = decodeMsgpack(reader); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+
+	readSized := func(size int, read func(length int) (interface{}, error)) (interface{}, error) {
+		length, err := readBigEndian(size)
+		if err != nil {
+			return nil, err
+		}
+		return read(int(length))
+	}
+
+	readString := func(length int) (interface{}, error) {
+		bytes, err := readBytes(length)
+		return string(bytes), err
+	}
+
+	readBinary := func(length int) (interface{}, error) {
+		return readBytes(length)
+	}
+
+	switch {
+	case code < 0x80:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return readMap(int(code & 0x0f))
+	case code&0xf0 == 0x90:
+		return readArray(int(code & 0x0f))
+	case code&0xe0 == 0xa0:
+		return readString(int(code & 0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		return readSized(1<<(code-0xc4), readBinary)
+	case 0xca:
+		bits, err := readBigEndian(4)
+		return math.Float32frombits(uint32(bits)), err
+	case 0xcb:
+		bits, err := readBigEndian(8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		value, err := readBigEndian(1 << (code - 0xcc))
+		return int64(value), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		value, err := readBigEndian(size)
+		shift := uint(64 - 8*size)
+		return int64(value<<shift) >> shift, err
+	case 0xd7:
+		bytes, err := readBytes(9)
+		if err != nil || bytes[0] != 0 {
+			return nil, errors.New("expected an EventTime")
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(bytes[1:5])), int64(binary.BigEndian.Uint32(bytes[5:9]))), nil
+	case 0xd9, 0xda, 0xdb:
+		return readSized(1<<(code-0xd9), readString)
+	case 0xdc, 0xdd:
+		return readSized(2<<(code-0xdc), readArray)
+	case 0xde, 0xdf:
+		return readSized(2<<(code-0xde), readMap)
+	}
+
+	return nil, errors.New("unexpected MessagePack type " + strconv.Itoa(int(code)))
+}
+
+func TestMsgpackValuesDecodeToWhatWasEncoded(t *testing.T) {
+	var values = []interface{}{
+		nil, true, false, 0, 127, 128, 255, 256, 65535, 65536, uint64(1) << 40, -1, -32, -33, -128, -129, -32768, -32769,
+		int64(-1) << 40, 1.5, float32(2.5), "", strings.Repeat("s", 31), strings.Repeat("s", 32), strings.Repeat("s", 256),
+		strings.Repeat("s", 65536), time.Second,
+	}
+
+	for _, value := range values {
+		decoded, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(appendMsgpackValue(nil, value))))
+		if err != nil {
+			t.Errorf("Could not decode the encoding of %#v because: '%s'", value, err.Error())
+			continue
+		}
+
+		var expected = value
+		switch typedValue := value.(type) {
+		case int:
+			expected = int64(typedValue)
+		case uint64:
+			expected = int64(typedValue)
+		case time.Duration:
+			expected = typedValue.String()
+		}
+
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("Expected %#v to decode to %#v but got %#v", value, expected, decoded)
+		}
+	}
+
+	ack := appendMsgpackString(appendMsgpackString(appendMsgpackMapHeader(nil, 1), "ack"), strings.Repeat("c", 40))
+	if entries, err := readMsgpackStringMap(bytes.NewReader(ack)); err != nil || entries["ack"] != strings.Repeat("c", 40) {
+		t.Errorf("Expected the ack map to be read back but got %v and %v", entries, err)
+	}
+}
+
+// receivedForward is a Forward protocol message received by a test server, with its events decoded
+type receivedForward struct {
+	tag    string
+	events []interface{}
+	option map[string]interface{}
+}
+
+// serveForward accepts connections on 'listener', sends every Forward message received to the returned channel and
+// acknowledges messages carrying a chunk id. If 'dropFirst' is true, the connection the first message arrives on is
+// closed without acknowledging it
+func serveForward(listener net.Listener, dropFirst bool) chan receivedForward {
+	messages := make(chan receivedForward, 100)
+	var isFirst = true
+	var mux sync.Mutex
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				for {
+					value, err := decodeMsgpack(reader)
+					if err != nil {
+						return
+					}
+
+					message := value.([]interface{})
+					received := receivedForward{tag: message[0].(string), option: message[2].(map[string]interface{})}
+					eventReader := bufio.NewReader(bytes.NewReader(message[1].([]byte)))
+					for {
+						event, err := decodeMsgpack(eventReader)
+						if err != nil {
+							break
+						}
+						received.events = append(received.events, event)
+					}
+					messages <- received
+
+					mux.Lock()
+					drop := dropFirst && isFirst
+					isFirst = false
+					mux.Unlock()
+
+					if drop {
+						return
+					}
+
+					if chunk, hasChunk := received.option["chunk"]; hasChunk {
+						conn.Write(appendMsgpackString(appendMsgpackString(appendMsgpackMapHeader(nil, 1), "ack"), chunk.(string)))
+					}
+				}
+			}()
+		}
+	}()
+
+	return messages
+}
+
+func TestFluentOutputForwardsTaggedPackedMessagesAndResendsUnacknowledgedChunks(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	defer listener.Close()
+	messages := serveForward(listener, true)
+
+	clock := &fakeClock{now: time.Date(2020, time.January, 2, 3, 4, 5, 123456789, time.UTC)}
+	fluentConfig := FluentConfig{Address: listener.Addr().String(), TagPrefix: "app", RequireAck: true, IncludeCaller: true, BatchInterval: time.Hour, MinBackoff: 10 * time.Millisecond}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Clock: clock.Now, Fluent: &fluentConfig}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.Info("first")
+	logger.SetContext("payments")
+	logger.SetField("attempt", 3)
+	logger.SetField("message", "clashing field")
+	logger.Warning("second")
+	logger.Flush()
+
+	var received []receivedForward
+	for len(received) < 3 {
+		select {
+		case message := <-messages:
+			received = append(received, message)
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected 3 messages but got %d: %+v", len(received), received)
+			return
+		}
+	}
+
+	if received[0].tag != "app" || received[1].tag != "app" || received[2].tag != "app.payments" {
+		t.Errorf("Expected the unacknowledged 'app' message to be sent again before 'app.payments' but got %+v", received)
+		return
+	}
+
+	if received[0].option["chunk"] == nil || received[0].option["chunk"] == received[1].option["chunk"] || received[1].option["size"] != int64(1) {
+		t.Errorf("Expected each message to carry a fresh chunk id and its size but got %v and %v", received[0].option, received[1].option)
+	}
+
+	first := received[1].events[0].([]interface{})
+	if !first[0].(time.Time).Equal(clock.Now()) {
+		t.Errorf("Expected the event time '%s' with nanoseconds but got '%s'", clock.Now(), first[0])
+	}
+
+	if record := first[1].(map[string]interface{}); record["level"] != "INFO" || record["message"] != "first" || record["context"] != nil {
+		t.Errorf("Expected an INFO record without context but got %v", record)
+	}
+
+	second := received[2].events[0].([]interface{})[1].(map[string]interface{})
+	if second["level"] != "WARNING" || second["message"] != "second" || second["message_"] != "clashing field" || second["context"] != "payments" || second["attempt"] != int64(3) {
+		t.Errorf("Expected the WARNING record with its context and fields but got %v", second)
+	}
+
+	if caller, ok := second["caller"].(map[string]interface{}); !ok || !strings.HasSuffix(caller["file"].(string), "golog_test.go") {
+		t.Errorf("Expected the source location under 'caller' but got %v", second["caller"])
+	}
+
+	if counters := logger.DeliveryCounters(); counters.Delivered != 2 || counters.Retries != 1 {
+		t.Errorf("Expected 2 delivered records and 1 retry but got %+v", counters)
+	}
+}
+
+func TestFluentOutputRetriesFailedMessagesInBatchOrderAndOmitsTheCallerByDefault(t *testing.T) {
+	listener := listenTCP(t, "127.0.0.1:0")
+	defer listener.Close()
+
+	// the server acknowledges the first message and drops the connection on the second
+	messages := make(chan receivedForward, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for index := 0; index < 2; index++ {
+			value, err := decodeMsgpack(reader)
+			if err != nil {
+				return
+			}
+
+			message := value.([]interface{})
+			received := receivedForward{tag: message[0].(string), option: message[2].(map[string]interface{})}
+			messages <- received
+
+			if index == 0 {
+				conn.Write(appendMsgpackString(appendMsgpackString(appendMsgpackMapHeader(nil, 1), "ack"), received.option["chunk"].(string)))
+			}
+		}
+	}()
+
+	sink := &fluentSink{config: FluentConfig{Network: "tcp", Address: listener.Addr().String(), TagPrefix: "app", RequireAck: true, AckTimeout: 2 * time.Second, WriteTimeout: 2 * time.Second}, hostname: "testhost"}
+	if sink.writesCaller() {
+		t.Errorf("Expected the caller not to be looked up unless 'IncludeCaller' is set")
+	}
+
+	var batch [][]byte
+	for index, context := range []string{"a", "b", "a"} {
+		record := Record{Level: LevelInfo, Message: "record " + strconv.Itoa(index), Context: context, CallerFile: "main.go", CallerLine: 1}
+		batch = append(batch, append([]byte(sink.tag(record)+"\n"), sink.event(record)...))
+	}
+
+	err := sink.deliver(batch)
+	partialErr, ok := err.(partialDeliveryError)
+	if !ok {
+		t.Errorf("Expected a partial delivery error but got '%v'", err)
+		return
+	}
+
+	if len(partialErr.retry) != 2 || !bytes.Equal(partialErr.retry[0], batch[1]) || !bytes.Equal(partialErr.retry[1], batch[2]) {
+		t.Errorf("Expected the 'app.b' and second 'app.a' records to be retried in batch order but got %q", partialErr.retry)
+	}
+
+	if first := <-messages; first.tag != "app.a" || first.option["size"] != int64(1) {
+		t.Errorf("Expected the first message to only hold the first 'app.a' record but got %+v", first)
+	}
+
+	event, _ := decodeMsgpack(bufio.NewReader(bytes.NewReader(batch[0][bytes.IndexByte(batch[0], '\n')+1:])))
+	if record := event.([]interface{})[1].(map[string]interface{}); record["caller"] != nil {
+		t.Errorf("Expected no 'caller' without 'IncludeCaller' but got %v", record["caller"])
+	}
+}
+
+func TestSetupRejectsInvalidFluentSettings(t *testing.T) {
+	var badConfigs = []FluentConfig{
+		{Address: "fluent-bit"},
+		{Network: "udp", Address: "fluent-bit:24224"},
+		{Network: "unix"},
+		{Network: "unix", Address: "/var/run/fluent.sock", UseTLS: true},
+		{Address: "fluent-bit:24224", Levels: LevelFilter{MinLevel: "LOUD"}},
+	}
+
+	for _, fluentConfig := range badConfigs {
+		fluentConfig := fluentConfig
+		logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Fluent: &fluentConfig}
+		if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+			t.Errorf("Expected Fluent config %+v to be rejected but it was accepted", fluentConfig)
+		}
+	}
+}
+
+// queriedMessages returns the log text of 'records'
+func queriedMessages(records []Record) []string {
+	var messages []string
+	for _, record := range records {
+		messages = append(messages, record.Message)
+	}
+
+	return messages
+}
+
+func TestRingBufferQueriesReturnTheNewestMatchingRecordsFirst(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Clock: clock.Now, RingBuffer: &RingBufferConfig{Capacity: 5}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.Info("evicted 1")
+	clock.Advance(time.Minute)
+	logger.Info("evicted 2")
+	clock.Advance(time.Minute)
+	logger.Info("cache warmed")
+	clock.Advance(time.Minute)
+	logger.SetContext("payments")
+	logger.Warning("payment slow")
+	clock.Advance(time.Minute)
+	logger.Err("payment failed")
+	clock.Advance(time.Minute)
+	logger.SetContext("")
+	logger.Debug("cache hit")
+	clock.Advance(time.Minute)
+	logger.Info("cache miss")
+
+	var queries = []struct {
+		filter   RecordFilter
+		limit    int
+		expected []string
+	}{
+		{RecordFilter{}, 0, []string{"cache miss", "cache hit", "payment failed", "payment slow", "cache warmed"}},
+		{RecordFilter{}, 2, []string{"cache miss", "cache hit"}},
+		{RecordFilter{Levels: LevelFilter{MinLevel: LevelWarn}}, 0, []string{"payment failed", "payment slow"}},
+		{RecordFilter{Levels: LevelFilter{Allow: []LoggingLevel{LevelInfo}}}, 0, []string{"cache miss", "cache warmed"}},
+		{RecordFilter{Since: start.Add(3 * time.Minute), Until: start.Add(5 * time.Minute)}, 0, []string{"payment failed", "payment slow"}},
+		{RecordFilter{Context: "payments"}, 0, []string{"payment failed", "payment slow"}},
+		{RecordFilter{Contains: "cache"}, 0, []string{"cache miss", "cache hit", "cache warmed"}},
+		{RecordFilter{Contains: "cache", Levels: LevelFilter{Deny: []LoggingLevel{LevelDebug}}}, 1, []string{"cache miss"}},
+	}
+
+	for _, query := range queries {
+		records, err := logger.Query(query.filter, query.limit)
+		if err != nil {
+			t.Errorf("Failed to query %+v because: '%s'", query.filter, err.Error())
+			continue
+		}
+
+		if messages := queriedMessages(records); !reflect.DeepEqual(messages, query.expected) {
+			t.Errorf("Expected query %+v with limit %d to return %q but got %q", query.filter, query.limit, query.expected, messages)
+		}
+	}
+
+	if _, err := logger.Query(RecordFilter{Since: start.Add(time.Hour), Until: start}, 0); err == nil {
+		t.Errorf("Expected a time range ending before it starts to be rejected")
+	}
+}
+
+func TestRingBufferCanBeQueriedWhileTheLoggerWrites(t *testing.T) {
+	ringBuffer, err := NewRingBuffer(RingBufferConfig{Capacity: 100})
+	if err != nil {
+		t.Errorf("Failed to create ring buffer because: '%s'", err.Error())
+		return
+	}
+
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, IsAsynch: true, Sinks: []Sink{ringBuffer}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for index := 0; index < 1000; index++ {
+			logger.SetField("index", index)
+			logger.Info("record " + strconv.Itoa(index))
+		}
+	}()
+
+	for isWriting := true; isWriting; {
+		select {
+		case <-done:
+			isWriting = false
+		default:
+		}
+
+		records, _ := ringBuffer.Query(RecordFilter{}, 0)
+		for index := 1; index < len(records); index++ {
+			if records[index].Fields[0].Value.(int) >= records[index-1].Fields[0].Value.(int) {
+				t.Errorf("Expected records newest first but record %v came after %v", records[index].Fields, records[index-1].Fields)
+				logger.Shutdown()
+				return
+			}
+		}
+	}
+	logger.Shutdown()
+
+	if records, _ := logger.Query(RecordFilter{}, 1); len(records) != 1 || records[0].Message != "record 999" {
+		t.Errorf("Expected the last record to still be kept after shutting down but got %v", records)
+	}
+}
+
+func TestQueryFindsARingBufferWrappedByALevelFilter(t *testing.T) {
+	ringBuffer, _ := NewRingBuffer(RingBufferConfig{Capacity: 10})
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Sinks: []Sink{NewFilteredSink(ringBuffer, LevelFilter{MinLevel: LevelWarn})}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	logger.Info("kept out by the filter")
+	logger.Warning("let through")
+
+	records, err := logger.Query(RecordFilter{}, 0)
+	if err != nil {
+		t.Errorf("Expected the filtered ring buffer to be queried but got: '%s'", err.Error())
+		return
+	}
+
+	if len(records) != 1 || records[0].Message != "let through" {
+		t.Errorf("Expected only the record let through by the filter but got %+v", records)
+	}
+}
+
+func TestQueryFailsWithoutARingBufferAndSetupRejectsInvalidCapacities(t *testing.T) {
+	formatter, _ := NewFormatter(FormatText)
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Sinks: []Sink{NewWriterSink(ioutil.Discard, formatter)}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	defer logger.Shutdown()
+
+	if _, err := logger.Query(RecordFilter{}, 0); err == nil {
+		t.Errorf("Expected querying a logger without a ring buffer to fail")
+	}
+
+	for _, ringBufferConfig := range []RingBufferConfig{{Capacity: -1}, {Levels: LevelFilter{MinLevel: "LOUD"}}} {
+		ringBufferConfig := ringBufferConfig
+		logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, RingBuffer: &ringBufferConfig}
+		if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+			t.Errorf("Expected ring buffer config %+v to be rejected but it was accepted", ringBufferConfig)
+		}
+	}
+}
+
+// receivedMessages returns the log texts of the records buffered in 'records' without waiting for more, and whether the
+// channel was closed
+func receivedMessages(records <-chan Record) ([]string, bool) {
+	var messages []string
+	for {
+		select {
+		case record, isOpen := <-records:
+			if !isOpen {
+				return messages, true
+			}
+			messages = append(messages, record.Message)
+		default:
+			return messages, false
+		}
+	}
+}
+
+func TestSubscribersReceiveMatchingRecordsUntilTheyUnsubscribeOrTheLoggerShutsDown(t *testing.T) {
+	formatter, _ := NewFormatter(FormatText)
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, Sinks: []Sink{NewWriterSink(ioutil.Discard, formatter)}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	everything, err := logger.Subscribe(RecordFilter{}, 0)
+	if err != nil {
+		t.Errorf("Failed to subscribe because: '%s'", err.Error())
+		return
+	}
+
+	paymentErrors, err := logger.Subscribe(RecordFilter{Levels: LevelFilter{MinLevel: LevelErr}, Context: "payments"}, 10)
+	if err != nil {
+		t.Errorf("Failed to subscribe because: '%s'", err.Error())
+		return
+	}
+
+	logger.Info("started")
+	logger.SetContext("payments")
+	logger.Info("charging card")
+	logger.Err("card declined")
+
+	if messages, isClosed := receivedMessages(everything); isClosed || strings.Join(messages, ",") != "started,charging card,card declined" {
+		t.Errorf("Expected every record to be received but got %v ( closed: %v )", messages, isClosed)
+	}
+
+	if messages, isClosed := receivedMessages(paymentErrors); isClosed || strings.Join(messages, ",") != "card declined" {
+		t.Errorf("Expected only the payment errors to be received but got %v ( closed: %v )", messages, isClosed)
+	}
+
+	logger.Unsubscribe(paymentErrors)
+	logger.Err("card expired")
+
+	if messages, isClosed := receivedMessages(paymentErrors); !isClosed || len(messages) != 0 {
+		t.Errorf("Expected the channel to be closed after unsubscribing but got %v ( closed: %v )", messages, isClosed)
+	}
+
+	logger.Shutdown()
+
+	if messages, isClosed := receivedMessages(everything); !isClosed || strings.Join(messages, ",") != "card expired" {
+		t.Errorf("Expected the buffered record followed by a closed channel after shutting down but got %v ( closed: %v )", messages, isClosed)
+	}
+
+	if _, err := logger.Subscribe(RecordFilter{}, 0); err == nil {
+		t.Errorf("Expected subscribing to a shut down logger to fail")
+	}
+}
+
+func TestSlowSubscribersMissRecordsRatherThanHoldingUpTheLogger(t *testing.T) {
+	logConfig := LoggingConfig{LogFileStartupAction: FileActionNone, IsMock: true, IsAsynch: true, RingBuffer: &RingBufferConfig{}}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	if _, err := logger.Subscribe(RecordFilter{}, -1); err == nil {
+		t.Errorf("Expected a negative buffer size to be rejected but it was accepted")
+	}
+
+	if _, err := logger.Subscribe(RecordFilter{Levels: LevelFilter{MinLevel: "LOUD"}}, 0); err == nil {
+		t.Errorf("Expected an invalid filter to be rejected but it was accepted")
+	}
+
+	records, err := logger.Subscribe(RecordFilter{}, 2)
+	if err != nil {
+		t.Errorf("Failed to subscribe because: '%s'", err.Error())
+		return
+	}
+
+	// nothing reads the channel while logging, which must not block
+	for index := 0; index < 10; index++ {
+		logger.Info("record " + strconv.Itoa(index))
+	}
+	logger.Shutdown()
+
+	if messages, _ := receivedMessages(records); strings.Join(messages, ",") != "record 0,record 1" {
+		t.Errorf("Expected only the records fitting the buffer to be received but got %v", messages)
+	}
+
+	if kept, _ := logger.Query(RecordFilter{}, 0); len(kept) != 10 {
+		t.Errorf("Expected the other outputs to get every record but the ring buffer kept %d", len(kept))
+	}
+}
@@ -0,0 +1,72 @@
+/*
+	Public representation of a log record, as handed to formatters and sinks
+*/
+
+package golog
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Record is a single log entry as handed to a 'Formatter' or a 'Sink'
+type Record struct {
+	Time           time.Time    // The time the intent to log occurred
+	Level          LoggingLevel // The level the record was logged at
+	Context        string       // The context of the logger when the record was logged ( see 'SetContext' )
+	Message        string       // The log text
+	Fields         []Field      // The fields attached to the record. Sinks must not modify this slice
+	CallerFile     string       // The source file the record was logged from. Only captured for formats that write it
+	CallerLine     int          // The line of 'CallerFile' the record was logged from
+	CallerFunction string       // The fully qualified function the record was logged from
+}
+
+// Field is a single key/value pair attached to a record via 'SetField' or a message template
+type Field struct {
+	Key   string      // The name of the field
+	Value interface{} // The value of the field
+}
+
+// RecordFilter selects records by their level, time, context and log text. Unset criteria match every record
+type RecordFilter struct {
+	Levels   LevelFilter // The levels matched. If unset, every level matches
+	Since    time.Time   // Records logged before this time don't match. If unset, there is no lower bound
+	Until    time.Time   // Records logged at or after this time don't match. If unset, there is no upper bound
+	Context  string      // If not empty, only records logged with this context match. Surrounding spaces are ignored
+	Contains string      // If not empty, only records whose log text contains this text match
+}
+
+// validate returns an error if the filter can't be used
+func (filter RecordFilter) validate() error {
+	if err := filter.Levels.validate(); err != nil {
+		return err
+	}
+
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Until.After(filter.Since) {
+		return errors.New("Invalid time range provided. 'Until' has to be after 'Since'")
+	}
+
+	return nil
+}
+
+// matches returns true if 'record' is selected by the filter
+func (filter RecordFilter) matches(record Record) bool {
+	if !filter.Levels.allows(record.Level) {
+		return false
+	}
+
+	if !filter.Since.IsZero() && record.Time.Before(filter.Since) {
+		return false
+	}
+
+	if !filter.Until.IsZero() && !record.Time.Before(filter.Until) {
+		return false
+	}
+
+	if filter.Context != "" && strings.TrimSpace(record.Context) != strings.TrimSpace(filter.Context) {
+		return false
+	}
+
+	return strings.Contains(record.Message, filter.Contains)
+}
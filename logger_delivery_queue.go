@@ -0,0 +1,601 @@
+/*
+	File holding the queue outputs use to deliver records to remote endpoints without blocking the logger
+*/
+
+package golog
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxBufferedRecords = 10000                  // The number of records buffered for delivery if not configured
+	defaultMaxBufferedBytes   = 8 * 1024 * 1024        // The number of bytes buffered for delivery if not configured
+	defaultMinBackoff         = 100 * time.Millisecond // The first delay before retrying a failed delivery if not configured
+	defaultMaxBackoff         = 30 * time.Second       // The longest delay before retrying a failed delivery if not configured
+	defaultFlushTimeout       = 5 * time.Second        // How long flushing waits for buffered records to be delivered if not configured
+)
+
+// DeliveryCounters count what happened to the records given to an output delivering them to a remote endpoint
+type DeliveryCounters struct {
+	Delivered uint64 // The number of records the endpoint accepted
+	Dropped   uint64 // The number of records given up on, because the buffer was full or the endpoint rejected them
+	Rejected  uint64 // The number of dropped records the endpoint refused for good, such as documents failing to index
+	Retries   uint64 // The number of failed delivery attempts that were retried
+	Buffered  int    // The number of records currently waiting for delivery in memory
+	Spooled   int    // The number of records waiting for delivery in the output's spool directory
+}
+
+// DeliveryCounter is implemented by sinks delivering records to a remote endpoint. 'Logger.DeliveryCounters' adds up
+// the counters of every such sink of a logger
+type DeliveryCounter interface {
+	DeliveryCounters() DeliveryCounters
+}
+
+// add returns the sum of 'counters' and 'other'
+func (counters DeliveryCounters) add(other DeliveryCounters) DeliveryCounters {
+	return DeliveryCounters{counters.Delivered + other.Delivered, counters.Dropped + other.Dropped, counters.Rejected + other.Rejected, counters.Retries + other.Retries, counters.Buffered + other.Buffered, counters.Spooled + other.Spooled}
+}
+
+// rejectedError is returned by a delivery function when the endpoint refused a batch for good, so it is dropped
+// instead of retried
+type rejectedError struct {
+	err error // The reason the batch was refused
+}
+
+func (err rejectedError) Error() string {
+	return err.err.Error()
+}
+
+// retryAfterError is returned by a delivery function when the endpoint asked to be retried after 'delay' rather than
+// after the usual backoff
+type retryAfterError struct {
+	err   error         // The reason the batch was not accepted
+	delay time.Duration // How long to wait before retrying
+}
+
+func (err retryAfterError) Error() string {
+	return err.err.Error()
+}
+
+// partialDeliveryError is returned by a delivery function when the endpoint accepted only some records of a batch.
+// 'retry' are the records to deliver again, in order, and 'rejected' the number of records refused for good
+type partialDeliveryError struct {
+	err      error    // The reason not every record was accepted
+	retry    [][]byte // The records worth retrying
+	rejected int      // The number of records refused for good
+}
+
+func (err partialDeliveryError) Error() string {
+	return err.err.Error()
+}
+
+// deliveryOptions configure a 'deliveryQueue'. Unset values are replaced by their defaults
+type deliveryOptions struct {
+	maxBufferedRecords int           // The number of records buffered before the oldest are dropped
+	maxBufferedBytes   int           // The number of bytes buffered before the oldest records are dropped
+	maxBatchRecords    int           // The number of records delivered at once. If unset, every buffered record is
+	maxBatchBytes      int           // The number of bytes delivered at once. If unset, there is no limit
+	batchInterval      time.Duration // How long a batch that is not full waits for more records. If unset, it is delivered right away
+	minBackoff         time.Duration // The delay before retrying a failed delivery, doubled after each further failure
+	maxBackoff         time.Duration // The longest delay before retrying a failed delivery
+	flushTimeout       time.Duration // How long flushing and closing wait for buffered records to be delivered
+	spool              *diskSpool    // The spool records spill to once the buffer is full. If nil, the oldest records are dropped instead
+}
+
+// deliveryQueue buffers encoded records in memory and hands them to 'deliver' from a background goroutine, retrying
+// failed deliveries with exponential backoff. Enqueuing never blocks: when the buffer is full, the oldest records are
+// dropped, or spilled to the spool if there is one. Only the goroutine touches the spool, and never while holding 'mux',
+// so logging calls never wait on the disk either
+type deliveryQueue struct {
+	mux           sync.Mutex           // Guards every field below
+	changed       *sync.Cond           // Signaled when records are queued or delivered, a timer expires or the queue closes
+	options       deliveryOptions      // The configuration, with defaults filled in
+	deliver       func([][]byte) error // Delivers a batch of records to the endpoint
+	records       [][]byte             // The records waiting for delivery, oldest first
+	bufferedBytes int                  // The number of bytes in 'records'
+	firstQueued   time.Time            // The time the oldest record in 'records' was queued, used for batching
+	inFlight      int                  // The number of records currently being delivered
+	inFlightBytes int                  // The number of bytes currently being delivered
+	spill         [][]byte             // The records waiting to be written to the spool by the goroutine, oldest first
+	spillBytes    int                  // The number of bytes in 'spill'
+	spilling      int                  // The number of records the goroutine is currently writing to the spool
+	spooled       int                  // The number of records in the spool left to read, as of the goroutine's last spool operation
+	hasSegments   bool                 // If true, the spool holds segments, including one being replayed
+	replayed      int                  // The number of records at the front of the in-flight batch and buffer read from the spool's oldest segment
+	isReplaying   bool                 // If true, the spool's oldest segment was read and is deleted once 'replayed' drops to zero
+	counters      DeliveryCounters     // What happened to the records so far
+	isFlushing    int                  // The number of callers waiting for the buffer to drain, which sends partial batches right away
+	isClosing     bool                 // If true, no more records are accepted and the goroutine returns once the buffer drains
+	isAborting    bool                 // If true, records that can't be delivered right away are dropped so the goroutine returns
+	stopped       chan struct{}        // Closed once the goroutine has returned
+}
+
+// newDeliveryQueue returns a started queue handing records to 'deliver'
+func newDeliveryQueue(options deliveryOptions, deliver func([][]byte) error) *deliveryQueue {
+	if options.maxBufferedRecords <= 0 {
+		options.maxBufferedRecords = defaultMaxBufferedRecords
+	}
+
+	if options.maxBufferedBytes <= 0 {
+		options.maxBufferedBytes = defaultMaxBufferedBytes
+	}
+
+	if options.minBackoff <= 0 {
+		options.minBackoff = defaultMinBackoff
+	}
+
+	if options.maxBackoff <= 0 {
+		options.maxBackoff = defaultMaxBackoff
+	}
+
+	if options.maxBackoff < options.minBackoff {
+		options.maxBackoff = options.minBackoff
+	}
+
+	if options.flushTimeout <= 0 {
+		options.flushTimeout = defaultFlushTimeout
+	}
+
+	// a segment read back from the spool is loaded into the emptied buffer, so it may not hold more than the buffer does
+	if options.spool != nil {
+		options.spool.segmentRecords = options.maxBufferedRecords
+		if options.spool.segmentBytes > int64(options.maxBufferedBytes) {
+			options.spool.segmentBytes = int64(options.maxBufferedBytes)
+		}
+	}
+
+	queue := &deliveryQueue{options: options, deliver: deliver, stopped: make(chan struct{})}
+	queue.changed = sync.NewCond(&queue.mux)
+	queue.syncSpool()
+
+	go queue.run()
+
+	return queue
+}
+
+// enqueue adds 'record' to the buffer, dropping the oldest records if it is full. With a spool, records are spilled
+// instead once the buffer is full, and keep being spilled until the spool is replayed, so they are delivered in order.
+// Spilled records wait in memory for the goroutine to write them to the spool. It returns false if the queue is closed
+func (queue *deliveryQueue) enqueue(record []byte) bool {
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	if queue.isClosing {
+		return false
+	}
+
+	if queue.shouldSpool(len(record)) {
+		queue.spill = append(queue.spill, record)
+		queue.spillBytes += len(record)
+		queue.dropSpillOverflow()
+		queue.changed.Broadcast()
+		return true
+	}
+
+	if len(queue.records) == 0 {
+		queue.firstQueued = time.Now()
+	}
+
+	queue.records = append(queue.records, record)
+	queue.bufferedBytes += len(record)
+	queue.dropOverflow()
+	queue.changed.Broadcast()
+
+	return true
+}
+
+// shouldSpool returns true if a record of 'size' bytes has to be spilled: the spool still holds or is about to hold
+// records, or the buffer, counting the records being delivered, is full. The caller must hold 'mux'
+func (queue *deliveryQueue) shouldSpool(size int) bool {
+	if queue.options.spool == nil {
+		return false
+	}
+
+	return queue.hasSegments || len(queue.spill) > 0 || queue.spilling > 0 ||
+		len(queue.records)+queue.inFlight >= queue.options.maxBufferedRecords ||
+		queue.bufferedBytes+queue.inFlightBytes+size > queue.options.maxBufferedBytes
+}
+
+// dropSpillOverflow drops the oldest spilled records until those waiting to be written to the spool fit under the
+// spool's cap, which only happens if the goroutine is held up delivering a batch. The caller must hold 'mux'
+func (queue *deliveryQueue) dropSpillOverflow() {
+	var dropCount = 0
+	var droppedBytes = 0
+	for int64(queue.spillBytes-droppedBytes) > queue.options.spool.maxBytes && len(queue.spill)-dropCount > 1 {
+		droppedBytes += len(queue.spill[dropCount])
+		dropCount++
+	}
+
+	if dropCount == 0 {
+		return
+	}
+
+	queue.spill = append([][]byte(nil), queue.spill[dropCount:]...)
+	queue.spillBytes -= droppedBytes
+	queue.counters.Dropped += uint64(dropCount)
+}
+
+// syncSpool copies the spool's state the logging calls look at into the queue. The caller must hold 'mux', and be the
+// goroutine or still creating the queue
+func (queue *deliveryQueue) syncSpool() {
+	if queue.options.spool == nil {
+		return
+	}
+
+	queue.spooled = queue.options.spool.records
+	queue.hasSegments = len(queue.options.spool.segments) > 0
+	queue.isReplaying = queue.options.spool.isReplaying
+}
+
+// writeSpill writes the spilled records to the spool, releasing 'mux' meanwhile. Records the spool can't take are
+// buffered in memory instead. The caller must hold 'mux' and be the goroutine
+func (queue *deliveryQueue) writeSpill() {
+	spill := queue.spill
+	queue.spill = nil
+	queue.spillBytes = 0
+	queue.spilling = len(spill)
+
+	queue.mux.Unlock()
+	var dropped = 0
+	var failed [][]byte
+	for _, record := range spill {
+		droppedNow, err := queue.options.spool.write(record)
+		dropped += droppedNow
+		if err != nil {
+			failed = append(failed, record)
+		}
+	}
+	queue.mux.Lock()
+
+	queue.spilling = 0
+	queue.counters.Dropped += uint64(dropped)
+	queue.syncSpool()
+
+	if len(failed) > 0 {
+		if len(queue.records) == 0 {
+			queue.firstQueued = time.Now()
+		}
+
+		queue.records = append(queue.records, failed...)
+		for _, record := range failed {
+			queue.bufferedBytes += len(record)
+		}
+		queue.dropOverflow()
+	}
+
+	queue.changed.Broadcast()
+}
+
+// readSpool moves the records of the spool's oldest segment into the empty buffer, releasing 'mux' meanwhile. The
+// segment stays on disk until they are all delivered or dropped. The records are sent without waiting for the batch
+// interval, since they waited long enough. The caller must hold 'mux' and be the goroutine
+func (queue *deliveryQueue) readSpool() {
+	queue.mux.Unlock()
+	records, lost, _ := queue.options.spool.readOldest()
+	queue.mux.Lock()
+
+	queue.counters.Dropped += uint64(lost)
+	queue.syncSpool()
+
+	// nothing else is buffered while the spool holds segments, the records are put in front all the same
+	queue.records = append(records, queue.records...)
+	for _, record := range records {
+		queue.bufferedBytes += len(record)
+	}
+	queue.replayed = len(records)
+	queue.firstQueued = time.Time{}
+}
+
+// releaseSpool deletes the spool's oldest segment once its records are no longer buffered, releasing 'mux' meanwhile.
+// The caller must hold 'mux' and be the goroutine
+func (queue *deliveryQueue) releaseSpool() {
+	queue.mux.Unlock()
+	queue.options.spool.release()
+	queue.mux.Lock()
+
+	queue.syncSpool()
+	queue.changed.Broadcast()
+}
+
+// stop gives up on the buffered and spilled records and closes the spool if there is one, releasing 'mux' meanwhile.
+// Buffered records are written in front of the spool so the next run replays them first, except those read from the
+// segment being replayed, which is still on disk. Records already delivered from it are then delivered again. The
+// caller must hold 'mux' and be the goroutine
+func (queue *deliveryQueue) stop() {
+	var unsent = queue.records
+	if queue.isReplaying {
+		unsent = unsent[queue.replayed:]
+	}
+	spill := queue.spill
+
+	queue.records = nil
+	queue.bufferedBytes = 0
+	queue.replayed = 0
+	queue.spill = nil
+	queue.spillBytes = 0
+
+	if queue.options.spool == nil {
+		queue.counters.Dropped += uint64(len(unsent))
+		return
+	}
+
+	queue.mux.Unlock()
+	var dropped = 0
+	if len(unsent) > 0 && queue.options.spool.writeFront(unsent) != nil {
+		dropped += len(unsent)
+	}
+
+	for _, record := range spill {
+		droppedNow, err := queue.options.spool.write(record)
+		dropped += droppedNow
+		if err != nil {
+			dropped++
+		}
+	}
+	queue.options.spool.close()
+	queue.mux.Lock()
+
+	queue.counters.Dropped += uint64(dropped)
+	queue.syncSpool()
+}
+
+// dropOverflow drops the oldest records until the buffer fits its limits. The caller must hold 'mux'
+func (queue *deliveryQueue) dropOverflow() {
+	var dropCount = 0
+	var droppedBytes = 0
+	for len(queue.records)-dropCount > queue.options.maxBufferedRecords ||
+		(queue.bufferedBytes-droppedBytes > queue.options.maxBufferedBytes && len(queue.records)-dropCount > 1) {
+		droppedBytes += len(queue.records[dropCount])
+		dropCount++
+	}
+
+	if dropCount == 0 {
+		return
+	}
+
+	// copied so the dropped records' memory is released
+	queue.records = append([][]byte(nil), queue.records[dropCount:]...)
+	queue.bufferedBytes -= droppedBytes
+	queue.counters.Dropped += uint64(dropCount)
+	queue.resolveReplayed(dropCount)
+}
+
+// resolveReplayed records that 'count' records at the front of the in-flight batch and buffer were delivered or dropped,
+// which may leave the segment being replayed ready to be deleted. The caller must hold 'mux'
+func (queue *deliveryQueue) resolveReplayed(count int) {
+	if count > queue.replayed {
+		count = queue.replayed
+	}
+
+	queue.replayed -= count
+}
+
+// isBatchReady returns true if the buffered records fill a batch, or waited long enough to be sent as a partial one.
+// The caller must hold 'mux'
+func (queue *deliveryQueue) isBatchReady() bool {
+	if queue.options.batchInterval <= 0 || queue.isFlushing > 0 || queue.isClosing {
+		return true
+	}
+
+	if queue.options.maxBatchRecords > 0 && len(queue.records) >= queue.options.maxBatchRecords {
+		return true
+	}
+
+	if queue.options.maxBatchBytes > 0 && queue.bufferedBytes >= queue.options.maxBatchBytes {
+		return true
+	}
+
+	return !time.Now().Before(queue.firstQueued.Add(queue.options.batchInterval))
+}
+
+// takeBatch removes the next batch from the buffer and returns it. The caller must hold 'mux'
+func (queue *deliveryQueue) takeBatch() [][]byte {
+	var count = 0
+	var batchBytes = 0
+	for count < len(queue.records) {
+		if queue.options.maxBatchRecords > 0 && count >= queue.options.maxBatchRecords {
+			break
+		}
+
+		// a batch never mixes records of the segment being replayed with later ones, so it is known when they are done
+		if queue.replayed > 0 && count >= queue.replayed {
+			break
+		}
+
+		// a record larger than a batch is still sent, on its own
+		if queue.options.maxBatchBytes > 0 && count > 0 && batchBytes+len(queue.records[count]) > queue.options.maxBatchBytes {
+			break
+		}
+
+		batchBytes += len(queue.records[count])
+		count++
+	}
+
+	batch := queue.records[:count:count]
+	queue.records = queue.records[count:]
+	queue.bufferedBytes -= batchBytes
+	queue.inFlight = count
+	queue.inFlightBytes = batchBytes
+	queue.firstQueued = time.Now()
+
+	return batch
+}
+
+// requeue puts 'batch', which failed to be delivered, back in front of the buffer. The caller must hold 'mux'
+func (queue *deliveryQueue) requeue(batch [][]byte) {
+	records := make([][]byte, 0, len(batch)+len(queue.records))
+	records = append(records, batch...)
+	queue.records = append(records, queue.records...)
+
+	for _, record := range batch {
+		queue.bufferedBytes += len(record)
+	}
+
+	queue.dropOverflow()
+}
+
+// waitUntil waits until 'deadline' passes or 'isDone' returns true. The caller must hold 'mux'
+func (queue *deliveryQueue) waitUntil(deadline time.Time, isDone func() bool) {
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		queue.mux.Lock()
+		queue.changed.Broadcast()
+		queue.mux.Unlock()
+	})
+	defer timer.Stop()
+
+	for !isDone() && time.Now().Before(deadline) {
+		queue.changed.Wait()
+	}
+}
+
+// run delivers batches until the queue closes and its buffer has drained or been given up on
+func (queue *deliveryQueue) run() {
+	defer close(queue.stopped)
+
+	var backoff = queue.options.minBackoff
+
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	for {
+		if queue.isReplaying && queue.replayed == 0 {
+			queue.releaseSpool()
+			continue
+		}
+
+		for len(queue.records) == 0 && len(queue.spill) == 0 && queue.spooled == 0 && !queue.isClosing {
+			queue.changed.Wait()
+		}
+
+		if len(queue.spill) > 0 && !queue.isAborting {
+			queue.writeSpill()
+			continue
+		}
+
+		if (len(queue.records) == 0 && queue.spooled == 0) || queue.isAborting {
+			queue.stop()
+			queue.changed.Broadcast()
+			return
+		}
+
+		if len(queue.records) == 0 {
+			queue.readSpool()
+			continue
+		}
+
+		if !queue.isBatchReady() {
+			queue.waitUntil(queue.firstQueued.Add(queue.options.batchInterval), func() bool {
+				return queue.isBatchReady() || len(queue.spill) > 0
+			})
+			continue
+		}
+
+		batch := queue.takeBatch()
+
+		// delivered outside of the lock so logging calls never wait on the endpoint
+		queue.mux.Unlock()
+		err := queue.deliver(batch)
+		queue.mux.Lock()
+
+		queue.inFlight = 0
+		queue.inFlightBytes = 0
+
+		var retry = batch
+		switch typedErr := err.(type) {
+		case nil:
+			queue.counters.Delivered += uint64(len(batch))
+			retry = nil
+		case rejectedError:
+			queue.counters.Dropped += uint64(len(batch))
+			queue.counters.Rejected += uint64(len(batch))
+			retry = nil
+		case partialDeliveryError:
+			queue.counters.Delivered += uint64(len(batch) - len(typedErr.retry) - typedErr.rejected)
+			queue.counters.Dropped += uint64(typedErr.rejected)
+			queue.counters.Rejected += uint64(typedErr.rejected)
+			retry = typedErr.retry
+		}
+		queue.resolveReplayed(len(batch) - len(retry))
+
+		if len(retry) == 0 {
+			backoff = queue.options.minBackoff
+			queue.changed.Broadcast()
+			continue
+		}
+
+		queue.counters.Retries++
+		queue.requeue(retry)
+		queue.changed.Broadcast()
+
+		var delay = backoff
+		if retryAfter, ok := err.(retryAfterError); ok && retryAfter.delay > 0 {
+			delay = retryAfter.delay
+		}
+
+		// spilled records are still written to the spool while waiting, so they don't pile up in memory
+		var retryTime = time.Now().Add(delay)
+		for !queue.isAborting && time.Now().Before(retryTime) {
+			queue.waitUntil(retryTime, func() bool { return queue.isAborting || len(queue.spill) > 0 })
+			if len(queue.spill) > 0 && !queue.isAborting {
+				queue.writeSpill()
+			}
+		}
+
+		backoff *= 2
+		if backoff > queue.options.maxBackoff {
+			backoff = queue.options.maxBackoff
+		}
+	}
+}
+
+// isDrained returns true if every record queued so far was delivered or dropped. The caller must hold 'mux'
+func (queue *deliveryQueue) isDrained() bool {
+	return len(queue.records) == 0 && queue.inFlight == 0 && len(queue.spill) == 0 && queue.spilling == 0 && queue.spooled == 0
+}
+
+// flush waits until every buffered record was delivered or dropped, or the flush timeout passes. Records still buffered
+// then stay queued, so an unreachable endpoint delays flushing but never fails it
+func (queue *deliveryQueue) flush() {
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	queue.isFlushing++
+	queue.changed.Broadcast()
+	queue.waitUntil(time.Now().Add(queue.options.flushTimeout), queue.isDrained)
+	queue.isFlushing--
+}
+
+// close stops accepting records, waits up to the flush timeout for the buffered and spooled ones to be delivered and
+// drops the rest, or leaves them in the spool if there is one. It returns once the background goroutine has stopped
+func (queue *deliveryQueue) close() {
+	queue.mux.Lock()
+	if queue.isClosing {
+		queue.mux.Unlock()
+		<-queue.stopped
+		return
+	}
+
+	queue.isClosing = true
+	queue.changed.Broadcast()
+	queue.waitUntil(time.Now().Add(queue.options.flushTimeout), queue.isDrained)
+
+	queue.isAborting = true
+	queue.changed.Broadcast()
+	queue.mux.Unlock()
+
+	<-queue.stopped
+}
+
+// deliveryCounters returns a snapshot of the queue's counters
+func (queue *deliveryQueue) deliveryCounters() DeliveryCounters {
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	counters := queue.counters
+	counters.Buffered = len(queue.records) + queue.inFlight + len(queue.spill) + queue.spilling
+	counters.Spooled = queue.spooled
+
+	return counters
+}
@@ -0,0 +1,326 @@
+/*
+	File holding the on-disk spool remote outputs spill records to while their endpoint can't keep up
+*/
+
+package golog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	defaultSpoolMaxBytes     = 256 * 1024 * 1024 // The size the spool is capped at if not configured
+	defaultSpoolSegmentBytes = 4 * 1024 * 1024   // The size segment files grow to before a new one is started if not configured
+	spoolSegmentExtension    = ".spool"          // The extension of segment files
+	firstSpoolSequence       = 1 << 32           // The sequence number of the first segment of an empty spool, leaving room for segments put in front of it
+)
+
+// SpoolConfig configures the directory a remote output spills records to once its memory buffer is full, instead of
+// dropping them
+type SpoolConfig struct {
+	Directory    string // The directory segment files are written to. Each output needs a directory of its own
+	MaxBytes     int64  // The size the spool is capped at. Once reached, the oldest segments are deleted. If unset, 256 MiB is used
+	SegmentBytes int64  // The size segment files grow to before a new one is started. If unset, 4 MiB is used
+}
+
+// spoolSegment is a segment file of the spool. Segments hold records as a 32 bit big endian length followed by the record
+type spoolSegment struct {
+	sequence uint64 // The number the file is named after. Segments are replayed in order of their numbers
+	bytes    int64  // The size of the file
+	records  int    // The number of records in the file
+}
+
+// diskSpool stores records in segment files in a directory, oldest first, so they outlive outages and restarts. The
+// oldest segment stays on disk while its records are being delivered, and is only deleted by 'release' once they all
+// were. It is not safe for concurrent use, only the delivery queue's goroutine uses it
+type diskSpool struct {
+	osHandle       afero.Fs       // The filesystem the directory lives on
+	directory      string         // The directory holding the segments
+	maxBytes       int64          // The size the spool is capped at
+	segmentBytes   int64          // The size segments grow to before a new one is started
+	segmentRecords int            // The number of records segments grow to before a new one is started. 0 if unlimited
+	segments       []spoolSegment // The segments, oldest first
+	bytes          int64          // The size of every segment
+	records        int            // The number of records in every segment, except the one being replayed
+	writer         afero.File     // The newest segment, open for appending. nil if no segment is open
+	isReplaying    bool           // If true, the oldest segment was read by 'readOldest' and waits for 'release'
+}
+
+// openDiskSpool returns the spool described by 'config' on 'osPtr', picking up the segments a previous run left
+// behind. nil is returned if 'config' is nil
+func openDiskSpool(config *SpoolConfig, osPtr afero.Fs) (*diskSpool, error) {
+	var stringBuilder strings.Builder
+
+	if config == nil {
+		return nil, nil
+	}
+
+	if config.Directory == "" {
+		return nil, errors.New("No spool directory provided")
+	}
+
+	if config.MaxBytes < 0 || config.SegmentBytes < 0 {
+		return nil, errors.New("Invalid spool size provided. Sizes may not be negative")
+	}
+
+	spool := &diskSpool{osHandle: osPtr, directory: config.Directory, maxBytes: config.MaxBytes, segmentBytes: config.SegmentBytes}
+	if spool.maxBytes == 0 {
+		spool.maxBytes = defaultSpoolMaxBytes
+	}
+
+	if spool.segmentBytes == 0 {
+		spool.segmentBytes = defaultSpoolSegmentBytes
+	}
+
+	if spool.segmentBytes > spool.maxBytes {
+		spool.segmentBytes = spool.maxBytes
+	}
+
+	err := osPtr.MkdirAll(config.Directory, os.ModePerm)
+	if err == nil {
+		err = spool.scan()
+	}
+
+	if err != nil {
+		stringBuilder.WriteString("Could not open spool directory '")
+		stringBuilder.WriteString(config.Directory)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return nil, errors.New(stringBuilder.String())
+	}
+
+	return spool, nil
+}
+
+// segmentPath returns the path of the segment numbered 'sequence'
+func (spool *diskSpool) segmentPath(sequence uint64) string {
+	return filepath.Join(spool.directory, fmt.Sprintf("%020d", sequence)+spoolSegmentExtension)
+}
+
+// scan finds the segments in the directory. Listing them sorted by name orders them, as their numbers are zero padded
+func (spool *diskSpool) scan() error {
+	fileInfos, err := afero.ReadDir(spool.osHandle, spool.directory)
+	if err != nil {
+		return err
+	}
+
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || !strings.HasSuffix(name, spoolSegmentExtension) {
+			continue
+		}
+
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		contents, err := afero.ReadFile(spool.osHandle, spool.segmentPath(sequence))
+		if err != nil {
+			return err
+		}
+
+		segment := spoolSegment{sequence: sequence, bytes: int64(len(contents)), records: len(splitSpoolRecords(contents))}
+		spool.segments = append(spool.segments, segment)
+		spool.bytes += segment.bytes
+		spool.records += segment.records
+	}
+
+	return nil
+}
+
+// splitSpoolRecords returns the records held by the segment contents 'contents'. A record cut short, as left by a crash
+// while it was written, is ignored
+func splitSpoolRecords(contents []byte) [][]byte {
+	var records [][]byte
+	for len(contents) >= 4 {
+		length := int(binary.BigEndian.Uint32(contents))
+		if len(contents)-4 < length {
+			break
+		}
+
+		records = append(records, contents[4:4+length])
+		contents = contents[4+length:]
+	}
+
+	return records
+}
+
+// appendSpoolRecord appends 'record' to 'buffer' as it is stored in a segment
+func appendSpoolRecord(buffer []byte, record []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(record)))
+
+	buffer = append(buffer, length[:]...)
+	return append(buffer, record...)
+}
+
+// isEmpty returns true if the spool holds no records left to read
+func (spool *diskSpool) isEmpty() bool {
+	return spool.records == 0
+}
+
+// closeWriter closes the open segment, if any
+func (spool *diskSpool) closeWriter() error {
+	if spool.writer == nil {
+		return nil
+	}
+
+	err := spool.writer.Close()
+	spool.writer = nil
+
+	return err
+}
+
+// write writes 'record' after every other one, starting a new segment if the newest one is full. It returns the number
+// of records dropped by deleting the oldest segments to keep the spool under its cap
+func (spool *diskSpool) write(record []byte) (int, error) {
+	entry := appendSpoolRecord(nil, record)
+
+	var newest *spoolSegment
+	if spool.writer != nil {
+		newest = &spool.segments[len(spool.segments)-1]
+		isFull := newest.bytes+int64(len(entry)) > spool.segmentBytes || (spool.segmentRecords > 0 && newest.records >= spool.segmentRecords)
+		if isFull {
+			if err := spool.closeWriter(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if spool.writer == nil {
+		var sequence uint64 = firstSpoolSequence
+		if len(spool.segments) > 0 {
+			sequence = spool.segments[len(spool.segments)-1].sequence + 1
+		}
+
+		writer, err := spool.osHandle.OpenFile(spool.segmentPath(sequence), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return 0, err
+		}
+
+		spool.writer = writer
+		spool.segments = append(spool.segments, spoolSegment{sequence: sequence})
+		newest = &spool.segments[len(spool.segments)-1]
+	}
+
+	// the segment may end in part of the record now, so the next record starts a new one
+	if _, err := spool.writer.Write(entry); err != nil {
+		spool.closeWriter()
+		return 0, err
+	}
+
+	newest.bytes += int64(len(entry))
+	newest.records++
+	spool.bytes += int64(len(entry))
+	spool.records++
+
+	// the newest segment is kept, as it holds the record just written, and so is the one being replayed, whose records
+	// are already buffered for delivery
+	var first = 0
+	if spool.isReplaying {
+		first = 1
+	}
+
+	var dropped = 0
+	for spool.bytes > spool.maxBytes && len(spool.segments) > first+1 {
+		oldest := spool.segments[first]
+		if err := spool.osHandle.Remove(spool.segmentPath(oldest.sequence)); err != nil {
+			return dropped, err
+		}
+
+		spool.segments = append(spool.segments[:first], spool.segments[first+1:]...)
+		spool.bytes -= oldest.bytes
+		spool.records -= oldest.records
+		dropped += oldest.records
+	}
+
+	return dropped, nil
+}
+
+// writeFront writes 'records' to a new segment in front of every other one, so they are replayed first
+func (spool *diskSpool) writeFront(records [][]byte) error {
+	var contents []byte
+	for _, record := range records {
+		contents = appendSpoolRecord(contents, record)
+	}
+
+	var sequence uint64 = firstSpoolSequence
+	if len(spool.segments) > 0 {
+		sequence = spool.segments[0].sequence - 1
+	}
+
+	if err := afero.WriteFile(spool.osHandle, spool.segmentPath(sequence), contents, 0644); err != nil {
+		return err
+	}
+
+	spool.segments = append([]spoolSegment{{sequence, int64(len(contents)), len(records)}}, spool.segments...)
+	spool.bytes += int64(len(contents))
+	spool.records += len(records)
+
+	return nil
+}
+
+// readOldest returns the records of the oldest segment, which is kept on disk until 'release' is called, so a crash
+// before they are delivered replays them on the next run. Later records go to newer segments. If the segment can't be
+// read, it is given up on and the number of records lost with it is returned along with the error
+func (spool *diskSpool) readOldest() ([][]byte, int, error) {
+	if len(spool.segments) == 0 || spool.isReplaying {
+		return nil, 0, nil
+	}
+
+	oldest := spool.segments[0]
+	if len(spool.segments) == 1 {
+		spool.closeWriter()
+	}
+
+	path := spool.segmentPath(oldest.sequence)
+	contents, err := afero.ReadFile(spool.osHandle, path)
+	if err != nil {
+		spool.segments = spool.segments[1:]
+		spool.bytes -= oldest.bytes
+		spool.records -= oldest.records
+		spool.osHandle.Remove(path)
+
+		return nil, oldest.records, err
+	}
+
+	spool.records -= oldest.records
+	spool.isReplaying = true
+
+	return splitSpoolRecords(contents), 0, nil
+}
+
+// release deletes the segment returned by 'readOldest', once its records were delivered or given up on
+func (spool *diskSpool) release() {
+	if !spool.isReplaying {
+		return
+	}
+
+	oldest := spool.segments[0]
+	spool.segments = spool.segments[1:]
+	spool.bytes -= oldest.bytes
+	spool.isReplaying = false
+
+	// a segment that can't be deleted is replayed again by the next run, which is better than losing it
+	spool.osHandle.Remove(spool.segmentPath(oldest.sequence))
+}
+
+// close closes the open segment. The segments stay on disk, including one being replayed, to be replayed by the next run
+func (spool *diskSpool) close() error {
+	if spool.isReplaying {
+		spool.records += spool.segments[0].records
+		spool.isReplaying = false
+	}
+
+	return spool.closeWriter()
+}
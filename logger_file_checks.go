@@ -0,0 +1,78 @@
+/*
+	File holding functions related to detecting log files that were deleted or moved while open
+*/
+
+package golog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isSameFile returns true if 'openFileInfo', of the open log file, and 'pathFileInfo', of the file at the log file's
+// path, describe the same file. Filesystems without file identities, such as afero's in memory one, are compared by the
+// name the open file currently has
+func isSameFile(openFileInfo os.FileInfo, pathFileInfo os.FileInfo) bool {
+	if os.SameFile(openFileInfo, openFileInfo) {
+		return os.SameFile(openFileInfo, pathFileInfo)
+	}
+
+	return filepath.Base(openFileInfo.Name()) == filepath.Base(pathFileInfo.Name())
+}
+
+// checkFile recreates the log file if the open one was deleted or moved since the last check, and writes a warning to
+// the new file. Records still buffered are written to the new file, except binary ones. Checks happen at most once per
+// check interval. The caller must hold 'mux'
+func (sink *fileSink) checkFile() error {
+	var stringBuilder strings.Builder
+
+	if sink.options.checkInterval < 0 {
+		return nil
+	}
+
+	var now = sink.options.clock()
+	if now.Sub(sink.lastCheck) < sink.options.checkInterval {
+		return nil
+	}
+	sink.lastCheck = now
+
+	openFileInfo, openErr := sink.file.Stat()
+	pathFileInfo, pathErr := sink.osHandle.Stat(sink.filePath)
+	if openErr == nil && pathErr == nil && isSameFile(openFileInfo, pathFileInfo) {
+		return nil
+	}
+
+	if pathErr != nil && !os.IsNotExist(pathErr) {
+		// the path can't be checked right now, which doesn't mean the file is gone
+		return nil
+	}
+
+	// binary frames only decode in the session they were encoded in, so they go to the old file, wherever it is now
+	if _, ok := sink.formatter.(resetter); ok {
+		sink.flush()
+	}
+	sink.file.Close()
+
+	var bufferedSize = 0
+	if sink.writer != nil {
+		bufferedSize = sink.writer.Buffered()
+	}
+
+	err := sink.open()
+	if err != nil {
+		return err
+	}
+	sink.fileSize += int64(bufferedSize)
+
+	// the new file starts without the strings interned by earlier binary frames
+	if formatter, ok := sink.formatter.(resetter); ok {
+		formatter.Reset()
+	}
+
+	stringBuilder.WriteString("Log file '")
+	stringBuilder.WriteString(sink.filePath)
+	stringBuilder.WriteString("' was deleted or moved while open, so logging continues in a new file at its path")
+
+	return sink.writeBytes(sink.formatter.Format(Record{Time: now, Level: LevelWarn, Message: stringBuilder.String()}))
+}
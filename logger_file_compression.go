@@ -0,0 +1,250 @@
+/*
+	File holding functions related to compressing old log files
+*/
+
+package golog
+
+import (
+	"compress/flate"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// compressionOptions holds the settings log files are compressed with. Zero values select the defaults
+type compressionOptions struct {
+	compression  LoggingCompression // The compression format. If unset, gzip is used
+	level        int                // The 'compress/flate' compression level. If unset, the default level is used
+	inBackground bool               // If true, files are compressed in the background instead of blocking the caller
+}
+
+// fileCompressor compresses old log files, either right away or in the background
+type fileCompressor struct {
+	osHandle     afero.Fs           // The filesystem the log files live on
+	options      compressionOptions // The settings files are compressed with, with defaults filled in
+	pending      sync.WaitGroup     // Tracks the compressions running in the background
+	mux          sync.Mutex         // Guards 'inProgress', 'onCompressed' and 'unreported'
+	inProgress   map[string]bool    // The files being compressed in the background
+	onCompressed func(err error)    // Called after each background compression with its outcome, if set
+	unreported   []error            // The outcomes of background compressions that finished before 'onCompressed' was set
+}
+
+// newFileCompressor returns a compressor for files on the filesystem 'osPtr'
+func newFileCompressor(osPtr afero.Fs, options compressionOptions) *fileCompressor {
+	if options.compression == 0 {
+		options.compression = CompressionGzip
+	}
+
+	if options.level == 0 {
+		options.level = flate.DefaultCompression
+	}
+
+	return &fileCompressor{osHandle: osPtr, options: options, inProgress: make(map[string]bool)}
+}
+
+// archivePath returns the path the file at 'filePath' is compressed to
+func (compressor *fileCompressor) archivePath(filePath string) string {
+	return filePath + compressor.options.compression.extension()
+}
+
+// compressStartupFile compresses the log file 'filePath' left over from an earlier run into a file named after it and
+// its last modified time. When compressing in the background, the file is first moved out of the way of the new log file
+func (compressor *fileCompressor) compressStartupFile(filePath string) error {
+	var stringBuilder strings.Builder
+
+	fileInfo, err := compressor.osHandle.Stat(filePath)
+	if err != nil {
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not stat file '")
+		stringBuilder.WriteString(filePath)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	// append file last modified time to make a unique, identifiable name
+	var fileModTime = fileInfo.ModTime()
+	var archiveBasePath = filePath + "." + fileModTime.Format(rotatedFileTimeFormat)
+
+	if !compressor.options.inBackground {
+		return compressFileTo(filePath, compressor.archivePath(archiveBasePath), compressor.osHandle, compressor.options)
+	}
+
+	err = compressor.osHandle.Rename(filePath, archiveBasePath)
+	if err != nil {
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not move log file '")
+		stringBuilder.WriteString(filePath)
+		stringBuilder.WriteString("' out of the way for compression because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	return compressor.compress(archiveBasePath)
+}
+
+// compress compresses the file at 'filePath' into its archive and deletes it. In the background, errors are handed to
+// 'onCompressed' instead of being returned
+func (compressor *fileCompressor) compress(filePath string) error {
+	if !compressor.options.inBackground {
+		return compressFileTo(filePath, compressor.archivePath(filePath), compressor.osHandle, compressor.options)
+	}
+
+	var archivePath = compressor.archivePath(filePath)
+
+	compressor.mux.Lock()
+	compressor.inProgress[filePath] = true
+	compressor.inProgress[archivePath] = true
+	compressor.mux.Unlock()
+
+	compressor.pending.Add(1)
+	go func() {
+		defer compressor.pending.Done()
+
+		err := compressFileTo(filePath, archivePath, compressor.osHandle, compressor.options)
+
+		compressor.mux.Lock()
+		delete(compressor.inProgress, filePath)
+		delete(compressor.inProgress, archivePath)
+		var onCompressed = compressor.onCompressed
+		if onCompressed == nil {
+			// the startup compression may finish before the file sink sets the function, which is then handed the outcome
+			compressor.unreported = append(compressor.unreported, err)
+		}
+		compressor.mux.Unlock()
+
+		if onCompressed != nil {
+			onCompressed(err)
+		}
+	}()
+
+	return nil
+}
+
+// isCompressing returns true if the file at 'filePath' is being compressed in the background, or is the archive being
+// written by such a compression
+func (compressor *fileCompressor) isCompressing(filePath string) bool {
+	compressor.mux.Lock()
+	defer compressor.mux.Unlock()
+
+	return compressor.inProgress[filePath]
+}
+
+// setOnCompressed sets the function called after each background compression, and calls it right away with the outcome
+// of every background compression that finished before it was set
+func (compressor *fileCompressor) setOnCompressed(onCompressed func(err error)) {
+	compressor.mux.Lock()
+	compressor.onCompressed = onCompressed
+	unreported := compressor.unreported
+	compressor.unreported = nil
+	compressor.mux.Unlock()
+
+	for _, err := range unreported {
+		onCompressed(err)
+	}
+}
+
+// wait blocks until every background compression has finished
+func (compressor *fileCompressor) wait() {
+	compressor.pending.Wait()
+}
+
+// func compressFileTo streams the file pointed to by 'filePath' into a compressed file at 'archivePath' and deletes it.
+// Both files live on 'osPtr'. If compression fails, the partial archive is deleted and the file is kept
+func compressFileTo(filePath string, archivePath string, osPtr afero.Fs, options compressionOptions) error {
+	var stringBuilder strings.Builder
+
+	fileHandle, err := osPtr.Open(filePath)
+	if err != nil {
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not open file '")
+		stringBuilder.WriteString(filePath)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+	defer fileHandle.Close()
+
+	fileInfo, err := fileHandle.Stat()
+	if err != nil {
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not get file info for '")
+		stringBuilder.WriteString(filePath)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	err = writeCompressedCopy(fileHandle, archivePath, fileInfo.Mode(), osPtr, options)
+	if err != nil {
+		osPtr.Remove(archivePath)
+
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not compress '")
+		stringBuilder.WriteString(filePath)
+		stringBuilder.WriteString("' into '")
+		stringBuilder.WriteString(archivePath)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	// delete source file
+	fileHandle.Close()
+	err = osPtr.Remove(filePath)
+	if err != nil {
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not delete log file '")
+		stringBuilder.WriteString(filePath)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	return nil
+}
+
+// func writeCompressedCopy streams 'source' into a new compressed file at 'archivePath' on 'osPtr', so files of any size
+// are compressed in constant memory
+func writeCompressedCopy(source io.Reader, archivePath string, mode os.FileMode, osPtr afero.Fs, options compressionOptions) error {
+	archiveHandle, err := osPtr.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer archiveHandle.Close()
+
+	compressWriter, err := options.compression.newWriter(archiveHandle, options.level)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(compressWriter, source)
+	if err != nil {
+		compressWriter.Close()
+		return err
+	}
+
+	// closing writes out the end of the compressed stream, so its error matters
+	err = compressWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	return archiveHandle.Close()
+}
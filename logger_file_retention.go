@@ -0,0 +1,143 @@
+/*
+	File holding functions related to enforcing the retention policy of log archives
+*/
+
+package golog
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// isArchiveName returns true if 'fileName' names an archive of the log file. Only the names given by 'rotatedFilePath'
+// are recognized: the log file's name followed by a timestamp, or the rotation schedule's filename pattern, either of
+// which may carry a sequence number and a compression extension. Other files next to the log file are never archives
+func (sink *fileSink) isArchiveName(fileName string) bool {
+	var baseName = fileName
+	for _, extension := range compressionExtensions {
+		if strings.HasSuffix(baseName, extension) {
+			baseName = strings.TrimSuffix(baseName, extension)
+			break
+		}
+	}
+
+	if sink.isArchiveBaseName(baseName) {
+		return true
+	}
+
+	// strip the sequence number added to names that were taken
+	if dotIndex := strings.LastIndexByte(baseName, '.'); dotIndex >= 0 && isSequenceNumber(baseName[dotIndex+1:]) {
+		return sink.isArchiveBaseName(baseName[:dotIndex])
+	}
+
+	return false
+}
+
+// isArchiveBaseName returns true if 'baseName' is a name 'rotatedFilePath' starts from, before any sequence number
+func (sink *fileSink) isArchiveBaseName(baseName string) bool {
+	var logFilePrefix = filepath.Base(sink.filePath) + "."
+	if strings.HasPrefix(baseName, logFilePrefix) {
+		if _, err := time.Parse(rotatedFileTimeFormat, strings.TrimPrefix(baseName, logFilePrefix)); err == nil {
+			return true
+		}
+	}
+
+	if sink.options.rotationSchedule == nil || sink.options.rotationSchedule.FilenamePattern == "" {
+		return false
+	}
+
+	_, err := time.Parse(sink.options.rotationSchedule.FilenamePattern, baseName)
+	return err == nil
+}
+
+// isSequenceNumber returns true if 's' is a non-empty string of digits
+func isSequenceNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findArchives returns the archives of the log file found in its directory
+func (sink *fileSink) findArchives() ([]logArchive, error) {
+	var stringBuilder strings.Builder
+
+	var logDirectory = filepath.Dir(sink.filePath)
+	fileInfos, err := afero.ReadDir(sink.osHandle, logDirectory)
+	if err != nil {
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not list log directory '")
+		stringBuilder.WriteString(logDirectory)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return nil, errors.New(stringBuilder.String())
+	}
+
+	var archives []logArchive
+	for _, fileInfo := range fileInfos {
+		var archivePath = filepath.Join(logDirectory, fileInfo.Name())
+
+		// files being compressed are left alone until their archive is complete
+		if !fileInfo.IsDir() && sink.isArchiveName(fileInfo.Name()) && !sink.options.compressor.isCompressing(archivePath) {
+			archives = append(archives, logArchive{archivePath, fileInfo.Size(), fileInfo.ModTime()})
+		}
+	}
+
+	return archives, nil
+}
+
+// enforceRetention deletes the archives the retention policy no longer keeps, oldest first, and writes a line to the
+// log file for each one. Archives that can't be deleted are reported as a warning rather than an error. The caller must
+// hold 'mux', unless the sink is still being created
+func (sink *fileSink) enforceRetention() error {
+	var stringBuilder strings.Builder
+
+	if sink.options.retentionPolicy == nil {
+		return nil
+	}
+
+	archives, err := sink.findArchives()
+	if err != nil {
+		return err
+	}
+
+	var now = sink.options.clock()
+	for _, archive := range sink.options.retentionPolicy.expiredArchives(archives, sink.fileSize, now) {
+		var level = LevelInfo
+		stringBuilder.Reset()
+
+		// an archive that can't be deleted is kept, it is tried again the next time the policy is enforced
+		if removeErr := sink.osHandle.Remove(archive.path); removeErr != nil {
+			level = LevelWarn
+
+			stringBuilder.WriteString("Could not delete log archive '")
+			stringBuilder.WriteString(archive.path)
+			stringBuilder.WriteString("' to enforce the retention policy because: ")
+			stringBuilder.WriteString(removeErr.Error())
+		} else {
+			stringBuilder.WriteString("Deleted log archive '")
+			stringBuilder.WriteString(archive.path)
+			stringBuilder.WriteString("' to enforce the retention policy")
+		}
+
+		err = sink.writeBytes(sink.formatter.Format(Record{Time: now, Level: level, Message: stringBuilder.String()}))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
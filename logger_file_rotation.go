@@ -0,0 +1,168 @@
+/*
+	File holding functions related to rotating log files
+*/
+
+package golog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotatedFileTimeFormat is the layout of the timestamp suffix given to rotated log files
+const rotatedFileTimeFormat = "20060102150405"
+
+// resetter is implemented by formatters that must start over when they write to a new file, such as the binary one
+type resetter interface {
+	Reset()
+}
+
+// shouldRotateForSize returns true if writing 'recordSize' more bytes would grow the log file past its maximum size. A
+// record is never split, and one that is larger than the maximum size on its own is written to an empty file
+func (sink *fileSink) shouldRotateForSize(recordSize int) bool {
+	if sink.options.maxFileSizeBytes <= 0 || sink.fileSize == 0 {
+		return false
+	}
+
+	return sink.fileSize+int64(recordSize) > sink.options.maxFileSizeBytes
+}
+
+// shouldRotateForSchedule returns true if a record logged at 'recordTime' belongs to a later rotation period than the
+// log file. An empty log file is never rotated, it is simply carried over to the new period
+func (sink *fileSink) shouldRotateForSchedule(recordTime time.Time) bool {
+	if sink.options.rotationSchedule == nil {
+		return false
+	}
+
+	if sink.periodStart.IsZero() || (sink.fileSize == 0 && recordTime.After(sink.periodStart)) {
+		sink.startPeriod(recordTime)
+		return false
+	}
+
+	return !recordTime.Before(sink.nextRotation)
+}
+
+// startPeriod makes the log file cover the rotation period 'periodTime' falls in
+func (sink *fileSink) startPeriod(periodTime time.Time) {
+	sink.periodStart = sink.options.rotationSchedule.periodStart(periodTime)
+	sink.nextRotation = sink.options.rotationSchedule.nextPeriodStart(sink.periodStart)
+}
+
+// rotatedFilePath returns the unused path the log file is renamed to when rotated. 'rotationTime' is formatted with the
+// rotation schedule's filename pattern if there is one, or else appended to the log file's path. A sequence number is
+// appended if the resulting file already exists
+func (sink *fileSink) rotatedFilePath(rotationTime time.Time) string {
+	var basePath = sink.filePath + "." + rotationTime.Format(rotatedFileTimeFormat)
+	if sink.options.rotationSchedule != nil && sink.options.rotationSchedule.FilenamePattern != "" {
+		basePath = filepath.Join(filepath.Dir(sink.filePath), rotationTime.Format(sink.options.rotationSchedule.FilenamePattern))
+	}
+
+	var rotatedPath = basePath
+	for sequence := 1; sink.rotatedFileExists(rotatedPath); sequence++ {
+		rotatedPath = basePath + "." + strconv.Itoa(sequence)
+	}
+
+	return rotatedPath
+}
+
+// rotatedFileExists returns true if 'rotatedPath', or a compressed version of it, exists
+func (sink *fileSink) rotatedFileExists(rotatedPath string) bool {
+	if _, err := sink.osHandle.Stat(rotatedPath); !os.IsNotExist(err) {
+		return true
+	}
+
+	for _, extension := range compressionExtensions {
+		if _, err := sink.osHandle.Stat(rotatedPath + extension); !os.IsNotExist(err) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rotate closes the log file, renames it out of the way, compresses it if configured to and continues in a new log file.
+// 'rotationTime' names the rotated file ( see 'rotatedFilePath' ). Failing to rename, compress or prune archives does not
+// stop logging, the failure is written to the new log file instead. An error is only returned if there is no log file
+// left to write to. The caller must hold 'mux'
+func (sink *fileSink) rotate(rotationTime time.Time) error {
+	var stringBuilder strings.Builder
+
+	err := sink.flush()
+	if err != nil {
+		return err
+	}
+	sink.file.Close()
+
+	var rotatedPath = sink.rotatedFilePath(rotationTime)
+	renameErr := sink.osHandle.Rename(sink.filePath, rotatedPath)
+
+	// keep logging even if the old file could not be moved, it is then appended to
+	err = sink.open()
+	if err != nil {
+		return err
+	}
+
+	if formatter, ok := sink.formatter.(resetter); ok {
+		formatter.Reset()
+	}
+
+	if renameErr != nil {
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Could not rotate log file '")
+		stringBuilder.WriteString(sink.filePath)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(renameErr.Error())
+
+		sink.reportError(errors.New(stringBuilder.String()))
+
+		// count the kept file as empty, so the next attempt waits for it to grow by another 'maxFileSizeBytes' rather
+		// than failing again for every record
+		sink.fileSize = 0
+		return nil
+	}
+
+	if sink.options.compressRotatedLog {
+		err = sink.options.compressor.compress(rotatedPath)
+		if err != nil {
+			sink.reportError(err)
+		}
+	}
+
+	err = sink.enforceRetention()
+	if err != nil {
+		sink.reportError(err)
+	}
+
+	return nil
+}
+
+// reportError writes 'err' to the log file as an error record. A failure to write it is left for the next write to
+// report. The caller must hold 'mux'
+func (sink *fileSink) reportError(err error) {
+	sink.writeBytes(sink.formatter.Format(Record{Time: sink.options.clock(), Level: LevelErr, Message: err.Error()}))
+}
+
+// handleCompressed is called after a rotated log file was compressed in the background. It writes any error to the log
+// file and enforces the retention policy, which skipped the file while it was being compressed
+func (sink *fileSink) handleCompressed(compressErr error) {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.isClosed {
+		return
+	}
+
+	var err = compressErr
+	if err == nil {
+		err = sink.enforceRetention()
+	}
+
+	if err != nil {
+		sink.reportError(err)
+	}
+}
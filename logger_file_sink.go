@@ -0,0 +1,311 @@
+/*
+	File holding the sink that writes to log files
+*/
+
+package golog
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	defaultFileBufferSize    = 64 * 1024       // The number of bytes buffered before a log file is written to, if not configured
+	defaultFileFlushInterval = time.Second     // The longest a record stays buffered before it is written to the log file, if not configured
+	defaultFileCheckInterval = 5 * time.Second // How often the log file is checked for having been deleted or moved, if not configured
+)
+
+// fileSinkOptions holds the settings of a file sink. Zero values select the defaults
+type fileSinkOptions struct {
+	bufferSize         int               // The number of bytes buffered. A negative value disables buffering
+	flushInterval      time.Duration     // How often the buffer is flushed. A negative value disables the periodic flush
+	maxFileSizeBytes   int64             // The size the log file is rotated at. If not positive, the file is never rotated for its size
+	compressRotatedLog bool              // If true, rotated log files are compressed
+	rotationSchedule   *RotationSchedule // When the log file is rotated regardless of its size. If nil, it is only rotated for its size
+	retentionPolicy    *RetentionPolicy  // Limits the archives kept next to the log file. If nil, archives are never deleted
+	clock              func() time.Time  // Returns the current time. If nil, 'time.Now' is used
+	compressor         *fileCompressor   // Compresses rotated log files. If nil, they are compressed with gzip while the sink waits
+	checkInterval      time.Duration     // How often the log file is checked for having been deleted or moved. A negative value disables the check
+}
+
+// fileSink appends records to a log file. The file is opened once, and records are buffered before being written to
+// it. It is the sink behind 'ModeFile'
+type fileSink struct {
+	mux          sync.Mutex      // Serializes writes, so records are never interleaved
+	filePath     string          // The full path of the log file
+	osHandle     afero.Fs        // The filesystem the log file lives on
+	formatter    Formatter       // Renders each record
+	options      fileSinkOptions // The settings of the sink, with defaults filled in
+	file         afero.File      // The open log file
+	fileSize     int64           // The number of bytes written to the log file, including buffered ones
+	writer       *bufio.Writer   // Buffers writes to 'file'. nil if buffering is disabled
+	stopFlushing chan struct{}   // Closed to stop the periodic flush
+	isClosed     bool            // If true, the sink was closed and may not be written to
+	lastCheck    time.Time       // The last time the log file was checked for having been deleted or moved
+	periodStart  time.Time       // The start of the rotation period the log file covers. Only set if there is a rotation schedule
+	nextRotation time.Time       // The time from which records are written to a new log file. Only set if there is a rotation schedule
+}
+
+// NewFileSink returns a sink appending each record rendered by 'formatter' to the file at 'filePath', which is created
+// if it does not exist. Records are buffered and written to the file at least once a second
+func NewFileSink(filePath string, formatter Formatter) (Sink, error) {
+	return newFileSink(filePath, afero.NewOsFs(), formatter, fileSinkOptions{})
+}
+
+// newFileSink opens 'filePath' on the filesystem 'osPtr' for appending and returns a sink writing to it
+func newFileSink(filePath string, osPtr afero.Fs, formatter Formatter, options fileSinkOptions) (*fileSink, error) {
+	if options.bufferSize == 0 {
+		options.bufferSize = defaultFileBufferSize
+	}
+
+	if options.flushInterval == 0 {
+		options.flushInterval = defaultFileFlushInterval
+	}
+
+	if options.clock == nil {
+		options.clock = time.Now
+	}
+
+	if options.checkInterval == 0 {
+		options.checkInterval = defaultFileCheckInterval
+	}
+
+	if options.compressor == nil {
+		options.compressor = newFileCompressor(osPtr, compressionOptions{})
+	}
+
+	sink := &fileSink{filePath: filePath, osHandle: osPtr, formatter: formatter, options: options}
+
+	err := sink.open()
+	if err != nil {
+		return nil, err
+	}
+
+	options.compressor.setOnCompressed(sink.handleCompressed)
+
+	// archives may have piled up while the logger wasn't running
+	err = sink.enforceRetention()
+	if err != nil {
+		sink.file.Close()
+		return nil, err
+	}
+
+	if sink.writer != nil && options.flushInterval > 0 {
+		sink.stopFlushing = make(chan struct{})
+		go sink.flushPeriodically()
+	}
+
+	return sink, nil
+}
+
+// open opens the log file for appending, creating it if it does not exist
+func (sink *fileSink) open() error {
+	var stringBuilder strings.Builder
+
+	logHandle, err := sink.osHandle.OpenFile(sink.filePath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		// can't open file
+		stringBuilder.Reset()
+
+		stringBuilder.WriteString("Unable to open log file '")
+		stringBuilder.WriteString(sink.filePath)
+		stringBuilder.WriteString("' for writing because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	sink.file = logHandle
+	sink.fileSize = 0
+	if fileInfo, err := logHandle.Stat(); err == nil {
+		sink.fileSize = fileInfo.Size()
+
+		// a log file left over from an earlier period is rotated by the first record of the current one
+		if sink.options.rotationSchedule != nil && sink.fileSize > 0 && sink.periodStart.IsZero() {
+			sink.startPeriod(fileInfo.ModTime())
+		}
+	}
+
+	if sink.options.bufferSize > 0 && sink.writer == nil {
+		// the buffer writes to whichever file is open, so buffered records survive the file being replaced
+		sink.writer = bufio.NewWriterSize(fileSinkWriter{sink}, sink.options.bufferSize)
+	}
+	sink.lastCheck = sink.options.clock()
+
+	return nil
+}
+
+// flushPeriodically flushes the sink every flush interval until 'stopFlushing' is closed
+func (sink *fileSink) flushPeriodically() {
+	ticker := time.NewTicker(sink.options.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// a failed flush is reported by the next write, which hits the same error
+			sink.Flush()
+		case <-sink.stopFlushing:
+			return
+		}
+	}
+}
+
+// wrapWriteError returns 'err' prefixed with the path of the log file
+func (sink *fileSink) wrapWriteError(err error) error {
+	var stringBuilder strings.Builder
+
+	stringBuilder.WriteString("Unable to write to log file '")
+	stringBuilder.WriteString(sink.filePath)
+	stringBuilder.WriteString("' because: ")
+	stringBuilder.WriteString(err.Error())
+
+	return errors.New(stringBuilder.String())
+}
+
+func (sink *fileSink) Write(record Record) error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.isClosed {
+		return sink.wrapWriteError(errors.New("the sink is closed"))
+	}
+
+	if err := sink.checkFile(); err != nil {
+		return err
+	}
+
+	if sink.shouldRotateForSchedule(record.Time) {
+		// records are routed by the time they were logged at, so queued records end up in the file of their period
+		err := sink.rotate(sink.periodStart)
+		sink.startPeriod(record.Time)
+		if err != nil {
+			return err
+		}
+	}
+
+	recordBytes := sink.formatter.Format(record)
+	if sink.shouldRotateForSize(len(recordBytes)) {
+		if err := sink.rotate(record.Time); err != nil {
+			return err
+		}
+
+		// binary frames may refer to strings interned in the old file, so the record is encoded again
+		recordBytes = sink.formatter.Format(record)
+	}
+
+	return sink.writeBytes(recordBytes)
+}
+
+// writeBytes appends a formatted record to the log file. The caller must hold 'mux'
+func (sink *fileSink) writeBytes(recordBytes []byte) error {
+	var err error
+	var writtenBytes int
+	if sink.writer != nil {
+		writtenBytes, err = sink.writer.Write(recordBytes)
+	} else {
+		writtenBytes, err = sink.file.Write(recordBytes)
+	}
+	sink.fileSize += int64(writtenBytes)
+
+	if err != nil {
+		return sink.wrapWriteError(err)
+	}
+
+	return nil
+}
+
+func (sink *fileSink) Flush() error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.isClosed {
+		return nil
+	}
+
+	if err := sink.checkFile(); err != nil {
+		return err
+	}
+
+	return sink.flush()
+}
+
+// flush writes the buffered records to the log file. The caller must hold 'mux'
+func (sink *fileSink) flush() error {
+	if sink.isClosed || sink.writer == nil {
+		return nil
+	}
+
+	if err := sink.writer.Flush(); err != nil {
+		return sink.wrapWriteError(err)
+	}
+
+	return nil
+}
+
+func (sink *fileSink) Reopen() error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.isClosed {
+		return sink.wrapWriteError(errors.New("the sink is closed"))
+	}
+
+	err := sink.flush()
+	if err != nil {
+		return err
+	}
+	sink.file.Close()
+
+	err = sink.open()
+	if err != nil {
+		return err
+	}
+
+	// the file found at the path may be a new one, so binary logs start a new session
+	if formatter, ok := sink.formatter.(resetter); ok {
+		formatter.Reset()
+	}
+
+	return nil
+}
+
+func (sink *fileSink) Close() error {
+	// background compressions write to the log file when done, so they must finish first
+	sink.options.compressor.wait()
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.isClosed {
+		return nil
+	}
+
+	err := sink.flush()
+	sink.isClosed = true
+
+	if sink.stopFlushing != nil {
+		close(sink.stopFlushing)
+	}
+
+	if closeErr := sink.file.Close(); err == nil && closeErr != nil {
+		err = sink.wrapWriteError(closeErr)
+	}
+
+	return err
+}
+
+// fileSinkWriter writes to the file currently open by a file sink. The caller must hold the sink's 'mux'
+type fileSinkWriter struct {
+	sink *fileSink // The sink whose file is written to
+}
+
+func (writer fileSinkWriter) Write(p []byte) (int, error) {
+	return writer.sink.file.Write(p)
+}
@@ -0,0 +1,267 @@
+/*
+	File holding the JSON layouts expected by the platforms golog can log for
+*/
+
+package golog
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ecsVersion is the version of the Elastic Common Schema written by 'FormatECS'
+const ecsVersion = "1.6.0"
+
+// jsonSchema describes where a JSON format places each part of a log message
+type jsonSchema struct {
+	timeKey        string                                              // The key holding the RFC 3339 timestamp
+	levelKey       string                                              // The key holding the level
+	levelNames     map[LoggingLevel]string                             // The level names used by the schema. If nil, golog's level names are used
+	messageKey     string                                              // The key holding the log text
+	contextKey     string                                              // The key holding the logger's context
+	contextAsLabel bool                                                // If true, the context is written as the 'context' entry of an object under 'contextKey'
+	hostKey        string                                              // The key holding the hostname. If empty, the hostname is not written
+	traceKey       string                                              // The key the 'trace_id' field is written to
+	spanKey        string                                              // The key the 'span_id' field is written to
+	staticFields   []Field                                             // Keys written with a constant value in every document
+	reservedPrefix string                                              // Fields starting with this prefix are renamed so they can't be mistaken for platform keys
+	fieldsKey      string                                              // If set, fields are nested in an object under this key instead of at the top level
+	writeCaller    func(stringBuilder *strings.Builder, record Record) // Writes the source location keys, each preceded by a comma
+	callerKeys     []string                                            // The top level keys written by 'writeCaller'
+}
+
+var jsonSchemaGolog = jsonSchema{
+	timeKey:    "time",
+	levelKey:   "level",
+	messageKey: "message",
+	contextKey: "context",
+	hostKey:    "host",
+	traceKey:   "trace_id",
+	spanKey:    "span_id",
+	fieldsKey:  "fields",
+	writeCaller: func(stringBuilder *strings.Builder, record Record) {
+		stringBuilder.WriteString(`,"caller":{"file":`)
+		writeJSONString(stringBuilder, record.CallerFile)
+		stringBuilder.WriteString(`,"line":`)
+		stringBuilder.WriteString(strconv.Itoa(record.CallerLine))
+		stringBuilder.WriteString(`,"function":`)
+		writeJSONString(stringBuilder, record.CallerFunction)
+		stringBuilder.WriteString("}")
+	},
+	callerKeys: []string{"caller"},
+}
+
+var jsonSchemaGoogleCloud = jsonSchema{
+	timeKey:  "time",
+	levelKey: "severity",
+	levelNames: map[LoggingLevel]string{
+		LevelDebug: "DEBUG",
+		LevelInfo:  "INFO",
+		LevelWarn:  "WARNING",
+		LevelErr:   "ERROR",
+		LevelFatal: "CRITICAL",
+		LevelPanic: "ALERT",
+	},
+	messageKey:     "message",
+	contextKey:     "logging.googleapis.com/labels",
+	contextAsLabel: true,
+	reservedPrefix: "logging.googleapis.com/",
+	traceKey:       "logging.googleapis.com/trace",
+	spanKey:        "logging.googleapis.com/spanId",
+	writeCaller: func(stringBuilder *strings.Builder, record Record) {
+		// Cloud Logging expects the line as a string
+		stringBuilder.WriteString(`,"logging.googleapis.com/sourceLocation":{"file":`)
+		writeJSONString(stringBuilder, record.CallerFile)
+		stringBuilder.WriteString(`,"line":"`)
+		stringBuilder.WriteString(strconv.Itoa(record.CallerLine))
+		stringBuilder.WriteString(`","function":`)
+		writeJSONString(stringBuilder, record.CallerFunction)
+		stringBuilder.WriteString("}")
+	},
+	callerKeys: []string{"logging.googleapis.com/sourceLocation"},
+}
+
+var jsonSchemaECS = jsonSchema{
+	timeKey:  "@timestamp",
+	levelKey: "log.level",
+	levelNames: map[LoggingLevel]string{
+		LevelDebug: "debug",
+		LevelInfo:  "info",
+		LevelWarn:  "warning",
+		LevelErr:   "error",
+		LevelFatal: "fatal",
+		LevelPanic: "panic",
+	},
+	messageKey:   "message",
+	contextKey:   "log.logger",
+	hostKey:      "host.hostname",
+	traceKey:     "trace.id",
+	spanKey:      "span.id",
+	staticFields: []Field{{"ecs.version", ecsVersion}},
+	writeCaller: func(stringBuilder *strings.Builder, record Record) {
+		stringBuilder.WriteString(`,"log.origin.file.name":`)
+		writeJSONString(stringBuilder, record.CallerFile)
+		stringBuilder.WriteString(`,"log.origin.file.line":`)
+		stringBuilder.WriteString(strconv.Itoa(record.CallerLine))
+		stringBuilder.WriteString(`,"log.origin.function":`)
+		writeJSONString(stringBuilder, record.CallerFunction)
+	},
+	callerKeys: []string{"log.origin.file.name", "log.origin.file.line", "log.origin.function"},
+}
+
+var jsonSchemaDatadog = jsonSchema{
+	timeKey:  "date",
+	levelKey: "status",
+	levelNames: map[LoggingLevel]string{
+		LevelDebug: "debug",
+		LevelInfo:  "info",
+		LevelWarn:  "warning",
+		LevelErr:   "error",
+		LevelFatal: "critical",
+		LevelPanic: "alert",
+	},
+	messageKey: "message",
+	contextKey: "logger.name",
+	hostKey:    "host",
+	traceKey:   "dd.trace_id",
+	spanKey:    "dd.span_id",
+	writeCaller: func(stringBuilder *strings.Builder, record Record) {
+		stringBuilder.WriteString(`,"logger.method_name":`)
+		writeJSONString(stringBuilder, record.CallerFunction)
+		stringBuilder.WriteString(`,"logger.file_name":`)
+		writeJSONString(stringBuilder, record.CallerFile+":"+strconv.Itoa(record.CallerLine))
+	},
+	callerKeys: []string{"logger.method_name", "logger.file_name"},
+}
+
+// formatJSON renders 'record' as a single line JSON document laid out according to 'schema'
+func formatJSON(record Record, hostname string, schema jsonSchema) string {
+	var stringBuilder strings.Builder
+
+	var levelName = record.Level.String()
+	if schema.levelNames != nil {
+		levelName = schema.levelNames[record.Level]
+	}
+
+	stringBuilder.WriteString("{")
+	writeJSONString(&stringBuilder, schema.timeKey)
+	stringBuilder.WriteString(":")
+	writeJSONString(&stringBuilder, record.Time.Format(time.RFC3339Nano))
+	stringBuilder.WriteString(",")
+	writeJSONString(&stringBuilder, schema.levelKey)
+	stringBuilder.WriteString(":")
+	writeJSONString(&stringBuilder, levelName)
+	stringBuilder.WriteString(",")
+	writeJSONString(&stringBuilder, schema.messageKey)
+	stringBuilder.WriteString(":")
+	writeJSONString(&stringBuilder, record.Message)
+
+	for _, field := range schema.staticFields {
+		stringBuilder.WriteString(",")
+		writeJSONString(&stringBuilder, field.Key)
+		stringBuilder.WriteString(":")
+		writeJSONValue(&stringBuilder, field.Value)
+	}
+
+	if record.Context != "" {
+		stringBuilder.WriteString(",")
+		writeJSONString(&stringBuilder, schema.contextKey)
+		if schema.contextAsLabel {
+			stringBuilder.WriteString(`:{"context":`)
+			writeJSONString(&stringBuilder, record.Context)
+			stringBuilder.WriteString("}")
+		} else {
+			stringBuilder.WriteString(":")
+			writeJSONString(&stringBuilder, record.Context)
+		}
+	}
+
+	if schema.hostKey != "" {
+		stringBuilder.WriteString(",")
+		writeJSONString(&stringBuilder, schema.hostKey)
+		stringBuilder.WriteString(":")
+		writeJSONString(&stringBuilder, hostname)
+	}
+
+	var writtenKeys = map[string]bool{schema.timeKey: true, schema.levelKey: true, schema.messageKey: true, schema.contextKey: true, schema.hostKey: true}
+	for _, field := range schema.staticFields {
+		writtenKeys[field.Key] = true
+	}
+
+	if record.CallerFile != "" {
+		schema.writeCaller(&stringBuilder, record)
+		for _, key := range schema.callerKeys {
+			writtenKeys[key] = true
+		}
+	}
+
+	// trace correlation fields are moved to the keys the platform looks for
+	var otherFields = make([]Field, 0, len(record.Fields))
+	for _, field := range record.Fields {
+		var key = field.Key
+		if key == "trace_id" {
+			key = schema.traceKey
+		} else if key == "span_id" {
+			key = schema.spanKey
+		} else {
+			otherFields = append(otherFields, field)
+			continue
+		}
+		for writtenKeys[key] {
+			key = key + "_"
+		}
+
+		stringBuilder.WriteString(",")
+		writeJSONString(&stringBuilder, key)
+		stringBuilder.WriteString(":")
+		writeJSONString(&stringBuilder, fieldString(field.Value))
+		writtenKeys[key] = true
+	}
+
+	if schema.fieldsKey != "" {
+		if len(otherFields) > 0 {
+			stringBuilder.WriteString(",")
+			writeJSONString(&stringBuilder, schema.fieldsKey)
+			stringBuilder.WriteString(":{")
+
+			// the nested object has keys of its own, a repeated field key is renamed like at the top level
+			var nestedKeys = make(map[string]bool, len(otherFields))
+			for index, field := range otherFields {
+				var key = field.Key
+				for nestedKeys[key] {
+					key = key + "_"
+				}
+				nestedKeys[key] = true
+
+				if index > 0 {
+					stringBuilder.WriteString(",")
+				}
+				writeJSONString(&stringBuilder, key)
+				stringBuilder.WriteString(":")
+				writeJSONValue(&stringBuilder, field.Value)
+			}
+			stringBuilder.WriteString("}")
+		}
+	} else {
+		for _, field := range otherFields {
+			// a field may not overwrite a key the schema already wrote
+			var key = field.Key
+			if schema.reservedPrefix != "" && strings.HasPrefix(key, schema.reservedPrefix) {
+				key = "_" + key
+			}
+			for writtenKeys[key] {
+				key = key + "_"
+			}
+			writtenKeys[key] = true
+
+			stringBuilder.WriteString(",")
+			writeJSONString(&stringBuilder, key)
+			stringBuilder.WriteString(":")
+			writeJSONValue(&stringBuilder, field.Value)
+		}
+	}
+	stringBuilder.WriteString("}")
+
+	return stringBuilder.String()
+}
@@ -0,0 +1,443 @@
+/*
+	File holding the formatters that render records in each output format
+*/
+
+package golog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gnikonorov/golog/binlog"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// Formatter renders a record into the bytes a sink writes. Formatters returned by 'NewFormatter' terminate every
+// record with a newline, except for 'FormatBinary' which produces self delimiting frames
+type Formatter interface {
+	Format(record Record) []byte
+}
+
+// textFormatter renders records as 'FormatText' lines
+type textFormatter struct {
+	linePolicy     LoggingLinePolicy             // How newlines and control characters in log text are written
+	palette        map[LoggingLevel]LoggingColor // The color of each level. If nil, lines are not colorized
+	colorLevelOnly bool                          // If true, only the level token is colorized
+}
+
+// structuredFormatter renders records in one of the structured text formats, such as GELF, CEF and the JSON schemas
+type structuredFormatter struct {
+	format    LoggingFormat // The format records are rendered in
+	hostname  string        // The name of the host written into each record
+	cefConfig CEFConfig     // The CEF header values, with defaults applied
+}
+
+// binaryFormatter renders records as 'FormatBinary' frames. It is stateful, so it must only be used by a single sink
+// which serializes its calls to 'Format'
+type binaryFormatter struct {
+	encoder *binlog.Encoder // The encoder of the current session
+}
+
+// NewFormatter returns the formatter for 'format' with golog's defaults: text is not colorized and uses
+// 'LinePolicyEscape', and CEF headers use the default device values. An error is returned if 'format' is invalid
+func NewFormatter(format LoggingFormat) (Formatter, error) {
+	if !format.IsValidFormat() {
+		return nil, errors.New("Invalid log format provided. See formats in 'logging_formats.go'")
+	}
+
+	return newFormatter(format, LinePolicyEscape, resolveCEFConfig(CEFConfig{}), nil, false), nil
+}
+
+// newFormatter returns the formatter for 'format'. 'palette' and 'colorLevelOnly' only apply to 'FormatText'
+func newFormatter(format LoggingFormat, linePolicy LoggingLinePolicy, cefConfig CEFConfig, palette map[LoggingLevel]LoggingColor, colorLevelOnly bool) Formatter {
+	switch format {
+	case FormatText:
+		return &textFormatter{linePolicy, palette, colorLevelOnly}
+	case FormatBinary:
+		return &binaryFormatter{binlog.NewEncoder()}
+	}
+
+	return &structuredFormatter{format, getHostname(), cefConfig}
+}
+
+// Format renders 'record' as a '[time] LEVEL: context message' line
+func (formatter *textFormatter) Format(record Record) []byte {
+	// the log text is never interpreted as a format string. Newlines and control characters are handled by the line policy,
+	// with continuation lines indented past the '[time] LEVEL: context' header
+	var logTime = record.Time.String()
+	var headerWidth = utf8.RuneCountInString(logTime) + utf8.RuneCountInString(record.Level.String()) + utf8.RuneCountInString(record.Context) + 5
+	var logText = applyLinePolicy(record.Message, formatter.linePolicy, headerWidth)
+
+	var paintColor = formatter.palette[record.Level]
+	var resetColor = colorNone
+	if paintColor != colorNone {
+		resetColor = colorReset
+	}
+
+	var logStrings []string
+	if formatter.colorLevelOnly {
+		logStrings = []string{"[", logTime, "] ", paintColor.String(), record.Level.String(), resetColor.String(), ": ", record.Context, logText, "\n"}
+	} else {
+		logStrings = []string{paintColor.String(), "[", logTime, "] ", record.Level.String(), ": ", record.Context, logText, resetColor.String(), "\n"}
+	}
+
+	return []byte(strings.Join(logStrings, ""))
+}
+
+// Format renders 'record' in the formatter's structured format as a single line
+func (formatter *structuredFormatter) Format(record Record) []byte {
+	var logLine string
+
+	switch formatter.format {
+	case FormatGELF:
+		logLine = formatGELF(record, formatter.hostname)
+	case FormatCEF:
+		logLine = formatCEF(record, formatter.hostname, formatter.cefConfig)
+	case FormatGoogleCloud:
+		logLine = formatJSON(record, formatter.hostname, jsonSchemaGoogleCloud)
+	case FormatECS:
+		logLine = formatJSON(record, formatter.hostname, jsonSchemaECS)
+	case FormatDatadog:
+		logLine = formatJSON(record, formatter.hostname, jsonSchemaDatadog)
+	default:
+		logLine = formatJSON(record, formatter.hostname, jsonSchemaGolog)
+	}
+
+	return []byte(logLine + "\n")
+}
+
+// Format encodes 'record' into binary frames, preceded by any frames it depends on
+func (formatter *binaryFormatter) Format(record Record) []byte {
+	// the encoder reuses its buffer, so the frames are copied for sinks that hold on to them
+	frames := formatter.encoder.Encode(toBinaryRecord(record))
+	return append([]byte(nil), frames...)
+}
+
+// Reset starts a new binary session. It must be called whenever frames are written to a new destination
+func (formatter *binaryFormatter) Reset() {
+	formatter.encoder.Reset()
+}
+
+// writeJSONString writes 's' to 'stringBuilder' as a quoted JSON string
+func writeJSONString(stringBuilder *strings.Builder, s string) {
+	stringBuilder.WriteByte('"')
+	for index := 0; index < len(s); {
+		b := s[index]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\':
+				stringBuilder.WriteByte('\\')
+				stringBuilder.WriteByte(b)
+			case b == '\n':
+				stringBuilder.WriteString("\\n")
+			case b == '\r':
+				stringBuilder.WriteString("\\r")
+			case b == '\t':
+				stringBuilder.WriteString("\\t")
+			case b < 0x20 || b == 0x7F:
+				stringBuilder.WriteString("\\u00")
+				stringBuilder.WriteByte(hexDigits[b>>4])
+				stringBuilder.WriteByte(hexDigits[b&0xF])
+			default:
+				stringBuilder.WriteByte(b)
+			}
+			index++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[index:])
+		if r == utf8.RuneError && size == 1 {
+			stringBuilder.WriteString("\\ufffd")
+		} else {
+			stringBuilder.WriteString(s[index : index+size])
+		}
+		index += size
+	}
+	stringBuilder.WriteByte('"')
+}
+
+// fieldNumber returns the JSON number literal for 'value' and true if 'value' is a finite number
+func fieldNumber(value interface{}) (string, bool) {
+	switch typedValue := value.(type) {
+	case int:
+		return strconv.FormatInt(int64(typedValue), 10), true
+	case int8:
+		return strconv.FormatInt(int64(typedValue), 10), true
+	case int16:
+		return strconv.FormatInt(int64(typedValue), 10), true
+	case int32:
+		return strconv.FormatInt(int64(typedValue), 10), true
+	case int64:
+		return strconv.FormatInt(typedValue, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(typedValue), 10), true
+	case uint8:
+		return strconv.FormatUint(uint64(typedValue), 10), true
+	case uint16:
+		return strconv.FormatUint(uint64(typedValue), 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(typedValue), 10), true
+	case uint64:
+		return strconv.FormatUint(typedValue, 10), true
+	case float32:
+		return formatJSONFloat(float64(typedValue), 32)
+	case float64:
+		return formatJSONFloat(typedValue, 64)
+	}
+
+	return "", false
+}
+
+// formatJSONFloat formats 'value' as a JSON number. NaN and infinities have no JSON representation
+func formatJSONFloat(value float64, bitSize int) (string, bool) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", false
+	}
+
+	return strconv.FormatFloat(value, 'f', -1, bitSize), true
+}
+
+// fieldString returns the string representation of the field value 'value'
+func fieldString(value interface{}) string {
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue
+	case error:
+		return typedValue.Error()
+	case fmt.Stringer:
+		return typedValue.String()
+	}
+
+	return fmt.Sprint(value)
+}
+
+// writeJSONValue writes 'value' to 'stringBuilder' as JSON, preserving numbers, booleans and nested structures
+func writeJSONValue(stringBuilder *strings.Builder, value interface{}) {
+	if number, ok := fieldNumber(value); ok {
+		stringBuilder.WriteString(number)
+		return
+	}
+
+	switch typedValue := value.(type) {
+	case nil:
+		stringBuilder.WriteString("null")
+		return
+	case bool:
+		stringBuilder.WriteString(strconv.FormatBool(typedValue))
+		return
+	case string, error, fmt.Stringer:
+		writeJSONString(stringBuilder, fieldString(value))
+		return
+	}
+
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		writeJSONString(stringBuilder, fieldString(value))
+		return
+	}
+	stringBuilder.Write(jsonBytes)
+}
+
+// sanitizeFieldKey replaces every character of 'key' that is not accepted by 'isValidRune' with an underscore
+func sanitizeFieldKey(key string, isValidRune func(r rune) bool) string {
+	return strings.Map(func(r rune) rune {
+		if isValidRune(r) {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// isAlphanumericRune returns true if 'r' is an ASCII letter or digit
+func isAlphanumericRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// isGELFKeyRune returns true if 'r' is accepted in a GELF additional field name
+func isGELFKeyRune(r rune) bool {
+	return isAlphanumericRune(r) || r == '_' || r == '.' || r == '-'
+}
+
+// formatGELF renders 'record' as a GELF 1.1 JSON document
+func formatGELF(record Record, hostname string) string {
+	var stringBuilder strings.Builder
+
+	var shortMessage = record.Message
+	if newlineIndex := strings.IndexByte(shortMessage, '\n'); newlineIndex >= 0 {
+		shortMessage = shortMessage[:newlineIndex]
+	}
+
+	stringBuilder.WriteString(`{"version":"1.1","host":`)
+	writeJSONString(&stringBuilder, hostname)
+	stringBuilder.WriteString(`,"short_message":`)
+	writeJSONString(&stringBuilder, shortMessage)
+	if shortMessage != record.Message {
+		stringBuilder.WriteString(`,"full_message":`)
+		writeJSONString(&stringBuilder, record.Message)
+	}
+	stringBuilder.WriteString(`,"timestamp":`)
+	stringBuilder.WriteString(strconv.FormatFloat(float64(record.Time.UnixNano()/int64(1e6))/1e3, 'f', 3, 64))
+	stringBuilder.WriteString(`,"level":`)
+	stringBuilder.WriteString(strconv.Itoa(record.Level.syslogSeverity()))
+	stringBuilder.WriteString(`,"_level_name":`)
+	writeJSONString(&stringBuilder, record.Level.String())
+	var writtenKeys = map[string]bool{"level_name": true}
+	if record.Context != "" {
+		stringBuilder.WriteString(`,"_context":`)
+		writeJSONString(&stringBuilder, record.Context)
+		writtenKeys["context"] = true
+	}
+
+	for _, field := range record.Fields {
+		var key = sanitizeFieldKey(field.Key, isGELFKeyRune)
+		if key == "id" {
+			// '_id' is reserved by GELF
+			key = "id_"
+		}
+		for writtenKeys[key] {
+			key = key + "_"
+		}
+		writtenKeys[key] = true
+
+		stringBuilder.WriteString(`,"_`)
+		stringBuilder.WriteString(key)
+		stringBuilder.WriteString(`":`)
+
+		// GELF only allows strings and numbers as additional field values
+		if number, ok := fieldNumber(field.Value); ok {
+			stringBuilder.WriteString(number)
+		} else {
+			writeJSONString(&stringBuilder, fieldString(field.Value))
+		}
+	}
+	stringBuilder.WriteString("}")
+
+	return stringBuilder.String()
+}
+
+// escapeCEFHeader escapes a value placed in one of the pipe delimited CEF header fields
+func escapeCEFHeader(value string) string {
+	var stringBuilder strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			stringBuilder.WriteString("\\\\")
+		case '|':
+			stringBuilder.WriteString("\\|")
+		case '\r', '\n':
+			stringBuilder.WriteString(" ")
+		default:
+			writeCEFRune(&stringBuilder, r)
+		}
+	}
+
+	return stringBuilder.String()
+}
+
+// writeCEFRune writes 'r' to 'stringBuilder', spelling other control characters out behind an escaped backslash so
+// CEF parsers read them as text
+func writeCEFRune(stringBuilder *strings.Builder, r rune) {
+	if !isControlRune(r) {
+		stringBuilder.WriteRune(r)
+		return
+	}
+
+	stringBuilder.WriteString("\\")
+	writeEscapedRune(stringBuilder, r)
+}
+
+// escapeCEFExtension escapes a value placed in the key=value CEF extension
+func escapeCEFExtension(value string) string {
+	var stringBuilder strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			stringBuilder.WriteString("\\\\")
+		case '=':
+			stringBuilder.WriteString("\\=")
+		case '\n':
+			stringBuilder.WriteString("\\n")
+		case '\r':
+			stringBuilder.WriteString("\\r")
+		default:
+			writeCEFRune(&stringBuilder, r)
+		}
+	}
+
+	return stringBuilder.String()
+}
+
+// formatCEF renders 'record' as a CEF line
+func formatCEF(record Record, hostname string, cefConfig CEFConfig) string {
+	var stringBuilder strings.Builder
+
+	var name = record.Message
+	if newlineIndex := strings.IndexByte(name, '\n'); newlineIndex >= 0 {
+		name = name[:newlineIndex]
+	}
+
+	stringBuilder.WriteString("CEF:0|")
+	stringBuilder.WriteString(escapeCEFHeader(cefConfig.DeviceVendor))
+	stringBuilder.WriteString("|")
+	stringBuilder.WriteString(escapeCEFHeader(cefConfig.DeviceProduct))
+	stringBuilder.WriteString("|")
+	stringBuilder.WriteString(escapeCEFHeader(cefConfig.DeviceVersion))
+	stringBuilder.WriteString("|")
+	stringBuilder.WriteString(escapeCEFHeader(record.Level.String()))
+	stringBuilder.WriteString("|")
+	stringBuilder.WriteString(escapeCEFHeader(name))
+	stringBuilder.WriteString("|")
+	stringBuilder.WriteString(strconv.Itoa(record.Level.cefSeverity()))
+	stringBuilder.WriteString("|")
+
+	stringBuilder.WriteString("rt=")
+	stringBuilder.WriteString(strconv.FormatInt(record.Time.UnixNano()/int64(1e6), 10))
+	stringBuilder.WriteString(" dvchost=")
+	stringBuilder.WriteString(escapeCEFExtension(hostname))
+	var writtenKeys = map[string]bool{"rt": true, "dvchost": true, "msg": true}
+	if record.Context != "" {
+		stringBuilder.WriteString(" cat=")
+		stringBuilder.WriteString(escapeCEFExtension(record.Context))
+		writtenKeys["cat"] = true
+	}
+	stringBuilder.WriteString(" msg=")
+	stringBuilder.WriteString(escapeCEFExtension(record.Message))
+
+	for _, field := range record.Fields {
+		// an extension key may not be empty or repeat one already written
+		var key = sanitizeFieldKey(field.Key, isAlphanumericRune)
+		if key == "" {
+			key = "field"
+		}
+		for writtenKeys[key] {
+			key = key + "_"
+		}
+		writtenKeys[key] = true
+
+		stringBuilder.WriteString(" ")
+		stringBuilder.WriteString(key)
+		stringBuilder.WriteString("=")
+		stringBuilder.WriteString(escapeCEFExtension(fieldString(field.Value)))
+	}
+
+	return stringBuilder.String()
+}
+
+// toBinaryRecord converts 'record' into the record written by 'FormatBinary'
+func toBinaryRecord(record Record) binlog.Record {
+	binaryRecord := binlog.Record{Time: record.Time, Level: record.Level.String(), Context: record.Context, Message: record.Message}
+	if len(record.Fields) > 0 {
+		binaryRecord.Fields = make([]binlog.Field, len(record.Fields))
+		for index, field := range record.Fields {
+			binaryRecord.Fields[index] = binlog.Field{Key: field.Key, Value: field.Value}
+		}
+	}
+
+	return binaryRecord
+}
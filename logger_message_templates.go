@@ -0,0 +1,99 @@
+/*
+	File holding functions related to message templates with named placeholders
+*/
+
+package golog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+const (
+	templateField     = "message_template" // The field holding the raw template
+	templateHashField = "template_hash"    // The field holding the hash identifying the template's event shape
+)
+
+// isPlaceholderNameRune returns true if 'r' may be part of a placeholder name
+func isPlaceholderNameRune(r rune) bool {
+	return isAlphanumericRune(r) || r == '_' || r == '.' || r == '-'
+}
+
+// templateHash returns the stable hash of 'template' as 8 hex digits. The same template always hashes to the same
+// value, regardless of the arguments it is rendered with
+func templateHash(template string) string {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(template))
+
+	var hash = strconv.FormatUint(uint64(hasher.Sum32()), 16)
+	return strings.Repeat("0", 8-len(hash)) + hash
+}
+
+// renderTemplate replaces each '{name}' placeholder of 'template' with the next argument of 'args'. The rendered text
+// is returned along with a field for each placeholder that received an argument. A name used by several placeholders
+// keeps the argument of its first one as field. '{{' and '}}' are written as literal braces, and placeholders left
+// without an argument are written as is. Arguments without a placeholder are returned as fields named by their position
+func renderTemplate(template string, args []interface{}) (string, []Field) {
+	var stringBuilder strings.Builder
+	var fields []Field
+	var fieldNames = make(map[string]bool)
+	var argIndex = 0
+
+	for index := 0; index < len(template); index++ {
+		var c = template[index]
+
+		if (c == '{' || c == '}') && index+1 < len(template) && template[index+1] == c {
+			stringBuilder.WriteByte(c)
+			index++
+			continue
+		}
+
+		if c != '{' {
+			stringBuilder.WriteByte(c)
+			continue
+		}
+
+		var closingIndex = strings.IndexByte(template[index:], '}')
+		if closingIndex < 0 {
+			stringBuilder.WriteString(template[index:])
+			break
+		}
+
+		var name = template[index+1 : index+closingIndex]
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return !isPlaceholderNameRune(r) }) >= 0 || argIndex >= len(args) {
+			// not a placeholder we can fill, keep the text as is
+			stringBuilder.WriteString(template[index : index+closingIndex+1])
+			index += closingIndex
+			continue
+		}
+
+		stringBuilder.WriteString(fmt.Sprint(args[argIndex]))
+		if !fieldNames[name] {
+			fields = append(fields, Field{name, args[argIndex]})
+			fieldNames[name] = true
+		}
+		argIndex++
+		index += closingIndex
+	}
+
+	for ; argIndex < len(args); argIndex++ {
+		fields = append(fields, Field{"arg" + strconv.Itoa(argIndex), args[argIndex]})
+	}
+
+	return stringBuilder.String(), fields
+}
+
+// logTemplate renders 'template' with 'args' and logs the result at 'level'. The raw template, its hash and the named
+// arguments are attached to the message as fields
+func (logger *Logger) logTemplate(level LoggingLevel, template string, args []interface{}, shouldPanic bool) {
+	logText, templateFields := renderTemplate(template, args)
+
+	fields := make([]Field, 0, len(logger.fields)+len(templateFields)+2)
+	fields = append(fields, logger.fields...)
+	fields = append(fields, Field{templateField, template}, Field{templateHashField, templateHash(template)})
+	fields = append(fields, templateFields...)
+
+	logger.logWithFields(level, logText, fields, shouldPanic)
+}
@@ -0,0 +1,234 @@
+/*
+	File holding the minimal MessagePack encoder and decoder used by the Fluentd Forward output
+*/
+
+package golog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// appendMsgpackUint appends 'value' to 'buffer' in the smallest unsigned integer form
+func appendMsgpackUint(buffer []byte, value uint64) []byte {
+	switch {
+	case value < 0x80:
+		return append(buffer, byte(value))
+	case value <= math.MaxUint8:
+		return append(buffer, 0xcc, byte(value))
+	case value <= math.MaxUint16:
+		return append(buffer, 0xcd, byte(value>>8), byte(value))
+	case value <= math.MaxUint32:
+		return append(buffer, 0xce, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+	}
+
+	buffer = append(buffer, 0xcf)
+	return appendUint64BigEndian(buffer, value)
+}
+
+// appendMsgpackInt appends 'value' to 'buffer' in the smallest integer form
+func appendMsgpackInt(buffer []byte, value int64) []byte {
+	switch {
+	case value >= 0:
+		return appendMsgpackUint(buffer, uint64(value))
+	case value >= -32:
+		return append(buffer, byte(value))
+	case value >= math.MinInt8:
+		return append(buffer, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return append(buffer, 0xd1, byte(value>>8), byte(value))
+	case value >= math.MinInt32:
+		return append(buffer, 0xd2, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+	}
+
+	buffer = append(buffer, 0xd3)
+	return appendUint64BigEndian(buffer, uint64(value))
+}
+
+// appendUint64BigEndian appends the 8 bytes of 'value' to 'buffer', most significant first
+func appendUint64BigEndian(buffer []byte, value uint64) []byte {
+	var bytes [8]byte
+	binary.BigEndian.PutUint64(bytes[:], value)
+	return append(buffer, bytes[:]...)
+}
+
+// appendMsgpackHeader appends the header of a string, binary, array or map of 'length' entries to 'buffer'. 'fixBase'
+// and 'fixLimit' describe the single byte form, and 'codes' the 8, 16 and 32 bit forms, 0 where a form does not exist
+func appendMsgpackHeader(buffer []byte, length int, fixBase byte, fixLimit int, codes [3]byte) []byte {
+	switch {
+	case length < fixLimit:
+		return append(buffer, fixBase|byte(length))
+	case length <= math.MaxUint8 && codes[0] != 0:
+		return append(buffer, codes[0], byte(length))
+	case length <= math.MaxUint16:
+		return append(buffer, codes[1], byte(length>>8), byte(length))
+	}
+
+	return append(buffer, codes[2], byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+}
+
+// appendMsgpackString appends 'value' to 'buffer' as a string
+func appendMsgpackString(buffer []byte, value string) []byte {
+	buffer = appendMsgpackHeader(buffer, len(value), 0xa0, 32, [3]byte{0xd9, 0xda, 0xdb})
+	return append(buffer, value...)
+}
+
+// appendMsgpackBinary appends 'value' to 'buffer' as binary data
+func appendMsgpackBinary(buffer []byte, value []byte) []byte {
+	buffer = appendMsgpackHeader(buffer, len(value), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+	return append(buffer, value...)
+}
+
+// appendMsgpackArrayHeader appends the header of an array of 'length' elements to 'buffer'
+func appendMsgpackArrayHeader(buffer []byte, length int) []byte {
+	return appendMsgpackHeader(buffer, length, 0x90, 16, [3]byte{0, 0xdc, 0xdd})
+}
+
+// appendMsgpackMapHeader appends the header of a map of 'length' entries to 'buffer'
+func appendMsgpackMapHeader(buffer []byte, length int) []byte {
+	return appendMsgpackHeader(buffer, length, 0x80, 16, [3]byte{0, 0xde, 0xdf})
+}
+
+// appendMsgpackEventTime appends 't' to 'buffer' as a Fluentd EventTime: the extension type 0 holding the seconds and
+// nanoseconds as 32 bit big endian integers
+func appendMsgpackEventTime(buffer []byte, t time.Time) []byte {
+	seconds := uint32(t.Unix())
+	nanoseconds := uint32(t.Nanosecond())
+
+	return append(buffer, 0xd7, 0x00,
+		byte(seconds>>24), byte(seconds>>16), byte(seconds>>8), byte(seconds),
+		byte(nanoseconds>>24), byte(nanoseconds>>16), byte(nanoseconds>>8), byte(nanoseconds))
+}
+
+// appendMsgpackValue appends the field value 'value' to 'buffer', preserving numbers and booleans. Times are written as
+// RFC 3339 strings and any other value as its string representation
+func appendMsgpackValue(buffer []byte, value interface{}) []byte {
+	switch typedValue := value.(type) {
+	case nil:
+		return append(buffer, 0xc0)
+	case bool:
+		if typedValue {
+			return append(buffer, 0xc3)
+		}
+		return append(buffer, 0xc2)
+	case int:
+		return appendMsgpackInt(buffer, int64(typedValue))
+	case int8:
+		return appendMsgpackInt(buffer, int64(typedValue))
+	case int16:
+		return appendMsgpackInt(buffer, int64(typedValue))
+	case int32:
+		return appendMsgpackInt(buffer, int64(typedValue))
+	case int64:
+		return appendMsgpackInt(buffer, typedValue)
+	case uint:
+		return appendMsgpackUint(buffer, uint64(typedValue))
+	case uint8:
+		return appendMsgpackUint(buffer, uint64(typedValue))
+	case uint16:
+		return appendMsgpackUint(buffer, uint64(typedValue))
+	case uint32:
+		return appendMsgpackUint(buffer, uint64(typedValue))
+	case uint64:
+		return appendMsgpackUint(buffer, typedValue)
+	case float32:
+		buffer = append(buffer, 0xca)
+		bits := math.Float32bits(typedValue)
+		return append(buffer, byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+	case float64:
+		buffer = append(buffer, 0xcb)
+		return appendUint64BigEndian(buffer, math.Float64bits(typedValue))
+	case time.Time:
+		return appendMsgpackString(buffer, typedValue.Format(time.RFC3339Nano))
+	}
+
+	return appendMsgpackString(buffer, fieldString(value))
+}
+
+// readMsgpackLength reads the big endian length of 'size' bytes following a header byte from 'reader'
+func readMsgpackLength(reader io.Reader, size int) (int, error) {
+	var bytes [4]byte
+	if _, err := io.ReadFull(reader, bytes[4-size:]); err != nil {
+		return 0, err
+	}
+
+	return int(binary.BigEndian.Uint32(bytes[:])), nil
+}
+
+// readMsgpackString reads a string from 'reader'. Binary data is accepted as well
+func readMsgpackString(reader io.Reader) (string, error) {
+	var header [1]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return "", err
+	}
+
+	var length int
+	var err error
+	switch {
+	case header[0]&0xe0 == 0xa0:
+		length = int(header[0] & 0x1f)
+	case header[0] == 0xd9 || header[0] == 0xc4:
+		length, err = readMsgpackLength(reader, 1)
+	case header[0] == 0xda || header[0] == 0xc5:
+		length, err = readMsgpackLength(reader, 2)
+	case header[0] == 0xdb || header[0] == 0xc6:
+		length, err = readMsgpackLength(reader, 4)
+	default:
+		return "", fmt.Errorf("expected a MessagePack string but got the type 0x%02x", header[0])
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+// readMsgpackStringMap reads a map whose keys and values are all strings from 'reader', such as a Forward protocol ack
+func readMsgpackStringMap(reader io.Reader) (map[string]string, error) {
+	var header [1]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, err
+	}
+
+	var length int
+	var err error
+	switch {
+	case header[0]&0xf0 == 0x80:
+		length = int(header[0] & 0x0f)
+	case header[0] == 0xde:
+		length, err = readMsgpackLength(reader, 2)
+	default:
+		return nil, errors.New("expected a small MessagePack map")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]string, length)
+	for entry := 0; entry < length; entry++ {
+		key, err := readMsgpackString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readMsgpackString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		entries[key] = value
+	}
+
+	return entries, nil
+}
@@ -11,12 +11,15 @@ import (
 
 // queueManager is responsible for handling asynch logging
 type queueManager struct {
-	queue          *list.List // queue of messages to process for logging
-	                          // prefer list to array since array memory is never returned
-	isInitialized  bool       // if true, an instance of this structure has been initialized and is ready for use
-	isStarted      bool       // if true, the queue manager is already running
-	mux            sync.Mutex // used to lock the queue to prevent double reads
-	shouldShutDown bool       // if true, stop the queueManager since logger is shutting down
+	queue          *list.List    // queue of messages to process for logging
+	                             // prefer list to array since array memory is never returned
+	isInitialized  bool          // if true, an instance of this structure has been initialized and is ready for use
+	isStarted      bool          // if true, the queue manager is already running
+	mux            sync.Mutex    // used to lock the queue to prevent double reads
+	writeMux       sync.Mutex    // held while messages taken off the queue are written, so they are output in order
+	hasMessages    *sync.Cond    // signaled when messages are queued or the manager shuts down
+	shouldShutDown bool          // if true, stop the queueManager since logger is shutting down
+	stopped        chan struct{} // closed once 'processMessages' has returned
 }
 
 // enqueue adds a new log message to the message queue
@@ -25,13 +28,15 @@ func (mgr *queueManager) enqueue(loggingMessage logMessage) {
 		panic("Queue manager is uninitalized. Initalize before use.")
 	}
 
+	mgr.mux.Lock()
+	defer mgr.mux.Unlock()
+
 	if mgr.shouldShutDown {
 		return
 	}
 
-	mgr.mux.Lock()
 	mgr.queue.PushBack(loggingMessage)
-	mgr.mux.Unlock()
+	mgr.hasMessages.Signal()
 }
 
 func (mgr *queueManager) start() {
@@ -39,6 +44,9 @@ func (mgr *queueManager) start() {
 		panic("Queue manager is uninitalized. Initalize before use.")
 	}
 
+	mgr.mux.Lock()
+	defer mgr.mux.Unlock()
+
 	if mgr.shouldShutDown || mgr.isStarted {
 		return
 	}
@@ -52,49 +60,105 @@ func (mgr *queueManager) stop() {
 		panic("Queue manager is uninitalized. Initalize before use.")
 	}
 
+	mgr.mux.Lock()
 	if mgr.shouldShutDown {
+		mgr.mux.Unlock()
 		return
 	}
 	mgr.shouldShutDown = true
+	mgr.hasMessages.Broadcast()
+	var isStarted = mgr.isStarted
+	mgr.mux.Unlock()
+
+	if isStarted {
+		<-mgr.stopped
+	}
+
+	// output whatever was queued after the last batch was taken
+	mgr.flush()
+
+	mgr.isInitialized = false
+}
+
+// flush outputs every message currently in the queue before returning
+func (mgr *queueManager) flush() {
+	mgr.flushThen(nil)
+}
+
+// flushThen outputs every message currently in the queue and then calls 'action', if not nil, before any message queued
+// in the meantime is output
+func (mgr *queueManager) flushThen(action func()) {
+	mgr.writeMux.Lock()
+	defer mgr.writeMux.Unlock()
 
 	mgr.mux.Lock()
+	messages := mgr.takeMessages()
+	mgr.mux.Unlock()
+
+	for _, loggingMessage := range messages {
+		writeLog(loggingMessage)
+	}
+
+	if action != nil {
+		action()
+	}
+}
+
+// takeMessages removes every message from the queue and returns them in order. The caller must hold 'mux'
+func (mgr *queueManager) takeMessages() []logMessage {
+	messages := make([]logMessage, 0, mgr.queue.Len())
 	for mgr.queue.Len() > 0 {
 		node := mgr.queue.Front()
 		mgr.queue.Remove(node)
 
 		nodeValue := node.Value
-		loggingMessage := nodeValue.(logMessage)
-		writeLog(loggingMessage)
+		messages = append(messages, nodeValue.(logMessage))
 	}
-	mgr.mux.Unlock()
 
-	mgr.isInitialized = false
+	return messages
 }
 
-// processMessages takes messages off the queue and outputs them
+// processMessages waits for messages to be queued and outputs them until the manager shuts down
 func (mgr *queueManager) processMessages() {
 	if !mgr.isInitialized {
 		panic("Queue manager is uninitalized. Initalize before use.")
 	}
+	defer close(mgr.stopped)
 
 	for {
+		mgr.writeMux.Lock()
+
+		mgr.mux.Lock()
+		for mgr.queue.Len() == 0 && !mgr.shouldShutDown {
+			// release the write lock while idle so 'flush' isn't blocked
+			mgr.writeMux.Unlock()
+			mgr.hasMessages.Wait()
+			mgr.mux.Unlock()
+			mgr.writeMux.Lock()
+			mgr.mux.Lock()
+		}
+
 		if mgr.shouldShutDown {
+			mgr.mux.Unlock()
+			mgr.writeMux.Unlock()
 			return
 		}
 
-		mgr.mux.Lock()
-		for mgr.queue.Len() > 0 {
-			node := mgr.queue.Front()
-			mgr.queue.Remove(node)
+		// write outside of the queue lock so logging calls never wait on the output
+		messages := mgr.takeMessages()
+		mgr.mux.Unlock()
 
-			nodeValue := node.Value
-			loggingMessage := nodeValue.(logMessage)
+		for _, loggingMessage := range messages {
 			writeLog(loggingMessage)
 		}
-		mgr.mux.Unlock()
+
+		mgr.writeMux.Unlock()
 	}
 }
 
-func createQueueMgr() queueManager {
-	return queueManager{list.New(), true, false, sync.Mutex{}, false}
+func createQueueMgr() *queueManager {
+	mgr := &queueManager{queue: list.New(), isInitialized: true, stopped: make(chan struct{})}
+	mgr.hasMessages = sync.NewCond(&mgr.mux)
+
+	return mgr
 }
@@ -5,14 +5,12 @@
 package golog
 
 import (
-	"bufio"
-	"bytes"
-	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/afero"
 )
@@ -20,122 +18,69 @@ import (
 // Logger is representative of the logger for use in other go programs
 //
 // The following methods are exposed by this structure ( defined in golog.go ):
+//
 //	Debug(logText string): Log debug output to log destination
 //	Info(logText string): Log info output to log destination
 //	Warning(logText string): Log warning output to log destination
 //	Err(logText string): Log error output to log destination
 //	Fatal(logText string): Log fatal output to log destination
+//	DebugT, InfoT, WarningT, ErrT, FatalT, PanicT(template string, args ...interface{}): Log output rendered from a message template
 //	Is_Uninitialized: Returns true if this structure has not been allocated
 type Logger struct {
-	colorize         bool              // If true, print log output in color
 	context          string            // The context is the value prepended to each log line and set by the caller via 'SetContext'
 	loggingDirectory string            // The directory to store logs in
 	loggingFile      string            // The file to store logs in
 	loggingMode      LoggingOutputMode // The mode of the logger ( see 'logging_output_modes.go' )
 	osHandle         afero.Fs          // We are using afero to enable mocking and stubbing the native FS during tests.
 	isAsynch         bool              // If true, Asynchly handle log requests
-	queueMgr         queueManager      // The asynch message handler, populated only if 'isAsynch' is true
+	queueMgr         *queueManager     // The asynch message handler, populated only if 'isAsynch' is true
+	format           LoggingFormat     // The format log lines are rendered in ( see 'logging_formats.go' )
+	fields           []Field           // The fields attached to every log message via 'SetField'
+	captureCaller    bool              // If true, the source location of every log call is captured for the format
+	sinks            []Sink            // The destinations every record is written to, built-in ones first
+	clock            func() time.Time  // Returns the time records are logged at
+	signalHandler    *signalHandler    // Reopens the log files on SIGHUP. nil unless 'ReopenOnSIGHUP' was set
+	subscriptions    *subscriptionHub  // The consumers streaming records via 'Subscribe'
 }
 
 // LoggingConfig holds a logging configuration for the logger and is used during logger initialization
 type LoggingConfig struct {
-	Name                 string            // The logger profile name
-	LogMode              LoggingOutputMode // The logging mode
-	LogFileStartupAction LoggingFileAction // The action the logger will take on startup
-	LogDirectory         string            // The directory to which the logger writes
-	LogFile              string            // The name of the log file to write to
-	ShouldColorize       bool              // Indicates if we should output information in color
-	IsMock               bool              // If true, mock the filesystem via 'afero'
-	IsAsynch             bool              // If true, Asynchly handle log requests
-}
-
-// func compressFile compresses the file pointed to by 'filePath'
-func compressFile(filePath string, osPtr afero.Fs) {
-	var stringBuilder strings.Builder
-
-	fileHandle, err := osPtr.Open(filePath)
-	if err != nil {
-		stringBuilder.Reset()
-
-		stringBuilder.WriteString("Could not stat file '")
-		stringBuilder.WriteString(filePath)
-		stringBuilder.WriteString("' because: ")
-		stringBuilder.WriteString(err.Error())
-
-		panic(stringBuilder.String())
-	}
-	defer fileHandle.Close()
-
-	fileInfo, err := fileHandle.Stat()
-	if err != nil {
-		stringBuilder.Reset()
-
-		stringBuilder.WriteString("Could not get file info for '")
-		stringBuilder.WriteString(filePath)
-		stringBuilder.WriteString("' because: ")
-		stringBuilder.WriteString(err.Error())
-
-		panic(stringBuilder.String())
-	}
-	var fileSize = fileInfo.Size()
-
-	// get file contents
-	fileBytes := make([]byte, fileSize)
-	fileReader := bufio.NewReader(fileHandle)
-	_, err = fileReader.Read(fileBytes)
-	if err != nil {
-		stringBuilder.Reset()
-
-		stringBuilder.WriteString("Could not get file bytes of '")
-		stringBuilder.WriteString(filePath)
-		stringBuilder.WriteString("' because: ")
-		stringBuilder.WriteString(err.Error())
-
-		panic(stringBuilder.String())
-	}
-
-	// write out .gz file, appending file last modified time to make a unique, identifiable name
-	var byteBuffer bytes.Buffer
-	zipWriter := gzip.NewWriter(&byteBuffer)
-	zipWriter.Write(fileBytes)
-	zipWriter.Close()
-
-	var fileModTime = fileInfo.ModTime()
-	var fileModTimeString = fileModTime.Format("20060102150405")
-
-	stringBuilder.Reset()
-
-	stringBuilder.WriteString(filePath)
-	stringBuilder.WriteString(".")
-	stringBuilder.WriteString(fileModTimeString)
-	stringBuilder.WriteString(".gz")
-
-	var gzipFileName = stringBuilder.String()
-	err = ioutil.WriteFile(gzipFileName, byteBuffer.Bytes(), fileInfo.Mode())
-	if err != nil {
-		stringBuilder.Reset()
-
-		stringBuilder.WriteString("Could not create zip of '")
-		stringBuilder.WriteString(filePath)
-		stringBuilder.WriteString("' because: ")
-		stringBuilder.WriteString(err.Error())
-
-		panic(stringBuilder.String())
-	}
-
-	// delete source file
-	err = osPtr.Remove(filePath)
-	if err != nil {
-		stringBuilder.Reset()
-
-		stringBuilder.WriteString("Could not delete log file '")
-		stringBuilder.WriteString(filePath)
-		stringBuilder.WriteString("' because: ")
-		stringBuilder.WriteString(err.Error())
-
-		panic(stringBuilder.String())
-	}
-
+	Name                 string               // The logger profile name
+	LogMode              LoggingOutputMode    // The logging mode. May be left unset if another output, such as 'Sinks', is set
+	LogFileStartupAction LoggingFileAction    // The action the logger will take on startup
+	LogDirectory         string               // The directory to which the logger writes
+	LogFile              string               // The name of the log file to write to
+	ShouldColorize       bool                 // Indicates if we should output information in color
+	IsMock               bool                 // If true, mock the filesystem via 'afero'
+	IsAsynch             bool                 // If true, Asynchly handle log requests
+	Theme                *LoggingTheme        // The colors used when colorizing output. If nil, 'DefaultTheme()' is used
+	ColorLevelOnly       bool                 // If true, only the level token is colorized instead of the whole line
+	LinePolicy           LoggingLinePolicy    // How newlines and control characters in log text are written. If unset, 'LinePolicyEscape' is used
+	LogFormat            LoggingFormat        // The format log lines are written in. If unset, 'FormatText' is used
+	CEF                  CEFConfig            // The CEF header values used when 'LogFormat' is 'FormatCEF'
+	ScreenLevels         LevelFilter          // The levels written to the screen. If unset, every level is written
+	FileLevels           LevelFilter          // The levels written to the log file. If unset, every level is written
+	FileBufferSize       int                  // The number of bytes buffered before writing to the log file. If unset, 64 KiB is used. A negative value disables buffering
+	FileFlushInterval    time.Duration        // How often buffered records are written to the log file. If unset, one second is used. A negative value only flushes full buffers
+	FileCheckInterval    time.Duration        // How often the log file is checked for having been deleted or moved, in which case it is recreated. If unset, 5 seconds is used. A negative value disables the check
+	MaxFileSizeBytes     int64                // The size at which the log file is rotated. If unset, the log file is never rotated for its size
+	CompressRotatedFiles bool                 // If true, rotated log files are compressed
+	Compression          LoggingCompression   // The format old log files are compressed in. If unset, 'CompressionGzip' is used
+	CompressionLevel     int                  // The compression level, from 1 ( fastest ) to 9 ( smallest ). If unset, the default level is used
+	CompressInBackground bool                 // If true, old log files are compressed in the background instead of delaying setup and logging
+	Rotation             *RotationSchedule    // When the log file is rotated regardless of its size. If nil, it is only rotated for its size
+	Retention            *RetentionPolicy     // Limits the rotated and compressed log files kept. If nil, they are never deleted
+	Clock                func() time.Time     `json:"-"` // Returns the time records are logged at. If nil, 'time.Now' is used
+	ReopenOnSIGHUP       bool                 // If true, the log files are reopened whenever the process receives SIGHUP ( see 'Reopen' )
+	Syslog               *SyslogConfig        // The syslog daemon records are also written to. If nil, nothing is written to syslog
+	Journald             *JournaldConfig      // The systemd journal records are also written to. If nil, nothing is written to the journal
+	Network              *NetworkConfig       // The collector records are also shipped to over TCP or UDP. If nil, nothing is shipped
+	HTTP                 *HTTPConfig          // The endpoint batches of records are also posted to. If nil, nothing is posted
+	Loki                 *LokiConfig          // The Grafana Loki records are also pushed to. If nil, nothing is pushed
+	Elasticsearch        *ElasticsearchConfig // The Elasticsearch or OpenSearch cluster records are also indexed into. If nil, nothing is indexed
+	Fluent               *FluentConfig        // The Fluentd or Fluent Bit server records are also forwarded to. If nil, nothing is forwarded
+	RingBuffer           *RingBufferConfig    // The in-memory buffer the most recent records are also kept in, to be looked at with 'Query'. If nil, nothing is kept
+	Sinks                []Sink               `json:"-"` // Additional destinations written to after the ones selected by 'LogMode'. Wrap them with 'NewFilteredSink' to filter levels
 }
 
 // func doesLoggingFileExist checks to make sure that file 'fullPathToLogFile' exists and returns assertion of its existance
@@ -169,6 +114,31 @@ func doesLoggingFileExist(fullPathToLogFile string, osPtr afero.Fs) bool {
 	return true
 }
 
+// func getHostname returns the name of the host the logger runs on, or 'localhost' if it can not be determined
+func getHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "localhost"
+	}
+
+	return hostname
+}
+
+// func resolveCEFConfig returns 'cefConfig' with every empty header value replaced by its default
+func resolveCEFConfig(cefConfig CEFConfig) CEFConfig {
+	if cefConfig.DeviceVendor == "" {
+		cefConfig.DeviceVendor = "golog"
+	}
+	if cefConfig.DeviceProduct == "" {
+		cefConfig.DeviceProduct = "golog"
+	}
+	if cefConfig.DeviceVersion == "" {
+		cefConfig.DeviceVersion = "1.0"
+	}
+
+	return cefConfig
+}
+
 // func getOSPtr returns a pointer to the os file system we are using. Choices are native filesystem or an in memory map
 // based on the value of 'isMock'
 func getOSPtr(isMock bool) afero.Fs {
@@ -182,7 +152,7 @@ func getOSPtr(isMock bool) afero.Fs {
 
 // func handleOldLogFile performs any necessary setup work on existing log files, if we are logging to a file based off the logging
 // output mode
-func handleOldLogFile(logMode LoggingOutputMode, logDirectory string, logFile string, logFileStartupAction LoggingFileAction, osPtr afero.Fs) error {
+func handleOldLogFile(logMode LoggingOutputMode, logDirectory string, logFile string, logFileStartupAction LoggingFileAction, osPtr afero.Fs, compressor *fileCompressor) error {
 	var stringBuilder strings.Builder
 
 	if logMode == ModeFile || logMode == ModeBoth {
@@ -199,7 +169,10 @@ func handleOldLogFile(logMode LoggingOutputMode, logDirectory string, logFile st
 		if fileExists {
 			if logFileStartupAction == FileActionCompress {
 				// compress the file
-				compressFile(fullPathToLogFile, osPtr)
+				err := compressor.compressStartupFile(fullPathToLogFile)
+				if err != nil {
+					return err
+				}
 			} else if logFileStartupAction == FileActionDelete {
 				// delete the file
 				err := osPtr.Remove(fullPathToLogFile)
@@ -285,7 +258,7 @@ func validateLogDirectory(logDirectory string, logMode LoggingOutputMode, osPtr
 // func validateLoggerConfig validate a loggers configuration as valid. If a configuration is invalid,
 // an error is returned. Else, nil is returned
 func validateLoggerConfig(logMode LoggingOutputMode, logDirectory string, logFile string, logFileStartupAction LoggingFileAction, osPtr afero.Fs) error {
-	if !logMode.IsValidMode() {
+	if !logMode.IsValidMode() && logMode != modeSinksOnly {
 		return errors.New("Invalid log mode provided. See log modes in 'logging_output_modes.go'")
 	}
 
@@ -303,8 +276,8 @@ func validateLoggerConfig(logMode LoggingOutputMode, logDirectory string, logFil
 
 // func SetupLoggerFromConfigFile sets up and returns a logger instance as specified in 'fullFilePath' for 'profile'
 func SetupLoggerFromConfigFile(fullFilePath string, profile string) (Logger, error) {
-	var returnError   error
-	var logger        Logger
+	var returnError error
+	var logger Logger
 	var stringBuilder strings.Builder
 
 	// get bytes of file
@@ -339,26 +312,7 @@ func SetupLoggerFromConfigFile(fullFilePath string, profile string) (Logger, err
 
 	for _, config := range loggingConfigs {
 		if config.Name == profile {
-			osPtr := getOSPtr(config.IsMock)
-
-			returnError = validateLoggerConfig(config.LogMode, config.LogDirectory, config.LogFile, config.LogFileStartupAction, osPtr)
-			if returnError != nil {
-				return logger, returnError
-			}
-
-			returnError = handleOldLogFile(config.LogMode, config.LogDirectory, config.LogFile, config.LogFileStartupAction, osPtr)
-			if returnError != nil {
-				return logger, returnError
-			}
-
-			var queueMgr queueManager
-			if config.IsAsynch {
-				queueMgr = createQueueMgr()
-				queueMgr.start()
-			}
-
-			logger = Logger{loggingMode: config.LogMode, loggingDirectory: config.LogDirectory, loggingFile: config.LogFile, colorize: config.ShouldColorize, osHandle: osPtr, isAsynch: config.IsAsynch, queueMgr: queueMgr}
-			return logger, nil
+			return setupLogger(&config)
 		}
 	}
 
@@ -377,52 +331,249 @@ func SetupLoggerFromConfigFile(fullFilePath string, profile string) (Logger, err
 
 // func SetupLoggerFromFields sets up and returns a logger instance from passed in individual fields
 func SetupLoggerFromFields(logMode LoggingOutputMode, logFileStartupAction LoggingFileAction, logDirectory string, logFile string, shouldColorize bool, isMock bool, isAsynch bool) (Logger, error) {
+	config := LoggingConfig{LogMode: logMode, LogFileStartupAction: logFileStartupAction, LogDirectory: logDirectory, LogFile: logFile, ShouldColorize: shouldColorize, IsMock: isMock, IsAsynch: isAsynch}
+	return setupLogger(&config)
+}
+
+// func SetupLoggerFromStruct sets up and returns a logger instance from a LoggingConfigStruct
+func SetupLoggerFromStruct(config *LoggingConfig) (Logger, error) {
+	return setupLogger(config)
+}
+
+// func withLevelFilter returns 'sink' wrapped so it only receives the levels let through by 'filter'. If 'filter' lets
+// every level through, 'sink' is returned as is
+func withLevelFilter(sink Sink, filter LevelFilter) Sink {
+	if filter.MinLevel == "" && len(filter.Allow) == 0 && len(filter.Deny) == 0 {
+		return sink
+	}
+
+	return NewFilteredSink(sink, filter)
+}
+
+// func closeSinks closes every sink of 'sinks'. Used to release sinks created before setup failed
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		sink.Close()
+	}
+}
+
+// func setupLogger validates 'config', prepares any existing log file and returns a logger instance built from it.
+// All public setup methods funnel into this function
+func setupLogger(config *LoggingConfig) (Logger, error) {
 	var logger Logger
 
-	osPtr := getOSPtr(isMock)
+	osPtr := getOSPtr(config.IsMock)
+
+	var logMode = config.LogMode
+	if logMode == 0 && (config.Syslog != nil || config.Journald != nil || config.Network != nil || config.HTTP != nil || config.Loki != nil || config.Elasticsearch != nil || config.Fluent != nil || config.RingBuffer != nil || len(config.Sinks) > 0) {
+		logMode = modeSinksOnly
+	}
 
-	returnError := validateLoggerConfig(logMode, logDirectory, logFile, logFileStartupAction, osPtr)
+	returnError := validateLoggerConfig(logMode, config.LogDirectory, config.LogFile, config.LogFileStartupAction, osPtr)
 	if returnError != nil {
 		return logger, returnError
 	}
 
-	returnError = handleOldLogFile(logMode, logDirectory, logFile, logFileStartupAction, osPtr)
-	if returnError != nil {
+	var linePolicy = config.LinePolicy
+	if linePolicy == 0 {
+		linePolicy = LinePolicyEscape
+	} else if !linePolicy.IsValidLinePolicy() {
+		return logger, errors.New("Invalid line policy provided. See policies in 'logging_line_policies.go'")
+	}
+
+	var format = config.LogFormat
+	if format == 0 {
+		format = FormatText
+	} else if !format.IsValidFormat() {
+		return logger, errors.New("Invalid log format provided. See formats in 'logging_formats.go'")
+	} else if format == FormatBinary && logMode == ModeScreen {
+		return logger, errors.New("The binary log format only applies to log files. Use 'ModeFile' or 'ModeBoth'")
+	}
+
+	if returnError = config.ScreenLevels.validate(); returnError != nil {
 		return logger, returnError
 	}
 
-	var queueMgr queueManager
-	if isAsynch {
-		queueMgr = createQueueMgr()
-		queueMgr.start()
+	if returnError = config.FileLevels.validate(); returnError != nil {
+		return logger, returnError
 	}
 
-	logger = Logger{loggingMode: logMode, loggingDirectory: logDirectory, loggingFile: logFile, colorize: shouldColorize, osHandle: osPtr, isAsynch: isAsynch, queueMgr: queueMgr}
-	return logger, nil
-}
+	if config.Rotation != nil {
+		if returnError = config.Rotation.validate(); returnError != nil {
+			return logger, returnError
+		}
+	}
 
-// func SetupLoggerFromStruct sets up and returns a logger instance from a LoggingConfigStruct
-func SetupLoggerFromStruct(config *LoggingConfig) (Logger, error) {
-	var logger Logger
+	if config.Retention != nil {
+		if returnError = config.Retention.validate(); returnError != nil {
+			return logger, returnError
+		}
+	}
 
-	osPtr := getOSPtr(config.IsMock)
+	if config.Compression != 0 && !config.Compression.IsValidCompression() {
+		return logger, errors.New("Invalid compression format provided. See formats in 'logging_compression_formats.go'")
+	}
 
-	returnError := validateLoggerConfig(config.LogMode, config.LogDirectory, config.LogFile, config.LogFileStartupAction, osPtr)
+	if !isValidCompressionLevel(config.CompressionLevel) {
+		return logger, errors.New("Invalid compression level provided. Use a level from 1 to 9")
+	}
+
+	var clock = config.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+
+	var theme = DefaultTheme()
+	if config.Theme != nil {
+		theme = *config.Theme
+	}
+
+	palette, returnError := theme.palette()
 	if returnError != nil {
 		return logger, returnError
 	}
 
-	returnError = handleOldLogFile(config.LogMode, config.LogDirectory, config.LogFile, config.LogFileStartupAction, osPtr)
+	var ringBuffer *RingBuffer
+	if config.RingBuffer != nil {
+		ringBuffer, returnError = NewRingBuffer(*config.RingBuffer)
+		if returnError != nil {
+			return logger, returnError
+		}
+	}
+
+	// daemons are dialed before any file is touched so an unreachable daemon leaves the log file as it was
+	var remoteSinks []Sink
+	if config.Syslog != nil {
+		syslogSink, returnError := NewSyslogSink(*config.Syslog)
+		if returnError != nil {
+			return logger, returnError
+		}
+		remoteSinks = append(remoteSinks, syslogSink)
+	}
+
+	if config.Journald != nil {
+		journaldSink, returnError := NewJournaldSink(*config.Journald)
+		if returnError != nil {
+			closeSinks(remoteSinks)
+			return logger, returnError
+		}
+		remoteSinks = append(remoteSinks, journaldSink)
+	}
+
+	if config.Network != nil {
+		networkSink, returnError := newNetworkSink(*config.Network, osPtr)
+		if returnError != nil {
+			closeSinks(remoteSinks)
+			return logger, returnError
+		}
+		remoteSinks = append(remoteSinks, networkSink)
+	}
+
+	if config.HTTP != nil {
+		httpSink, returnError := newHTTPSink(*config.HTTP, osPtr)
+		if returnError != nil {
+			closeSinks(remoteSinks)
+			return logger, returnError
+		}
+		remoteSinks = append(remoteSinks, httpSink)
+	}
+
+	if config.Loki != nil {
+		lokiSink, returnError := newLokiSink(*config.Loki, osPtr)
+		if returnError != nil {
+			closeSinks(remoteSinks)
+			return logger, returnError
+		}
+		remoteSinks = append(remoteSinks, lokiSink)
+	}
+
+	if config.Elasticsearch != nil {
+		elasticsearchSink, returnError := newElasticsearchSink(*config.Elasticsearch, osPtr)
+		if returnError != nil {
+			closeSinks(remoteSinks)
+			return logger, returnError
+		}
+		remoteSinks = append(remoteSinks, elasticsearchSink)
+	}
+
+	if config.Fluent != nil {
+		fluentSink, returnError := newFluentSink(*config.Fluent, osPtr)
+		if returnError != nil {
+			closeSinks(remoteSinks)
+			return logger, returnError
+		}
+		remoteSinks = append(remoteSinks, fluentSink)
+	}
+
+	compressor := newFileCompressor(osPtr, compressionOptions{config.Compression, config.CompressionLevel, config.CompressInBackground})
+
+	returnError = handleOldLogFile(logMode, config.LogDirectory, config.LogFile, config.LogFileStartupAction, osPtr, compressor)
 	if returnError != nil {
+		closeSinks(remoteSinks)
 		return logger, returnError
 	}
 
-	var queueMgr queueManager
+	var cefConfig = resolveCEFConfig(config.CEF)
+	var sinks []Sink
+
+	if logMode == ModeScreen || logMode == ModeBoth {
+		// the screen always receives text when the file receives binary records
+		var screenFormat = format
+		if screenFormat == FormatBinary {
+			screenFormat = FormatText
+		}
+
+		var stdOutPalette, stdErrPalette map[LoggingLevel]LoggingColor
+		if config.ShouldColorize && shouldColorizeStream(os.Stdout) {
+			stdOutPalette = palette
+		}
+		if config.ShouldColorize && shouldColorizeStream(os.Stderr) {
+			stdErrPalette = palette
+		}
+
+		stdOutFormatter := newFormatter(screenFormat, linePolicy, cefConfig, stdOutPalette, config.ColorLevelOnly)
+		stdErrFormatter := newFormatter(screenFormat, linePolicy, cefConfig, stdErrPalette, config.ColorLevelOnly)
+		sinks = append(sinks, withLevelFilter(&screenSink{stdOutFormatter, stdErrFormatter}, config.ScreenLevels))
+	}
+
+	if logMode == ModeFile || logMode == ModeBoth {
+		fileFormatter := newFormatter(format, linePolicy, cefConfig, nil, false)
+		fileOptions := fileSinkOptions{config.FileBufferSize, config.FileFlushInterval, config.MaxFileSizeBytes, config.CompressRotatedFiles, config.Rotation, config.Retention, clock, compressor, config.FileCheckInterval}
+		fileSink, returnError := newFileSink(config.LogDirectory+"/"+config.LogFile, osPtr, fileFormatter, fileOptions)
+		if returnError != nil {
+			closeSinks(remoteSinks)
+			return logger, returnError
+		}
+		sinks = append(sinks, withLevelFilter(fileSink, config.FileLevels))
+	}
+
+	if ringBuffer != nil {
+		sinks = append(sinks, ringBuffer)
+	}
+
+	sinks = append(sinks, remoteSinks...)
+	sinks = append(sinks, config.Sinks...)
+
+	var queueMgr *queueManager
 	if config.IsAsynch {
 		queueMgr = createQueueMgr()
 		queueMgr.start()
 	}
 
-	logger = Logger{loggingMode: config.LogMode, loggingDirectory: config.LogDirectory, loggingFile: config.LogFile, colorize: config.ShouldColorize, osHandle: osPtr, isAsynch: config.IsAsynch, queueMgr: queueMgr}
+	logger = Logger{loggingMode: logMode, loggingDirectory: config.LogDirectory, loggingFile: config.LogFile, osHandle: osPtr, isAsynch: config.IsAsynch, queueMgr: queueMgr}
+	logger.format = format
+	logger.captureCaller = format.needsCaller()
+	for _, sink := range sinks {
+		if writer, ok := sink.(callerWriter); ok && writer.writesCaller() {
+			logger.captureCaller = true
+		}
+	}
+	logger.sinks = sinks
+	logger.clock = clock
+	logger.subscriptions = &subscriptionHub{}
+	if config.ReopenOnSIGHUP {
+		logger.signalHandler = startSignalHandler(logger)
+	}
+
 	return logger, nil
 }
@@ -0,0 +1,56 @@
+/*
+	File holding the handler reopening log files on SIGHUP
+*/
+
+package golog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// signalHandler reopens a logger's files whenever the process receives SIGHUP, as sent by logrotate's 'postrotate'
+type signalHandler struct {
+	signals chan os.Signal // Receives the SIGHUP notifications
+	done    chan struct{}  // Closed to stop the handler
+	stopped chan struct{}  // Closed once the handler has stopped
+	once    sync.Once      // Makes sure 'done' is closed once, as copies of a logger share the handler
+}
+
+// startSignalHandler starts reopening the files of 'logger' on SIGHUP. 'logger' must be fully set up
+func startSignalHandler(logger Logger) *signalHandler {
+	handler := &signalHandler{signals: make(chan os.Signal, 1), done: make(chan struct{}), stopped: make(chan struct{})}
+	signal.Notify(handler.signals, syscall.SIGHUP)
+
+	go handler.handleSignals(&logger)
+
+	return handler
+}
+
+// handleSignals reopens the files of 'logger' for every SIGHUP received, until the handler is stopped. Errors are written
+// to STDERR rather than raised, since the signal did not come from a log call and the log files may be unusable
+func (handler *signalHandler) handleSignals(logger *Logger) {
+	defer close(handler.stopped)
+
+	for {
+		select {
+		case <-handler.signals:
+			if err := logger.Reopen(); err != nil {
+				fmt.Fprintln(os.Stderr, "golog: Could not reopen log files on SIGHUP because: "+err.Error())
+			}
+		case <-handler.done:
+			return
+		}
+	}
+}
+
+// stop stops handling SIGHUP and waits for a reopen in progress to finish
+func (handler *signalHandler) stop() {
+	signal.Stop(handler.signals)
+	handler.once.Do(func() { close(handler.done) })
+
+	<-handler.stopped
+}
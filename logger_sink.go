@@ -0,0 +1,174 @@
+/*
+	File holding the sink interface and the sinks that write to streams
+*/
+
+package golog
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink is a destination log records are written to. A logger writes every record to each of its sinks, in the order
+// the sinks were configured. Sinks must be safe for concurrent use
+type Sink interface {
+	Write(record Record) error // Write outputs a single record
+	Flush() error              // Flush outputs any records the sink has buffered
+	Close() error              // Close flushes the sink and releases its resources. The sink is not written to after it is closed
+}
+
+// Reopener is implemented by sinks that write to files which may be moved by tools such as logrotate. 'Reopen' closes
+// the file and opens it again by its path, so output continues in the file now found there
+type Reopener interface {
+	Reopen() error
+}
+
+// callerWriter is implemented by sinks that may write the source location of records, so the logger knows to capture it
+type callerWriter interface {
+	writesCaller() bool
+}
+
+// flusher is implemented by writers that buffer output, such as 'bufio.Writer'
+type flusher interface {
+	Flush() error
+}
+
+// writerSink writes formatted records to an 'io.Writer'
+type writerSink struct {
+	mux       sync.Mutex // Serializes writes, so records are never interleaved
+	writer    io.Writer  // The destination
+	formatter Formatter  // Renders each record
+}
+
+// screenSink writes records to STDOUT, or to STDERR for errors and above. It is the sink behind 'ModeScreen'
+type screenSink struct {
+	stdOutFormatter Formatter // Renders records written to STDOUT
+	stdErrFormatter Formatter // Renders records written to STDERR
+}
+
+// filteredSink writes to another sink only the records whose level passes a filter
+type filteredSink struct {
+	sink   Sink        // The sink records are passed on to
+	filter LevelFilter // Selects the records passed on
+}
+
+// NewFilteredSink returns a sink passing on to 'sink' only the records whose level is let through by 'filter'. Use it
+// to give each destination its own level threshold, e.g. everything in a file but only warnings and above on STDERR
+func NewFilteredSink(sink Sink, filter LevelFilter) Sink {
+	return &filteredSink{sink, filter}
+}
+
+// NewWriterSink returns a sink writing each record rendered by 'formatter' to 'writer', such as 'os.Stderr' or a network
+// connection. If 'writer' has a 'Flush() error' method it is called when the sink is flushed, and if it is an
+// 'io.Closer' it is closed along with the sink
+func NewWriterSink(writer io.Writer, formatter Formatter) Sink {
+	return &writerSink{writer: writer, formatter: formatter}
+}
+
+func (sink *writerSink) Write(record Record) error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	_, err := sink.writer.Write(sink.formatter.Format(record))
+	return err
+}
+
+func (sink *writerSink) Flush() error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if bufferedWriter, ok := sink.writer.(flusher); ok {
+		return bufferedWriter.Flush()
+	}
+
+	return nil
+}
+
+func (sink *writerSink) Close() error {
+	err := sink.Flush()
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if closer, ok := sink.writer.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// levelWritesToStdErr returns true if records of 'level' are written to STDERR rather than STDOUT by the screen
+func levelWritesToStdErr(level LoggingLevel) bool {
+	return level == LevelErr || level == LevelFatal || level == LevelPanic
+}
+
+func (sink *screenSink) Write(record Record) error {
+	var err error
+	if levelWritesToStdErr(record.Level) {
+		_, err = os.Stderr.Write(sink.stdErrFormatter.Format(record))
+	} else {
+		_, err = os.Stdout.Write(sink.stdOutFormatter.Format(record))
+	}
+
+	return err
+}
+
+func (sink *screenSink) Flush() error {
+	return nil
+}
+
+func (sink *screenSink) Close() error {
+	// the standard streams belong to the process, not the logger
+	return nil
+}
+
+func (sink *filteredSink) Write(record Record) error {
+	if !sink.filter.allows(record.Level) {
+		return nil
+	}
+
+	return sink.sink.Write(record)
+}
+
+func (sink *filteredSink) Flush() error {
+	return sink.sink.Flush()
+}
+
+func (sink *filteredSink) Close() error {
+	return sink.sink.Close()
+}
+
+// Reopen reopens the wrapped sink if it is a 'Reopener', so level filters don't hide file sinks from 'Logger.Reopen'
+func (sink *filteredSink) Reopen() error {
+	if reopener, ok := sink.sink.(Reopener); ok {
+		return reopener.Reopen()
+	}
+
+	return nil
+}
+
+// DeliveryCounters returns the counters of the wrapped sink if it is a 'DeliveryCounter'
+func (sink *filteredSink) DeliveryCounters() DeliveryCounters {
+	if counter, ok := sink.sink.(DeliveryCounter); ok {
+		return counter.DeliveryCounters()
+	}
+
+	return DeliveryCounters{}
+}
+
+// unwrap returns the wrapped sink
+func (sink *filteredSink) unwrap() Sink {
+	return sink.sink
+}
+
+// writesCaller returns true if the wrapped sink writes the source location of records
+func (sink *filteredSink) writesCaller() bool {
+	if writer, ok := sink.sink.(callerWriter); ok {
+		return writer.writesCaller()
+	}
+
+	return false
+}
@@ -0,0 +1,243 @@
+/*
+	File holding the sink that indexes records into Elasticsearch or OpenSearch through the bulk API
+*/
+
+package golog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	elasticsearchBulkPath     = "/_bulk"          // The path of the bulk API, used if the configured URL has no path
+	defaultElasticsearchIndex = "logs-2006.01.02" // The index pattern documents are written to if not configured
+	invalidIndexCharacters    = "\\/*?\"<>| ,#:"  // Characters Elasticsearch does not allow in index names
+)
+
+// ElasticsearchConfig configures an output indexing records into Elasticsearch or OpenSearch
+type ElasticsearchConfig struct {
+	URL                string            // The address of the cluster, such as 'http://localhost:9200'. If it has no path, '/_bulk' is used
+	Index              string            // The index documents are written to, as a time layout applied to the UTC time of each record, such as 'logs-2006.01.02'. If unset, 'logs-2006.01.02' is used
+	Format             LoggingFormat     // The JSON format documents are rendered in. If unset, 'FormatECS' is used
+	Headers            map[string]string // Headers added to every request, such as 'Authorization'
+	Gzip               bool              // If true, request bodies are gzip compressed
+	MaxBatchRecords    int               // The number of documents sent in one bulk request. If unset, 500 is used
+	MaxBatchBytes      int               // The number of bytes sent in one bulk request, before compression. If unset, 1 MiB is used
+	BatchInterval      time.Duration     // How long a batch that is not full waits for more documents. If unset, one second is used
+	MaxBufferedRecords int               // The number of documents buffered while the cluster can't be reached. If unset, 10000 is used
+	MaxBufferedBytes   int               // The number of bytes buffered while the cluster can't be reached. If unset, 8 MiB is used
+	MinBackoff         time.Duration     // The delay before the first retry, doubled after each further failure. If unset, 100 milliseconds is used
+	MaxBackoff         time.Duration     // The longest delay between retries. If unset, 30 seconds is used
+	Timeout            time.Duration     // How long a request may take. If unset, 10 seconds is used. Unused if 'Client' is set
+	FlushTimeout       time.Duration     // How long 'Flush' and 'Shutdown' wait for buffered documents to be indexed. If unset, 5 seconds is used
+	Client             *http.Client      `json:"-"` // The client requests are sent with, e.g. to configure TLS. If nil, a client with 'Timeout' is used
+	Spool              *SpoolConfig      // The directory documents spill to once the buffer is full, replayed in order once the cluster is back. If nil, the oldest documents are dropped
+	Levels             LevelFilter       // The levels indexed. If unset, every level is indexed
+}
+
+// elasticsearchSink indexes records in bulk requests from a background goroutine. Each queued entry holds the action
+// line naming the record's index followed by the document, both ending with a newline
+type elasticsearchSink struct {
+	config    ElasticsearchConfig // The configuration, with defaults filled in
+	formatter Formatter           // Renders each document
+	poster    httpPoster          // Sends the bulk requests
+	queue     *deliveryQueue      // Buffers the entries and sends them in batches
+}
+
+// bulkResponse is the part of a bulk API answer telling which documents failed to index
+type bulkResponse struct {
+	Errors bool                         `json:"errors"` // True if any document failed
+	Items  []map[string]bulkItemOutcome `json:"items"`  // The outcome of each action, in request order, keyed by the action
+}
+
+// bulkItemOutcome is the outcome of indexing one document
+type bulkItemOutcome struct {
+	Status int `json:"status"` // The HTTP status of the action
+	Error  struct {
+		Type   string `json:"type"`   // The kind of failure, such as 'mapper_parsing_exception'
+		Reason string `json:"reason"` // A description of the failure
+	} `json:"error"` // Why the action failed, if it did
+}
+
+// NewElasticsearchSink returns a sink indexing records into Elasticsearch or OpenSearch through the bulk API, sending a
+// batch once it is full or has waited 'BatchInterval'. Failed requests are retried as described for 'NewHTTPSink'. When
+// the cluster accepts a request but fails some of its documents, only the documents failing with a 429 or 5xx status
+// are retried, and the others are counted as rejected. An error is returned if the configuration is invalid
+func NewElasticsearchSink(config ElasticsearchConfig) (Sink, error) {
+	return newElasticsearchSink(config, afero.NewOsFs())
+}
+
+// newElasticsearchSink returns the sink described by 'config', spooling records on the filesystem 'osPtr'
+func newElasticsearchSink(config ElasticsearchConfig, osPtr afero.Fs) (Sink, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(config.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, errors.New("Invalid URL '" + config.URL + "' provided. Use an 'http' or 'https' URL")
+	}
+
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = elasticsearchBulkPath
+		config.URL = endpoint.String()
+	}
+
+	if config.Index == "" {
+		config.Index = defaultElasticsearchIndex
+	}
+
+	index := time.Now().UTC().Format(config.Index)
+	if index != strings.ToLower(index) || strings.ContainsAny(index, invalidIndexCharacters) || strings.HasPrefix(index, "_") {
+		return nil, errors.New("Invalid index '" + config.Index + "' provided. Index names are lower case and may not contain '" + invalidIndexCharacters + "'")
+	}
+
+	if config.Format == 0 {
+		config.Format = FormatECS
+	} else if !config.Format.isJSON() {
+		return nil, errors.New("Invalid log format provided. Elasticsearch outputs use one of the JSON formats, such as 'FormatECS'")
+	}
+
+	if config.MaxBatchRecords <= 0 {
+		config.MaxBatchRecords = defaultHTTPBatchRecords
+	}
+
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaultHTTPBatchBytes
+	}
+
+	if config.BatchInterval <= 0 {
+		config.BatchInterval = defaultHTTPBatchInterval
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+
+	spool, err := openDiskSpool(config.Spool, osPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &elasticsearchSink{config: config, formatter: newFormatter(config.Format, LinePolicyEscape, resolveCEFConfig(CEFConfig{}), nil, false)}
+	sink.poster = httpPoster{config.URL, http.MethodPost, "application/x-ndjson", config.Headers, config.Gzip, config.Client}
+	sink.queue = newDeliveryQueue(deliveryOptions{
+		maxBufferedRecords: config.MaxBufferedRecords,
+		maxBufferedBytes:   config.MaxBufferedBytes,
+		maxBatchRecords:    config.MaxBatchRecords,
+		maxBatchBytes:      config.MaxBatchBytes,
+		batchInterval:      config.BatchInterval,
+		minBackoff:         config.MinBackoff,
+		maxBackoff:         config.MaxBackoff,
+		flushTimeout:       config.FlushTimeout,
+		spool:              spool,
+	}, sink.deliver)
+
+	return withLevelFilter(sink, config.Levels), nil
+}
+
+func (sink *elasticsearchSink) Write(record Record) error {
+	var stringBuilder strings.Builder
+
+	// 'create' is used rather than 'index' as data streams only accept it
+	stringBuilder.WriteString(`{"create":{"_index":`)
+	writeJSONString(&stringBuilder, record.Time.UTC().Format(sink.config.Index))
+	stringBuilder.WriteString("}}\n")
+	stringBuilder.WriteString(strings.TrimSuffix(string(sink.formatter.Format(record)), "\n"))
+	stringBuilder.WriteString("\n")
+
+	if !sink.queue.enqueue([]byte(stringBuilder.String())) {
+		return errors.New("Unable to index into '" + sink.config.URL + "' because: the sink is closed")
+	}
+
+	return nil
+}
+
+// deliver sends 'batch' in one bulk request. If some documents failed, a 'partialDeliveryError' holding the ones worth
+// retrying is returned
+func (sink *elasticsearchSink) deliver(batch [][]byte) error {
+	var stringBuilder strings.Builder
+
+	responseBody, err := sink.poster.post(bytes.Join(batch, nil))
+	if err != nil {
+		return err
+	}
+
+	// an answer that can't be matched to the batch is taken as success, since the request itself was accepted
+	var response bulkResponse
+	if json.Unmarshal(responseBody, &response) != nil || !response.Errors || len(response.Items) != len(batch) {
+		return nil
+	}
+
+	var retry [][]byte
+	var rejected int
+	var firstFailure bulkItemOutcome
+	for itemIndex, item := range response.Items {
+		for _, outcome := range item {
+			if outcome.Status < 300 {
+				continue
+			}
+
+			if firstFailure.Status == 0 {
+				firstFailure = outcome
+			}
+
+			if outcome.Status == http.StatusTooManyRequests || outcome.Status >= 500 {
+				retry = append(retry, batch[itemIndex])
+			} else {
+				rejected++
+			}
+		}
+	}
+
+	if len(retry) == 0 && rejected == 0 {
+		return nil
+	}
+
+	stringBuilder.WriteString("Could not index ")
+	stringBuilder.WriteString(strconv.Itoa(len(retry) + rejected))
+	stringBuilder.WriteString(" documents into '")
+	stringBuilder.WriteString(sink.config.URL)
+	stringBuilder.WriteString("' because: ")
+	stringBuilder.WriteString(firstFailure.Error.Type)
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(firstFailure.Error.Reason)
+
+	return partialDeliveryError{errors.New(stringBuilder.String()), retry, rejected}
+}
+
+// writesCaller returns true if the sink's format includes the source location of records
+func (sink *elasticsearchSink) writesCaller() bool {
+	return sink.config.Format.needsCaller()
+}
+
+// DeliveryCounters returns how many documents were indexed, dropped, rejected and retried, and how many are buffered
+func (sink *elasticsearchSink) DeliveryCounters() DeliveryCounters {
+	return sink.queue.deliveryCounters()
+}
+
+// Flush sends the buffered documents without waiting for batches to fill, waiting up to the flush timeout for them to be
+// indexed. Documents not indexed by then stay buffered
+func (sink *elasticsearchSink) Flush() error {
+	sink.queue.flush()
+	return nil
+}
+
+// Close sends the buffered documents, waiting up to the flush timeout for them to be indexed, and drops the rest
+func (sink *elasticsearchSink) Close() error {
+	sink.queue.close()
+	return nil
+}
@@ -0,0 +1,385 @@
+/*
+	File holding the sink that forwards records to Fluentd or Fluent Bit using the Forward protocol
+*/
+
+package golog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	defaultFluentTagPrefix  = "golog"          // The tag records are forwarded under if not configured
+	defaultFluentBatchBytes = 1024 * 1024      // The number of bytes forwarded in one message if not configured
+	defaultFluentAckTimeout = 30 * time.Second // How long an ack is waited for if not configured
+)
+
+// FluentConfig configures an output forwarding records to Fluentd or Fluent Bit
+type FluentConfig struct {
+	Network            string        // 'tcp' or 'unix'. If unset, 'tcp' is used
+	Address            string        // The address of the forward input, as 'host:port' or a socket path
+	UseTLS             bool          // If true, TCP connections are secured with TLS
+	TLSConfig          *tls.Config   `json:"-"` // The TLS settings used if 'UseTLS' is set. If nil, the server's certificate is verified against the system roots
+	TagPrefix          string        // The tag records are forwarded under, followed by '.' and the logger's context if it has one. If unset, 'golog' is used
+	RequireAck         bool          // If true, every message carries a chunk id and is sent again until the server acknowledges it
+	IncludeCaller      bool          // If true, events carry the source location of records under 'caller'. Finding it slows down every log call
+	AckTimeout         time.Duration // How long an acknowledgement is waited for before the message is sent again. If unset, 30 seconds is used
+	MaxBatchBytes      int           // The number of bytes forwarded in one message. If unset, 1 MiB is used
+	BatchInterval      time.Duration // How long a message that is not full waits for more records. If unset, records are forwarded right away
+	MaxBufferedRecords int           // The number of records buffered while the server can't be reached. If unset, 10000 is used
+	MaxBufferedBytes   int           // The number of bytes buffered while the server can't be reached. If unset, 8 MiB is used
+	MinBackoff         time.Duration // The delay before the first reconnect, doubled after each further failure. If unset, 100 milliseconds is used
+	MaxBackoff         time.Duration // The longest delay between reconnects. If unset, 30 seconds is used
+	WriteTimeout       time.Duration // How long connecting and writing may take before the attempt fails. If unset, 5 seconds is used
+	FlushTimeout       time.Duration // How long 'Flush' and 'Shutdown' wait for buffered records to be forwarded. If unset, 5 seconds is used
+	Spool              *SpoolConfig  // The directory records spill to once the buffer is full, replayed in order once the server is back. If nil, the oldest records are dropped
+	Levels             LevelFilter   // The levels forwarded. If unset, every level is forwarded
+}
+
+// fluentSink forwards records in PackedForward messages from a background goroutine. Each queued entry holds the
+// record's tag and its MessagePack encoded event, separated by a newline
+type fluentSink struct {
+	config   FluentConfig   // The configuration, with defaults filled in
+	hostname string         // The host name records carry
+	queue    *deliveryQueue // Buffers the entries and forwards them in batches
+	mux      sync.Mutex     // Guards 'conn', which only the queue's goroutine and 'Close' use
+	conn     net.Conn       // The connection to the server. nil while disconnected
+}
+
+// NewFluentSink returns a sink forwarding records to the Forward input described by 'config', such as Fluentd's
+// 'in_forward' or Fluent Bit's 'forward' input. Records are encoded as MessagePack maps and sent in PackedForward
+// messages, one per run of records sharing a tag. Records are buffered and sent from the background, reconnecting with exponential backoff while
+// the server can't be reached. An error is returned if the configuration is invalid
+func NewFluentSink(config FluentConfig) (Sink, error) {
+	return newFluentSink(config, afero.NewOsFs())
+}
+
+// newFluentSink returns the sink described by 'config', spooling records on the filesystem 'osPtr'
+func newFluentSink(config FluentConfig, osPtr afero.Fs) (Sink, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Network == "" {
+		config.Network = "tcp"
+	} else if config.Network != "tcp" && config.Network != "unix" {
+		return nil, errors.New("Invalid network '" + config.Network + "' provided. Use 'tcp' or 'unix'")
+	}
+
+	if config.UseTLS && config.Network != "tcp" {
+		return nil, errors.New("TLS is only supported over 'tcp'")
+	}
+
+	if config.Network == "tcp" {
+		if _, _, err := net.SplitHostPort(config.Address); err != nil {
+			return nil, errors.New("Invalid server address '" + config.Address + "' provided because: " + err.Error())
+		}
+	} else if config.Address == "" {
+		return nil, errors.New("No socket path provided for the Fluentd server")
+	}
+
+	if config.TagPrefix == "" {
+		config.TagPrefix = defaultFluentTagPrefix
+	}
+
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = defaultFluentAckTimeout
+	}
+
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaultFluentBatchBytes
+	}
+
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultNetworkWriteTimeout
+	}
+
+	spool, err := openDiskSpool(config.Spool, osPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &fluentSink{config: config, hostname: getHostname()}
+	sink.queue = newDeliveryQueue(deliveryOptions{
+		maxBufferedRecords: config.MaxBufferedRecords,
+		maxBufferedBytes:   config.MaxBufferedBytes,
+		maxBatchBytes:      config.MaxBatchBytes,
+		batchInterval:      config.BatchInterval,
+		minBackoff:         config.MinBackoff,
+		maxBackoff:         config.MaxBackoff,
+		flushTimeout:       config.FlushTimeout,
+		spool:              spool,
+	}, sink.deliver)
+
+	return withLevelFilter(sink, config.Levels), nil
+}
+
+// connect dials the server. The caller must hold 'mux'
+func (sink *fluentSink) connect() error {
+	var stringBuilder strings.Builder
+
+	dialer := &net.Dialer{Timeout: sink.config.WriteTimeout}
+
+	var conn net.Conn
+	var err error
+	if sink.config.UseTLS {
+		tlsConfig := sink.config.TLSConfig
+		if tlsConfig == nil {
+			host, _, _ := net.SplitHostPort(sink.config.Address)
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+
+		conn, err = tls.DialWithDialer(dialer, "tcp", sink.config.Address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial(sink.config.Network, sink.config.Address)
+	}
+
+	if err != nil {
+		stringBuilder.WriteString("Could not connect to Fluentd at '")
+		stringBuilder.WriteString(sink.config.Address)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	sink.conn = conn
+	return nil
+}
+
+// isFluentTagRune returns true if 'r' may be part of a tag
+func isFluentTagRune(r rune) bool {
+	return isAlphanumericRune(r) || r == '_' || r == '-' || r == '.'
+}
+
+// tag returns the tag 'record' is forwarded under: the configured prefix, followed by the logger's context if it has one
+func (sink *fluentSink) tag(record Record) string {
+	context := strings.Trim(sanitizeFieldKey(strings.TrimSpace(record.Context), isFluentTagRune), ".")
+	if context == "" {
+		return sink.config.TagPrefix
+	}
+
+	return sink.config.TagPrefix + "." + context
+}
+
+// event returns 'record' encoded as a Forward protocol event: its time and a map of its level, log text, context,
+// source location if configured and fields. Fields are renamed if they would replace one of the other keys
+func (sink *fluentSink) event(record Record) []byte {
+	var keys = []string{"level", "message", "host"}
+	if strings.TrimSpace(record.Context) != "" {
+		keys = append(keys, "context")
+	}
+
+	if sink.config.IncludeCaller && record.CallerFile != "" {
+		keys = append(keys, "caller")
+	}
+
+	var event = appendMsgpackArrayHeader(nil, 2)
+	event = appendMsgpackEventTime(event, record.Time)
+	event = appendMsgpackMapHeader(event, len(keys)+len(record.Fields))
+
+	writtenKeys := make(map[string]bool, len(keys)+len(record.Fields))
+	for _, key := range keys {
+		event = appendMsgpackString(event, key)
+		writtenKeys[key] = true
+
+		switch key {
+		case "level":
+			event = appendMsgpackString(event, record.Level.String())
+		case "message":
+			event = appendMsgpackString(event, record.Message)
+		case "host":
+			event = appendMsgpackString(event, sink.hostname)
+		case "context":
+			event = appendMsgpackString(event, strings.TrimSpace(record.Context))
+		case "caller":
+			event = appendMsgpackMapHeader(event, 3)
+			event = appendMsgpackString(event, "file")
+			event = appendMsgpackString(event, record.CallerFile)
+			event = appendMsgpackString(event, "line")
+			event = appendMsgpackInt(event, int64(record.CallerLine))
+			event = appendMsgpackString(event, "function")
+			event = appendMsgpackString(event, record.CallerFunction)
+		}
+	}
+
+	for _, field := range record.Fields {
+		var key = field.Key
+		for writtenKeys[key] {
+			key = key + "_"
+		}
+		writtenKeys[key] = true
+
+		event = appendMsgpackString(event, key)
+		event = appendMsgpackValue(event, field.Value)
+	}
+
+	return event
+}
+
+func (sink *fluentSink) Write(record Record) error {
+	var entry = []byte(sink.tag(record) + "\n")
+	entry = append(entry, sink.event(record)...)
+
+	if !sink.queue.enqueue(entry) {
+		return errors.New("Unable to forward to '" + sink.config.Address + "' because: the sink is closed")
+	}
+
+	return nil
+}
+
+// newChunkID returns a random id for a message awaiting an ack
+func newChunkID() string {
+	var id [16]byte
+	rand.Read(id[:])
+
+	return base64.StdEncoding.EncodeToString(id[:])
+}
+
+// forwardMessage returns the PackedForward message holding 'events' under 'tag', carrying 'chunkID' if not empty
+func forwardMessage(tag string, events [][]byte, chunkID string) []byte {
+	var message = appendMsgpackArrayHeader(nil, 3)
+	message = appendMsgpackString(message, tag)
+	message = appendMsgpackBinary(message, bytes.Join(events, nil))
+
+	if chunkID == "" {
+		message = appendMsgpackMapHeader(message, 1)
+	} else {
+		message = appendMsgpackMapHeader(message, 2)
+		message = appendMsgpackString(message, "chunk")
+		message = appendMsgpackString(message, chunkID)
+	}
+	message = appendMsgpackString(message, "size")
+	return appendMsgpackInt(message, int64(len(events)))
+}
+
+// send writes 'message' to the server, connecting first if needed, and waits for the ack of 'chunkID' if not empty.
+// The connection is dropped on any error, so the retry starts on a fresh one. The caller must hold 'mux'
+func (sink *fluentSink) send(message []byte, chunkID string) error {
+	var stringBuilder strings.Builder
+
+	if sink.conn == nil {
+		if err := sink.connect(); err != nil {
+			return err
+		}
+	}
+
+	sink.conn.SetWriteDeadline(time.Now().Add(sink.config.WriteTimeout))
+	_, err := sink.conn.Write(message)
+
+	if err == nil && chunkID != "" {
+		sink.conn.SetReadDeadline(time.Now().Add(sink.config.AckTimeout))
+
+		var response map[string]string
+		response, err = readMsgpackStringMap(sink.conn)
+		if err == nil && response["ack"] != chunkID {
+			err = errors.New("the server acknowledged '" + response["ack"] + "' instead of '" + chunkID + "'")
+		}
+	}
+
+	if err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+
+		stringBuilder.WriteString("Could not forward logs to '")
+		stringBuilder.WriteString(sink.config.Address)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	return nil
+}
+
+// deliver forwards 'batch' as one message per run of consecutive entries sharing a tag, so records keep their order.
+// If a message fails after others were sent, a 'partialDeliveryError' holding the entries of the failed and remaining
+// messages is returned. Without acks, records of a message that failed part way through may reach the server twice
+func (sink *fluentSink) deliver(batch [][]byte) error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	var tags []string
+	var entryRuns, eventRuns [][][]byte
+	for _, entry := range batch {
+		separator := bytes.IndexByte(entry, '\n')
+		tag := string(entry[:separator])
+
+		if len(tags) == 0 || tags[len(tags)-1] != tag {
+			tags = append(tags, tag)
+			entryRuns = append(entryRuns, nil)
+			eventRuns = append(eventRuns, nil)
+		}
+
+		var last = len(tags) - 1
+		entryRuns[last] = append(entryRuns[last], entry)
+		eventRuns[last] = append(eventRuns[last], entry[separator+1:])
+	}
+
+	for runIndex, tag := range tags {
+		var chunkID string
+		if sink.config.RequireAck {
+			chunkID = newChunkID()
+		}
+
+		err := sink.send(forwardMessage(tag, eventRuns[runIndex], chunkID), chunkID)
+		if err == nil {
+			continue
+		}
+
+		if runIndex == 0 {
+			return err
+		}
+
+		var retry [][]byte
+		for _, entries := range entryRuns[runIndex:] {
+			retry = append(retry, entries...)
+		}
+
+		return partialDeliveryError{err, retry, 0}
+	}
+
+	return nil
+}
+
+// writesCaller returns true if events carry the source location of records under 'caller'
+func (sink *fluentSink) writesCaller() bool {
+	return sink.config.IncludeCaller
+}
+
+// DeliveryCounters returns how many records were forwarded, dropped and retried, and how many are buffered
+func (sink *fluentSink) DeliveryCounters() DeliveryCounters {
+	return sink.queue.deliveryCounters()
+}
+
+// Flush waits up to the flush timeout for the buffered records to be forwarded. Records not forwarded by then stay buffered
+func (sink *fluentSink) Flush() error {
+	sink.queue.flush()
+	return nil
+}
+
+func (sink *fluentSink) Close() error {
+	sink.queue.close()
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+
+	err := sink.conn.Close()
+	sink.conn = nil
+
+	return err
+}
@@ -0,0 +1,278 @@
+/*
+	File holding the sink that posts batches of records to an HTTP endpoint
+*/
+
+package golog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	defaultHTTPBatchRecords  = 500              // The number of records posted at once if not configured
+	defaultHTTPBatchBytes    = 1024 * 1024      // The number of bytes posted at once if not configured
+	defaultHTTPBatchInterval = time.Second      // How long a batch waits to fill up if not configured
+	defaultHTTPTimeout       = 10 * time.Second // How long a request may take if not configured
+)
+
+// HTTPConfig configures an output posting batches of records to an HTTP endpoint
+type HTTPConfig struct {
+	URL                string               // The endpoint records are posted to
+	Method             string               // The request method. If unset, 'POST' is used
+	Headers            map[string]string    // Headers added to every request, such as 'Authorization'. They may replace the 'Content-Type' header
+	Format             LoggingFormat        // The JSON format records are rendered in. If unset, 'FormatJSON' is used
+	Encoding           LoggingBatchEncoding // How the records of a batch are joined into a body. If unset, 'BatchNDJSON' is used
+	Gzip               bool                 // If true, request bodies are gzip compressed
+	MaxBatchRecords    int                  // The number of records posted at once. If unset, 500 is used
+	MaxBatchBytes      int                  // The number of bytes posted at once, before compression. If unset, 1 MiB is used
+	BatchInterval      time.Duration        // How long a batch that is not full waits for more records. If unset, one second is used
+	MaxBufferedRecords int                  // The number of records buffered while the endpoint can't be reached. If unset, 10000 is used
+	MaxBufferedBytes   int                  // The number of bytes buffered while the endpoint can't be reached. If unset, 8 MiB is used
+	MinBackoff         time.Duration        // The delay before the first retry, doubled after each further failure. If unset, 100 milliseconds is used
+	MaxBackoff         time.Duration        // The longest delay between retries. If unset, 30 seconds is used
+	Timeout            time.Duration        // How long a request may take. If unset, 10 seconds is used. Unused if 'Client' is set
+	FlushTimeout       time.Duration        // How long 'Flush' and 'Shutdown' wait for buffered records to be posted. If unset, 5 seconds is used
+	Client             *http.Client         `json:"-"` // The client requests are sent with, e.g. to configure TLS. If nil, a client with 'Timeout' is used
+	Spool              *SpoolConfig         // The directory records spill to once the buffer is full, replayed in order once the endpoint is back. If nil, the oldest records are dropped
+	Levels             LevelFilter          // The levels posted. If unset, every level is posted
+}
+
+// httpSink posts batches of records to an endpoint from a background goroutine, so the logger never waits on requests
+type httpSink struct {
+	config    HTTPConfig     // The configuration, with defaults filled in
+	formatter Formatter      // Renders each record
+	poster    httpPoster     // Sends the batches
+	queue     *deliveryQueue // Buffers the rendered records and posts them in batches
+}
+
+// NewHTTPSink returns a sink posting records in batches to the endpoint described by 'config'. A batch is posted once
+// it is full or has waited 'BatchInterval'. Requests answered with a 5xx or 429 status, or that fail to get an answer,
+// are retried with exponential backoff, waiting as long as a 'Retry-After' header asks. Batches answered with any other
+// error status are dropped. An error is returned if the configuration is invalid
+func NewHTTPSink(config HTTPConfig) (Sink, error) {
+	return newHTTPSink(config, afero.NewOsFs())
+}
+
+// newHTTPSink returns the sink described by 'config', spooling records on the filesystem 'osPtr'
+func newHTTPSink(config HTTPConfig, osPtr afero.Fs) (Sink, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(config.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, errors.New("Invalid URL '" + config.URL + "' provided. Use an 'http' or 'https' URL")
+	}
+
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+
+	if config.Format == 0 {
+		config.Format = FormatJSON
+	} else if !config.Format.isJSON() {
+		return nil, errors.New("Invalid log format provided. HTTP outputs use one of the JSON formats, such as 'FormatJSON'")
+	}
+
+	if config.Encoding == 0 {
+		config.Encoding = BatchNDJSON
+	} else if !config.Encoding.IsValidBatchEncoding() {
+		return nil, errors.New("Invalid batch encoding provided. See encodings in 'logging_batch_encodings.go'")
+	}
+
+	if config.MaxBatchRecords <= 0 {
+		config.MaxBatchRecords = defaultHTTPBatchRecords
+	}
+
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaultHTTPBatchBytes
+	}
+
+	if config.BatchInterval <= 0 {
+		config.BatchInterval = defaultHTTPBatchInterval
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+
+	spool, err := openDiskSpool(config.Spool, osPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &httpSink{config: config, formatter: newFormatter(config.Format, LinePolicyEscape, resolveCEFConfig(CEFConfig{}), nil, false)}
+	sink.poster = httpPoster{config.URL, config.Method, config.Encoding.contentType(), config.Headers, config.Gzip, config.Client}
+	sink.queue = newDeliveryQueue(deliveryOptions{
+		maxBufferedRecords: config.MaxBufferedRecords,
+		maxBufferedBytes:   config.MaxBufferedBytes,
+		maxBatchRecords:    config.MaxBatchRecords,
+		maxBatchBytes:      config.MaxBatchBytes,
+		batchInterval:      config.BatchInterval,
+		minBackoff:         config.MinBackoff,
+		maxBackoff:         config.MaxBackoff,
+		flushTimeout:       config.FlushTimeout,
+		spool:              spool,
+	}, sink.deliver)
+
+	return withLevelFilter(sink, config.Levels), nil
+}
+
+// parseRetryAfter returns the delay a 'Retry-After' header asks for, given as seconds or as an HTTP date, or 0 if the
+// header is missing or malformed
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if retryTime, err := http.ParseTime(value); err == nil && retryTime.After(now) {
+		return retryTime.Sub(now)
+	}
+
+	return 0
+}
+
+// gzipBody returns 'body' gzip compressed
+func gzipBody(body []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
+
+// httpPoster sends request bodies to an endpoint and sorts failed requests into ones worth retrying and rejections.
+// It is shared by the outputs speaking HTTP
+type httpPoster struct {
+	url         string            // The endpoint bodies are sent to
+	method      string            // The request method
+	contentType string            // The media type of the bodies
+	headers     map[string]string // Headers added to every request, which may replace 'Content-Type'
+	gzip        bool              // If true, bodies are gzip compressed
+	client      *http.Client      // The client requests are sent with
+}
+
+// post sends 'body' and returns the body of the answer. Requests that fail or are answered with a 5xx or 429 status
+// return an error to be retried, honoring 'Retry-After', and ones answered with any other error status a 'rejectedError'
+func (poster httpPoster) post(body []byte) ([]byte, error) {
+	var stringBuilder strings.Builder
+
+	if poster.gzip {
+		compressed, err := gzipBody(body)
+		if err != nil {
+			return nil, rejectedError{err}
+		}
+		body = compressed
+	}
+
+	request, err := http.NewRequest(poster.method, poster.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, rejectedError{err}
+	}
+
+	request.Header.Set("Content-Type", poster.contentType)
+	if poster.gzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+
+	for name, value := range poster.headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := poster.client.Do(request)
+	if err == nil {
+		// the body is read to the end so the connection can be reused
+		var responseBody []byte
+		responseBody, err = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		if err == nil && response.StatusCode >= 200 && response.StatusCode < 300 {
+			return responseBody, nil
+		}
+	}
+
+	stringBuilder.WriteString("Could not post logs to '")
+	stringBuilder.WriteString(poster.url)
+	if err != nil {
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return nil, errors.New(stringBuilder.String())
+	}
+
+	stringBuilder.WriteString("' because the endpoint answered: ")
+	stringBuilder.WriteString(response.Status)
+	statusErr := errors.New(stringBuilder.String())
+
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return nil, retryAfterError{statusErr, parseRetryAfter(response.Header.Get("Retry-After"), time.Now())}
+	}
+
+	return nil, rejectedError{statusErr}
+}
+
+// deliver posts 'batch' to the endpoint
+func (sink *httpSink) deliver(batch [][]byte) error {
+	_, err := sink.poster.post(sink.config.Encoding.encode(batch))
+	return err
+}
+
+func (sink *httpSink) Write(record Record) error {
+	if !sink.queue.enqueue(sink.formatter.Format(record)) {
+		return errors.New("Unable to post to '" + sink.config.URL + "' because: the sink is closed")
+	}
+
+	return nil
+}
+
+// writesCaller returns true if the sink's format includes the source location of records
+func (sink *httpSink) writesCaller() bool {
+	return sink.config.Format.needsCaller()
+}
+
+// DeliveryCounters returns how many records were posted, dropped and retried, and how many are buffered
+func (sink *httpSink) DeliveryCounters() DeliveryCounters {
+	return sink.queue.deliveryCounters()
+}
+
+// Flush posts the buffered records without waiting for batches to fill, waiting up to the flush timeout for them to be
+// accepted. Records not accepted by then stay buffered
+func (sink *httpSink) Flush() error {
+	sink.queue.flush()
+	return nil
+}
+
+// Close posts the buffered records, waiting up to the flush timeout for them to be accepted, and drops the rest
+func (sink *httpSink) Close() error {
+	sink.queue.close()
+	return nil
+}
@@ -0,0 +1,221 @@
+/*
+	File holding the sink that writes to the systemd journal
+*/
+
+package golog
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJournaldSocketPath = "/run/systemd/journal/socket" // The socket journald receives native protocol messages on
+	journaldRedialDelay       = time.Second                   // The time waited before dialing journald again after a failed dial
+	maxJournalFieldNameLength = 64                            // The longest field name journald accepts
+)
+
+// JournaldConfig configures an output writing to the systemd journal
+type JournaldConfig struct {
+	SocketPath       string      // The path of journald's native protocol socket. If unset, '/run/systemd/journal/socket' is used
+	SyslogIdentifier string      // The SYSLOG_IDENTIFIER entries carry. If unset, the name of the program is used
+	Levels           LevelFilter // The levels written to the journal. If unset, every level is written
+}
+
+// journaldSink writes records to journald using its native protocol, reconnecting when the connection is lost
+type journaldSink struct {
+	mux      sync.Mutex       // Serializes writes and reconnects
+	config   JournaldConfig   // The configuration, with defaults filled in
+	conn     *net.UnixConn    // The connection to journald. nil while disconnected
+	nextDial time.Time        // The earliest time journald is dialed again after a failed dial
+	counters DeliveryCounters // What happened to the records so far
+	isClosed bool             // If true, the sink was closed and may not be written to
+}
+
+// NewJournaldSink returns a sink writing each record to the systemd journal as described by 'config'. Records carry
+// their level as PRIORITY, their source location as CODE_FILE, CODE_LINE and CODE_FUNC, and their fields as journal
+// fields. An error is returned if journald can't be reached
+func NewJournaldSink(config JournaldConfig) (Sink, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.SocketPath == "" {
+		config.SocketPath = defaultJournaldSocketPath
+	}
+
+	if config.SyslogIdentifier == "" {
+		config.SyslogIdentifier = filepath.Base(os.Args[0])
+	}
+
+	sink := &journaldSink{config: config}
+	err := sink.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return withLevelFilter(sink, config.Levels), nil
+}
+
+// connect dials journald. The caller must hold 'mux', unless the sink is still being created
+func (sink *journaldSink) connect() error {
+	var stringBuilder strings.Builder
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sink.config.SocketPath, Net: "unixgram"})
+	if err != nil {
+		stringBuilder.WriteString("Could not connect to journald at '")
+		stringBuilder.WriteString(sink.config.SocketPath)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	sink.conn = conn
+	return nil
+}
+
+// isJournalFieldRune returns true if 'r' may be part of a journal field name
+func isJournalFieldRune(r rune) bool {
+	return (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'
+}
+
+// journalFieldName returns 'key' as a journal field name: upper case letters, digits and underscores, not starting with
+// a digit or with the underscore reserved for fields journald adds itself. An empty string is returned if nothing is left
+func journalFieldName(key string) string {
+	name := strings.TrimLeft(sanitizeFieldKey(strings.ToUpper(key), isJournalFieldRune), "_0123456789")
+	if len(name) > maxJournalFieldNameLength {
+		name = name[:maxJournalFieldNameLength]
+	}
+
+	return name
+}
+
+// appendJournalField appends the field 'name' with 'value' to 'payload'. Values holding a newline are written in the
+// binary form, which prefixes them with their length as a 64 bit little endian integer
+func appendJournalField(payload []byte, name string, value string) []byte {
+	payload = append(payload, name...)
+
+	if !strings.Contains(value, "\n") {
+		payload = append(payload, '=')
+		payload = append(payload, value...)
+		return append(payload, '\n')
+	}
+
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(value)))
+
+	payload = append(payload, '\n')
+	payload = append(payload, length[:]...)
+	payload = append(payload, value...)
+	return append(payload, '\n')
+}
+
+// journalPayload renders 'record' as a native protocol message
+func (sink *journaldSink) journalPayload(record Record) []byte {
+	var payload []byte
+
+	payload = appendJournalField(payload, "MESSAGE", record.Context+record.Message)
+	payload = appendJournalField(payload, "PRIORITY", strconv.Itoa(record.Level.syslogSeverity()))
+	payload = appendJournalField(payload, "SYSLOG_IDENTIFIER", sink.config.SyslogIdentifier)
+
+	if record.CallerFile != "" {
+		payload = appendJournalField(payload, "CODE_FILE", record.CallerFile)
+		payload = appendJournalField(payload, "CODE_LINE", strconv.Itoa(record.CallerLine))
+		payload = appendJournalField(payload, "CODE_FUNC", record.CallerFunction)
+	}
+
+	for _, field := range record.Fields {
+		if name := journalFieldName(field.Key); name != "" {
+			payload = appendJournalField(payload, name, fieldString(field.Value))
+		}
+	}
+
+	return payload
+}
+
+// send writes 'payload' to journald. Payloads too large for a datagram are written to a file whose descriptor is
+// passed to journald instead
+func (sink *journaldSink) send(payload []byte) error {
+	_, err := sink.conn.Write(payload)
+	if err != nil && isMessageTooLarge(err) {
+		return sendJournalPayloadFile(sink.conn, payload)
+	}
+
+	return err
+}
+
+func (sink *journaldSink) Write(record Record) error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.isClosed {
+		return errors.New("Unable to write to journald because: the sink is closed")
+	}
+
+	payload := sink.journalPayload(record)
+
+	// journald restarting leaves the connection pointing at its old socket, so a failed write is tried on a fresh one
+	for attempt := 0; attempt < 2; attempt++ {
+		if sink.conn == nil {
+			if time.Now().Before(sink.nextDial) {
+				break
+			}
+
+			if err := sink.connect(); err != nil {
+				sink.nextDial = time.Now().Add(journaldRedialDelay)
+				break
+			}
+		}
+
+		if err := sink.send(payload); err == nil {
+			sink.counters.Delivered++
+			return nil
+		}
+
+		sink.conn.Close()
+		sink.conn = nil
+	}
+
+	sink.counters.Dropped++
+	return nil
+}
+
+// writesCaller returns true, since entries carry the source location of records as CODE_FILE, CODE_LINE and CODE_FUNC
+func (sink *journaldSink) writesCaller() bool {
+	return true
+}
+
+// DeliveryCounters returns how many records were delivered to journald and how many were dropped
+func (sink *journaldSink) DeliveryCounters() DeliveryCounters {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	return sink.counters
+}
+
+func (sink *journaldSink) Flush() error {
+	return nil
+}
+
+func (sink *journaldSink) Close() error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	sink.isClosed = true
+	if sink.conn == nil {
+		return nil
+	}
+
+	err := sink.conn.Close()
+	sink.conn = nil
+
+	return err
+}
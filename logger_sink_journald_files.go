@@ -0,0 +1,88 @@
+//go:build !windows
+// +build !windows
+
+/*
+	File holding the large payload path of the journald sink, which passes payloads to journald as file descriptors
+*/
+
+package golog
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+)
+
+// journalPayloadDirectories are where files holding large payloads are created when no sealed memory file can be. journald
+// only accepts unsealed files from unprivileged senders in these directories. '/dev/shm' comes first, as it is memory
+// backed on systemd hosts, so the payloads never reach a disk
+var journalPayloadDirectories = []string{"/dev/shm", "/tmp"}
+
+// isMessageTooLarge returns true if 'err' was returned because a datagram exceeded the socket's size limit
+func isMessageTooLarge(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+
+	if syscallErr, ok := err.(*os.SyscallError); ok {
+		err = syscallErr.Err
+	}
+
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// sendJournalPayloadFile writes 'payload' to a sealed memory file, or else to an unlinked temporary file, and passes its
+// descriptor to journald over 'conn', which is how journald accepts messages too large for a datagram
+func sendJournalPayloadFile(conn *net.UnixConn, payload []byte) error {
+	file, err := createSealedJournalPayload(payload)
+	if err != nil {
+		file, err = createJournalPayloadFile(payload)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// sent with sendmsg directly since the net package refuses an empty destination on a connected socket
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	err = rawConn.Write(func(descriptor uintptr) bool {
+		sendErr = syscall.Sendmsg(int(descriptor), nil, syscall.UnixRights(int(file.Fd())), nil, 0)
+		return sendErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+// createJournalPayloadFile returns an unlinked temporary file holding 'payload', created in the first of
+// 'journalPayloadDirectories' that takes it
+func createJournalPayloadFile(payload []byte) (*os.File, error) {
+	var err error
+	for _, directory := range journalPayloadDirectories {
+		var file *os.File
+		file, err = ioutil.TempFile(directory, "golog-journal")
+		if err != nil {
+			continue
+		}
+
+		// journald only needs the descriptor, and the file disappears once both sides have closed it
+		os.Remove(file.Name())
+
+		if _, err = file.Write(payload); err != nil {
+			file.Close()
+			continue
+		}
+
+		return file, nil
+	}
+
+	return nil, err
+}
@@ -0,0 +1,20 @@
+/*
+	File holding the large payload path of the journald sink on windows, where journald does not exist
+*/
+
+package golog
+
+import (
+	"errors"
+	"net"
+)
+
+// isMessageTooLarge returns false, since descriptors can't be passed to journald on windows
+func isMessageTooLarge(err error) bool {
+	return false
+}
+
+// sendJournalPayloadFile returns an error, since descriptors can't be passed to journald on windows
+func sendJournalPayloadFile(conn *net.UnixConn, payload []byte) error {
+	return errors.New("Unable to pass a log payload to journald because: file descriptors can't be passed on windows")
+}
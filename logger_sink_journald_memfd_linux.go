@@ -0,0 +1,55 @@
+/*
+	File holding the sealed memory file journald is passed large payloads in on linux
+*/
+
+package golog
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	memfdCloseOnExec    = 0x1                   // MFD_CLOEXEC, closes the memory file in programs started by the process
+	memfdAllowSealing   = 0x2                   // MFD_ALLOW_SEALING, lets seals be added to the memory file
+	fcntlAddSeals       = 1033                  // F_ADD_SEALS, the fcntl command adding seals to a memory file
+	journalPayloadSeals = 0x1 | 0x2 | 0x4 | 0x8 // F_SEAL_SEAL, F_SEAL_SHRINK, F_SEAL_GROW and F_SEAL_WRITE, which freeze the file
+)
+
+// memfdCreateSyscalls holds the number of the memfd_create system call on each architecture, since the syscall package
+// doesn't define it on most of them
+var memfdCreateSyscalls = map[string]uintptr{"386": 356, "amd64": 319, "arm": 385, "arm64": 279, "loong64": 279, "mips": 4354, "mipsle": 4354, "mips64": 5314, "mips64le": 5314, "ppc64": 360, "ppc64le": 360, "riscv64": 279, "s390x": 350}
+
+// createSealedJournalPayload returns a sealed memory file holding 'payload', which journald accepts from any sender
+func createSealedJournalPayload(payload []byte) (*os.File, error) {
+	memfdCreate, ok := memfdCreateSyscalls[runtime.GOARCH]
+	if !ok {
+		return nil, errors.New("memfd_create is not known on " + runtime.GOARCH)
+	}
+
+	name, err := syscall.BytePtrFromString("golog-journal")
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, _, errno := syscall.Syscall(memfdCreate, uintptr(unsafe.Pointer(name)), memfdCloseOnExec|memfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	file := os.NewFile(descriptor, "golog-journal")
+	if _, err = file.Write(payload); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, _, errno = syscall.Syscall(syscall.SYS_FCNTL, descriptor, fcntlAddSeals, journalPayloadSeals); errno != 0 {
+		file.Close()
+		return nil, errno
+	}
+
+	return file, nil
+}
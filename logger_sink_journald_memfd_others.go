@@ -0,0 +1,18 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+/*
+	File holding the sealed memory file journald is passed large payloads in, which only linux provides
+*/
+
+package golog
+
+import (
+	"errors"
+	"os"
+)
+
+// createSealedJournalPayload returns an error, since memory files can only be sealed on linux
+func createSealedJournalPayload(payload []byte) (*os.File, error) {
+	return nil, errors.New("sealed memory files are only available on linux")
+}
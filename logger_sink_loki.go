@@ -0,0 +1,273 @@
+/*
+	File holding the sink that pushes records to Grafana Loki
+*/
+
+package golog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	lokiPushPath       = "/loki/api/v1/push" // The path of Loki's push API, used if the configured URL has no path
+	lokiLabelLevel     = "level"             // The name of 'LabelFields' entries taken from the level of records
+	lokiLabelContext   = "context"           // The name of 'LabelFields' entries taken from the context of records
+	lokiDefaultJobName = "job"               // The label identifying the program if no static labels are configured
+)
+
+// LokiConfig configures an output pushing records to Grafana Loki
+type LokiConfig struct {
+	URL                string            // The address of Loki, such as 'http://loki:3100'. If it has no path, '/loki/api/v1/push' is used
+	Labels             map[string]string // Labels every stream carries. If unset, 'job' is set to the name of the program
+	LabelFields        []string          // The names of record values turned into labels: 'level', 'context' or the key of a field. Only use values with few distinct values
+	Format             LoggingFormat     // The format log lines are rendered in. If unset, 'FormatJSON' is used. 'FormatBinary' is not supported
+	Headers            map[string]string // Headers added to every request, such as 'X-Scope-OrgID' or 'Authorization'
+	Gzip               bool              // If true, request bodies are gzip compressed
+	MaxBatchRecords    int               // The number of records pushed at once. If unset, 500 is used
+	MaxBatchBytes      int               // The number of bytes pushed at once, before compression. If unset, 1 MiB is used
+	BatchInterval      time.Duration     // How long a batch that is not full waits for more records. If unset, one second is used
+	MaxBufferedRecords int               // The number of records buffered while Loki can't be reached. If unset, 10000 is used
+	MaxBufferedBytes   int               // The number of bytes buffered while Loki can't be reached. If unset, 8 MiB is used
+	MinBackoff         time.Duration     // The delay before the first retry, doubled after each further failure. If unset, 100 milliseconds is used
+	MaxBackoff         time.Duration     // The longest delay between retries. If unset, 30 seconds is used
+	Timeout            time.Duration     // How long a request may take. If unset, 10 seconds is used. Unused if 'Client' is set
+	FlushTimeout       time.Duration     // How long 'Flush' and 'Shutdown' wait for buffered records to be pushed. If unset, 5 seconds is used
+	Client             *http.Client      `json:"-"` // The client requests are sent with, e.g. to configure TLS. If nil, a client with 'Timeout' is used
+	Spool              *SpoolConfig      // The directory records spill to once the buffer is full, replayed in order once Loki is back. If nil, the oldest records are dropped
+	Levels             LevelFilter       // The levels pushed. If unset, every level is pushed
+}
+
+// lokiSink pushes records to Loki in batches from a background goroutine. Each queued entry holds the JSON object of
+// the record's stream labels and the JSON array of its timestamp and line, separated by a newline
+type lokiSink struct {
+	config    LokiConfig     // The configuration, with defaults filled in
+	formatter Formatter      // Renders each log line
+	poster    httpPoster     // Sends the batches
+	queue     *deliveryQueue // Buffers the entries and pushes them in batches
+}
+
+// NewLokiSink returns a sink pushing records to Loki's push API in batches, grouped into streams by their labels.
+// Failed pushes are retried as described for 'NewHTTPSink'. An error is returned if the configuration is invalid
+func NewLokiSink(config LokiConfig) (Sink, error) {
+	return newLokiSink(config, afero.NewOsFs())
+}
+
+// newLokiSink returns the sink described by 'config', spooling records on the filesystem 'osPtr'
+func newLokiSink(config LokiConfig, osPtr afero.Fs) (Sink, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(config.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, errors.New("Invalid URL '" + config.URL + "' provided. Use an 'http' or 'https' URL")
+	}
+
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = lokiPushPath
+		config.URL = endpoint.String()
+	}
+
+	if config.Format == 0 {
+		config.Format = FormatJSON
+	} else if !config.Format.IsValidFormat() {
+		return nil, errors.New("Invalid log format provided. See formats in 'logging_formats.go'")
+	} else if config.Format == FormatBinary {
+		return nil, errors.New("The binary log format only applies to log files")
+	}
+
+	if len(config.Labels) == 0 {
+		config.Labels = map[string]string{lokiDefaultJobName: filepath.Base(os.Args[0])}
+	}
+
+	for name := range config.Labels {
+		if lokiLabelName(name) == "" {
+			return nil, errors.New("Invalid Loki label name '" + name + "' provided. Label names need at least one character")
+		}
+	}
+
+	for _, name := range config.LabelFields {
+		if lokiLabelName(name) == "" {
+			return nil, errors.New("Invalid Loki label field '" + name + "' provided. Label fields need at least one character")
+		}
+	}
+
+	if config.MaxBatchRecords <= 0 {
+		config.MaxBatchRecords = defaultHTTPBatchRecords
+	}
+
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaultHTTPBatchBytes
+	}
+
+	if config.BatchInterval <= 0 {
+		config.BatchInterval = defaultHTTPBatchInterval
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+
+	spool, err := openDiskSpool(config.Spool, osPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &lokiSink{config: config, formatter: newFormatter(config.Format, LinePolicyEscape, resolveCEFConfig(CEFConfig{}), nil, false)}
+	sink.poster = httpPoster{config.URL, http.MethodPost, "application/json", config.Headers, config.Gzip, config.Client}
+	sink.queue = newDeliveryQueue(deliveryOptions{
+		maxBufferedRecords: config.MaxBufferedRecords,
+		maxBufferedBytes:   config.MaxBufferedBytes,
+		maxBatchRecords:    config.MaxBatchRecords,
+		maxBatchBytes:      config.MaxBatchBytes,
+		batchInterval:      config.BatchInterval,
+		minBackoff:         config.MinBackoff,
+		maxBackoff:         config.MaxBackoff,
+		flushTimeout:       config.FlushTimeout,
+		spool:              spool,
+	}, sink.deliver)
+
+	return withLevelFilter(sink, config.Levels), nil
+}
+
+// isLokiLabelRune returns true if 'r' may be part of a Loki label name
+func isLokiLabelRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'
+}
+
+// lokiLabelName returns 'name' as a Loki label name, which may not start with a digit
+func lokiLabelName(name string) string {
+	name = sanitizeFieldKey(name, isLokiLabelRune)
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// streamLabels returns the JSON object of the labels of the stream 'record' belongs to. Labels with empty values are
+// left out, as Loki ignores them
+func (sink *lokiSink) streamLabels(record Record) []byte {
+	labels := make(map[string]string, len(sink.config.Labels)+len(sink.config.LabelFields))
+	for name, value := range sink.config.Labels {
+		labels[lokiLabelName(name)] = value
+	}
+
+	for _, labelField := range sink.config.LabelFields {
+		var value string
+		switch labelField {
+		case lokiLabelLevel:
+			value = strings.ToLower(record.Level.String())
+		case lokiLabelContext:
+			value = strings.TrimSpace(record.Context)
+		default:
+			for _, field := range record.Fields {
+				if field.Key == labelField {
+					value = fieldString(field.Value)
+				}
+			}
+		}
+
+		if value != "" {
+			labels[lokiLabelName(labelField)] = value
+		}
+	}
+
+	// maps are encoded with sorted keys, so records with the same labels share a stream
+	encoded, _ := json.Marshal(labels)
+	return encoded
+}
+
+func (sink *lokiSink) Write(record Record) error {
+	var stringBuilder strings.Builder
+
+	stringBuilder.Write(sink.streamLabels(record))
+	stringBuilder.WriteString("\n[\"")
+	stringBuilder.WriteString(strconv.FormatInt(record.Time.UnixNano(), 10))
+	stringBuilder.WriteString("\",")
+	writeJSONString(&stringBuilder, strings.TrimSuffix(string(sink.formatter.Format(record)), "\n"))
+	stringBuilder.WriteString("]")
+
+	if !sink.queue.enqueue([]byte(stringBuilder.String())) {
+		return errors.New("Unable to push to '" + sink.config.URL + "' because: the sink is closed")
+	}
+
+	return nil
+}
+
+// pushBody returns the push request body holding 'batch', with the entries grouped into streams by their labels. Streams
+// are ordered by their first entry, and the entries of a stream keep their order
+func pushBody(batch [][]byte) []byte {
+	var streamOrder []string
+	streamValues := make(map[string][][]byte)
+	for _, entry := range batch {
+		separator := bytes.IndexByte(entry, '\n')
+		labels := string(entry[:separator])
+
+		if _, exists := streamValues[labels]; !exists {
+			streamOrder = append(streamOrder, labels)
+		}
+		streamValues[labels] = append(streamValues[labels], entry[separator+1:])
+	}
+
+	var body bytes.Buffer
+	body.WriteString(`{"streams":[`)
+	for streamIndex, labels := range streamOrder {
+		if streamIndex > 0 {
+			body.WriteByte(',')
+		}
+
+		body.WriteString(`{"stream":`)
+		body.WriteString(labels)
+		body.WriteString(`,"values":[`)
+		body.Write(bytes.Join(streamValues[labels], []byte(",")))
+		body.WriteString(`]}`)
+	}
+	body.WriteString(`]}`)
+
+	return body.Bytes()
+}
+
+// deliver pushes 'batch' to Loki
+func (sink *lokiSink) deliver(batch [][]byte) error {
+	_, err := sink.poster.post(pushBody(batch))
+	return err
+}
+
+// writesCaller returns true if the sink's format includes the source location of records
+func (sink *lokiSink) writesCaller() bool {
+	return sink.config.Format.needsCaller()
+}
+
+// DeliveryCounters returns how many records were pushed, dropped and retried, and how many are buffered
+func (sink *lokiSink) DeliveryCounters() DeliveryCounters {
+	return sink.queue.deliveryCounters()
+}
+
+// Flush pushes the buffered records without waiting for batches to fill, waiting up to the flush timeout for them to be
+// accepted. Records not accepted by then stay buffered
+func (sink *lokiSink) Flush() error {
+	sink.queue.flush()
+	return nil
+}
+
+// Close pushes the buffered records, waiting up to the flush timeout for them to be accepted, and drops the rest
+func (sink *lokiSink) Close() error {
+	sink.queue.close()
+	return nil
+}
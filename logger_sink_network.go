@@ -0,0 +1,223 @@
+/*
+	File holding the sink that ships records to a collector over TCP, TLS or UDP
+*/
+
+package golog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	defaultNetworkWriteTimeout = 5 * time.Second // How long connecting to and writing to the collector may take if not configured
+)
+
+// NetworkConfig configures an output shipping records to a collector over a socket
+type NetworkConfig struct {
+	Network            string         // 'tcp' or 'udp'
+	Address            string         // The address of the collector, as 'host:port'
+	UseTLS             bool           // If true, TCP connections are secured with TLS
+	TLSConfig          *tls.Config    `json:"-"` // The TLS settings used if 'UseTLS' is set. If nil, the collector's certificate is verified against the system roots
+	Format             LoggingFormat  // The format records are sent in. If unset, 'FormatJSON' is used. 'FormatBinary' is not supported
+	Framing            LoggingFraming // How records are separated on TCP connections. If unset, 'FramingNewline' is used. Each UDP datagram holds one record
+	MaxBufferedRecords int            // The number of records buffered while the collector can't be reached. If unset, 10000 is used
+	MaxBufferedBytes   int            // The number of bytes buffered while the collector can't be reached. If unset, 8 MiB is used
+	MinBackoff         time.Duration  // The delay before the first reconnect, doubled after each further failure. If unset, 100 milliseconds is used
+	MaxBackoff         time.Duration  // The longest delay between reconnects. If unset, 30 seconds is used
+	WriteTimeout       time.Duration  // How long connecting and writing may take before the attempt fails. If unset, 5 seconds is used
+	FlushTimeout       time.Duration  // How long 'Flush' and 'Shutdown' wait for buffered records to be sent. If unset, 5 seconds is used
+	Spool              *SpoolConfig   // The directory records spill to once the buffer is full, replayed in order once the collector is back. If nil, the oldest records are dropped
+	Levels             LevelFilter    // The levels sent to the collector. If unset, every level is sent
+}
+
+// networkSink ships records to a collector from a background goroutine, so the logger never waits on the network
+type networkSink struct {
+	config    NetworkConfig  // The configuration, with defaults filled in
+	formatter Formatter      // Renders each record
+	queue     *deliveryQueue // Buffers the framed records and delivers them
+	mux       sync.Mutex     // Guards 'conn', which only the queue's goroutine and 'Close' use
+	conn      net.Conn       // The connection to the collector. nil while disconnected
+}
+
+// NewNetworkSink returns a sink shipping each record to the collector described by 'config'. Records are buffered in
+// memory and sent from the background, reconnecting with exponential backoff while the collector can't be reached.
+// Once the buffer is full the oldest records are dropped, so logging never blocks. An error is returned if the
+// configuration is invalid
+func NewNetworkSink(config NetworkConfig) (Sink, error) {
+	return newNetworkSink(config, afero.NewOsFs())
+}
+
+// newNetworkSink returns the sink described by 'config', spooling records on the filesystem 'osPtr'
+func newNetworkSink(config NetworkConfig, osPtr afero.Fs) (Sink, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Network != "tcp" && config.Network != "udp" {
+		return nil, errors.New("Invalid network '" + config.Network + "' provided. Use 'tcp' or 'udp'")
+	}
+
+	if config.UseTLS && config.Network != "tcp" {
+		return nil, errors.New("TLS is only supported over 'tcp'")
+	}
+
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return nil, errors.New("Invalid collector address '" + config.Address + "' provided because: " + err.Error())
+	}
+
+	if config.Format == 0 {
+		config.Format = FormatJSON
+	} else if !config.Format.IsValidFormat() {
+		return nil, errors.New("Invalid log format provided. See formats in 'logging_formats.go'")
+	} else if config.Format == FormatBinary {
+		return nil, errors.New("The binary log format only applies to log files")
+	}
+
+	if config.Framing == 0 {
+		config.Framing = FramingNewline
+	} else if !config.Framing.IsValidFraming() {
+		return nil, errors.New("Invalid framing provided. See framings in 'logging_framings.go'")
+	}
+
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultNetworkWriteTimeout
+	}
+
+	spool, err := openDiskSpool(config.Spool, osPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &networkSink{config: config, formatter: newFormatter(config.Format, LinePolicyEscape, resolveCEFConfig(CEFConfig{}), nil, false)}
+	sink.queue = newDeliveryQueue(deliveryOptions{
+		maxBufferedRecords: config.MaxBufferedRecords,
+		maxBufferedBytes:   config.MaxBufferedBytes,
+		minBackoff:         config.MinBackoff,
+		maxBackoff:         config.MaxBackoff,
+		flushTimeout:       config.FlushTimeout,
+		spool:              spool,
+	}, sink.deliver)
+
+	return withLevelFilter(sink, config.Levels), nil
+}
+
+// connect dials the collector. The caller must hold 'mux'
+func (sink *networkSink) connect() error {
+	var stringBuilder strings.Builder
+
+	dialer := &net.Dialer{Timeout: sink.config.WriteTimeout}
+
+	var conn net.Conn
+	var err error
+	if sink.config.UseTLS {
+		tlsConfig := sink.config.TLSConfig
+		if tlsConfig == nil {
+			host, _, _ := net.SplitHostPort(sink.config.Address)
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+
+		conn, err = tls.DialWithDialer(dialer, "tcp", sink.config.Address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial(sink.config.Network, sink.config.Address)
+	}
+
+	if err != nil {
+		stringBuilder.WriteString("Could not connect to '")
+		stringBuilder.WriteString(sink.config.Address)
+		stringBuilder.WriteString("' because: ")
+		stringBuilder.WriteString(err.Error())
+
+		return errors.New(stringBuilder.String())
+	}
+
+	sink.conn = conn
+	return nil
+}
+
+// deliver sends 'batch' to the collector, connecting first if needed. The connection is dropped on any error, so the
+// retry starts on a fresh one. Records of a batch that failed part way through may reach the collector twice
+func (sink *networkSink) deliver(batch [][]byte) error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.conn == nil {
+		if err := sink.connect(); err != nil {
+			return err
+		}
+	}
+
+	sink.conn.SetWriteDeadline(time.Now().Add(sink.config.WriteTimeout))
+
+	var err error
+	if sink.config.Network == "udp" {
+		for _, record := range batch {
+			if _, err = sink.conn.Write(record); err != nil {
+				break
+			}
+		}
+	} else {
+		_, err = sink.conn.Write(bytes.Join(batch, nil))
+	}
+
+	if err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+	}
+
+	return err
+}
+
+func (sink *networkSink) Write(record Record) error {
+	var payload = sink.formatter.Format(record)
+	if sink.config.Network == "udp" {
+		payload = bytes.TrimSuffix(payload, []byte("\n"))
+	} else {
+		payload = sink.config.Framing.frame(payload)
+	}
+
+	if !sink.queue.enqueue(payload) {
+		return errors.New("Unable to send to '" + sink.config.Address + "' because: the sink is closed")
+	}
+
+	return nil
+}
+
+// writesCaller returns true if the sink's format includes the source location of records
+func (sink *networkSink) writesCaller() bool {
+	return sink.config.Format.needsCaller()
+}
+
+// DeliveryCounters returns how many records were sent, dropped and retried, and how many are buffered
+func (sink *networkSink) DeliveryCounters() DeliveryCounters {
+	return sink.queue.deliveryCounters()
+}
+
+// Flush waits up to the flush timeout for the buffered records to be sent. Records not sent by then stay buffered
+func (sink *networkSink) Flush() error {
+	sink.queue.flush()
+	return nil
+}
+
+func (sink *networkSink) Close() error {
+	sink.queue.close()
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+
+	err := sink.conn.Close()
+	sink.conn = nil
+
+	return err
+}
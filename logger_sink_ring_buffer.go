@@ -0,0 +1,105 @@
+/*
+	File holding the sink that keeps the most recent records in memory so they can be queried
+*/
+
+package golog
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultRingBufferCapacity = 5000 // The number of records kept if not configured
+)
+
+// RingBufferConfig configures an output keeping the most recent records in memory
+type RingBufferConfig struct {
+	Capacity int         // The number of records kept. Once reached, each new record replaces the oldest one. If unset, 5000 is used
+	Levels   LevelFilter // The levels kept. If unset, every level is kept
+}
+
+// RingBuffer is a sink keeping the most recent records in memory, to be looked at with 'Query' while the program runs.
+// It is safe to query while records are written
+type RingBuffer struct {
+	mux     sync.RWMutex     // Guards the fields below, letting queries run alongside each other
+	config  RingBufferConfig // The configuration, with defaults filled in
+	records []Record         // The kept records. Once full, 'next' is the oldest
+	next    int              // The index the next record is written to
+	isFull  bool             // If true, every slot of 'records' holds a record
+}
+
+// NewRingBuffer returns a sink keeping the last 'Capacity' records. An error is returned if the configuration is invalid
+func NewRingBuffer(config RingBufferConfig) (*RingBuffer, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Capacity < 0 {
+		return nil, errors.New("Invalid ring buffer capacity '" + strconv.Itoa(config.Capacity) + "' provided. The capacity may not be negative")
+	}
+
+	if config.Capacity == 0 {
+		config.Capacity = defaultRingBufferCapacity
+	}
+
+	return &RingBuffer{config: config, records: make([]Record, config.Capacity)}, nil
+}
+
+func (ringBuffer *RingBuffer) Write(record Record) error {
+	if !ringBuffer.config.Levels.allows(record.Level) {
+		return nil
+	}
+
+	ringBuffer.mux.Lock()
+	defer ringBuffer.mux.Unlock()
+
+	ringBuffer.records[ringBuffer.next] = record
+	ringBuffer.next++
+	if ringBuffer.next == len(ringBuffer.records) {
+		ringBuffer.next = 0
+		ringBuffer.isFull = true
+	}
+
+	return nil
+}
+
+// Query returns the kept records selected by 'filter', newest first. If 'limit' is above 0, at most that many records
+// are returned. An error is returned if the filter is invalid
+func (ringBuffer *RingBuffer) Query(filter RecordFilter, limit int) ([]Record, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	ringBuffer.mux.RLock()
+	defer ringBuffer.mux.RUnlock()
+
+	var count = ringBuffer.next
+	if ringBuffer.isFull {
+		count = len(ringBuffer.records)
+	}
+
+	var matches []Record
+	for offset := 1; offset <= count; offset++ {
+		if limit > 0 && len(matches) == limit {
+			break
+		}
+
+		record := ringBuffer.records[(ringBuffer.next-offset+len(ringBuffer.records))%len(ringBuffer.records)]
+		if filter.matches(record) {
+			matches = append(matches, record)
+		}
+	}
+
+	return matches, nil
+}
+
+func (ringBuffer *RingBuffer) Flush() error {
+	return nil
+}
+
+// Close keeps the records, so they can still be queried after the logger shut down
+func (ringBuffer *RingBuffer) Close() error {
+	return nil
+}
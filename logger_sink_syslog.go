@@ -0,0 +1,425 @@
+/*
+	File holding the sink that writes to a syslog daemon
+*/
+
+package golog
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyslogStructuredDataID = "fields@32473" // The SD-ID fields are written under if not configured. 32473 is the private enterprise number reserved for examples
+	syslogRedialDelay             = time.Second    // The time waited before dialing the daemon again after a failed dial
+	defaultSyslogWriteTimeout     = time.Second    // How long connecting to and writing to the daemon may take if not configured
+)
+
+// localSyslogPaths are the paths the local syslog daemon listens on across platforms
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogConfig configures an output writing to a syslog daemon
+type SyslogConfig struct {
+	Network          string                // The network of the daemon: 'udp', 'tcp', 'unix' or 'unixgram'. If unset, the local daemon's socket is used
+	Address          string                // The address of the daemon, as 'host:port' or a socket path. Unused if 'Network' is unset
+	Protocol         LoggingSyslogProtocol // The message format. If unset, 'SyslogRFC3164' is used for the local daemon and 'SyslogRFC5424' otherwise
+	Facility         string                // The facility messages are logged as, such as 'daemon' or 'local0'. If unset, 'user' is used
+	AppName          string                // The application name messages carry. If unset, the name of the program is used
+	Hostname         string                // The host name messages carry. If unset, the name of the host is used
+	OctetCounting    bool                  // If true, messages over TCP and unix stream sockets are prefixed with their length ( RFC 6587 ) instead of ending with a newline
+	StructuredDataID string                // The SD-ID of the RFC 5424 structured data element holding the fields. If unset, 'fields@32473' is used
+	WriteTimeout     time.Duration         // How long connecting and writing may take before the attempt fails. If unset, one second is used
+	FlushTimeout     time.Duration         // How long 'Flush' and 'Shutdown' wait for the records buffered for a TCP daemon to be sent. If unset, 5 seconds is used
+	Levels           LevelFilter           // The levels written to syslog. If unset, every level is written
+}
+
+// syslogSink writes records to a syslog daemon, reconnecting when the connection is lost. Records for a TCP daemon are
+// sent from a background goroutine, so a slow or unreachable remote daemon never holds up the logger
+type syslogSink struct {
+	mux          sync.Mutex       // Serializes writes and reconnects
+	config       SyslogConfig     // The configuration, with defaults filled in
+	facilityCode int              // The code of the configured facility
+	procID       string           // The process id messages carry
+	conn         net.Conn         // The connection to the daemon. nil while disconnected
+	isStream     bool             // If true, the connection is a stream, so messages are framed. Set by 'connect' for the local daemon
+	nextDial     time.Time        // The earliest time the daemon is dialed again after a failed dial
+	counters     DeliveryCounters // What happened to the records written directly so far
+	queue        *deliveryQueue   // Buffers the framed records and delivers them. Only set for TCP
+	isClosed     bool             // If true, the sink was closed and may not be written to
+}
+
+// NewSyslogSink returns a sink writing each record to the syslog daemon described by 'config'. An error is returned if
+// the configuration is invalid or the daemon can't be reached. Once connected, records logged while the daemon can't be
+// reached are dropped, and the daemon is dialed again until it is back. Over TCP, records are instead buffered and sent
+// from the background as described for 'NewNetworkSink'
+func NewSyslogSink(config SyslogConfig) (Sink, error) {
+	if err := config.Levels.validate(); err != nil {
+		return nil, err
+	}
+
+	facilityCode, err := syslogFacilityCode(config.Facility)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Network != "" && config.Network != "udp" && config.Network != "tcp" && config.Network != "unix" && config.Network != "unixgram" {
+		return nil, errors.New("Invalid syslog network '" + config.Network + "' provided. Use 'udp', 'tcp', 'unix' or 'unixgram'")
+	}
+
+	if config.Protocol == 0 {
+		config.Protocol = SyslogRFC5424
+		if config.Network == "" {
+			config.Protocol = SyslogRFC3164
+		}
+	} else if !config.Protocol.IsValidSyslogProtocol() {
+		return nil, errors.New("Invalid syslog protocol provided. See protocols in 'logging_syslog_protocols.go'")
+	}
+
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+
+	if config.Hostname == "" {
+		config.Hostname = getHostname()
+	}
+
+	if config.StructuredDataID == "" {
+		config.StructuredDataID = defaultSyslogStructuredDataID
+	}
+
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultSyslogWriteTimeout
+	}
+
+	sink := &syslogSink{config: config, facilityCode: facilityCode, procID: strconv.Itoa(os.Getpid())}
+	sink.isStream = config.Network == "tcp" || config.Network == "unix"
+	err = sink.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Network == "tcp" {
+		sink.queue = newDeliveryQueue(deliveryOptions{flushTimeout: config.FlushTimeout}, sink.deliver)
+	}
+
+	return withLevelFilter(sink, config.Levels), nil
+}
+
+// connect dials the daemon. The caller must hold 'mux', unless the sink is still being created
+func (sink *syslogSink) connect() error {
+	var stringBuilder strings.Builder
+
+	dialer := &net.Dialer{Timeout: sink.config.WriteTimeout}
+
+	if sink.config.Network != "" {
+		conn, err := dialer.Dial(sink.config.Network, sink.config.Address)
+		if err != nil {
+			stringBuilder.WriteString("Could not connect to syslog at '")
+			stringBuilder.WriteString(sink.config.Address)
+			stringBuilder.WriteString("' because: ")
+			stringBuilder.WriteString(err.Error())
+
+			return errors.New(stringBuilder.String())
+		}
+
+		sink.conn = conn
+		return nil
+	}
+
+	for _, socketPath := range localSyslogPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := dialer.Dial(network, socketPath); err == nil {
+				sink.conn = conn
+				sink.isStream = network == "unix"
+				return nil
+			}
+		}
+	}
+
+	return errors.New("Could not connect to the local syslog daemon. No socket was found at " + strings.Join(localSyslogPaths, ", "))
+}
+
+// syslogHeaderField returns 'value' made safe for a header field of at most 'maxLength' characters, or '-' if it is empty
+func syslogHeaderField(value string, maxLength int) string {
+	if value == "" {
+		return "-"
+	}
+
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if len(value) > maxLength {
+		value = value[:maxLength]
+	}
+
+	return value
+}
+
+// isSDNameRune returns true if 'r' may be part of an RFC 5424 SD-NAME
+func isSDNameRune(r rune) bool {
+	return r > ' ' && r <= '~' && r != '=' && r != ']' && r != '"'
+}
+
+// sdParamName returns 'key' as an RFC 5424 SD-NAME of at most 32 characters that is not in 'usedNames'. A key without
+// a valid character is named 'field', and a name already used gets a number appended
+func sdParamName(key string, usedNames map[string]bool) string {
+	var baseName = sanitizeFieldKey(key, isSDNameRune)
+	if baseName == "" {
+		baseName = "field"
+	}
+	if len(baseName) > 32 {
+		baseName = baseName[:32]
+	}
+
+	var paramName = baseName
+	for number := 2; usedNames[paramName]; number++ {
+		var suffix = "_" + strconv.Itoa(number)
+		if len(baseName)+len(suffix) > 32 {
+			paramName = baseName[:32-len(suffix)] + suffix
+		} else {
+			paramName = baseName + suffix
+		}
+	}
+
+	return paramName
+}
+
+// escapeSDParamValue escapes the characters RFC 5424 requires escaping in structured data values
+func escapeSDParamValue(value string) string {
+	var stringBuilder strings.Builder
+	for _, r := range value {
+		if r == '"' || r == '\\' || r == ']' {
+			stringBuilder.WriteByte('\\')
+		}
+		stringBuilder.WriteRune(r)
+	}
+
+	return stringBuilder.String()
+}
+
+// formatRFC5424 renders 'record' as an RFC 5424 message. The logger's context is the MSGID and fields are written as
+// structured data
+func (sink *syslogSink) formatRFC5424(record Record, logText string) string {
+	var stringBuilder strings.Builder
+
+	stringBuilder.WriteString("<")
+	stringBuilder.WriteString(strconv.Itoa(syslogPriority(sink.facilityCode, record.Level)))
+	stringBuilder.WriteString(">1 ")
+	stringBuilder.WriteString(record.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(syslogHeaderField(sink.config.Hostname, 255))
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(syslogHeaderField(sink.config.AppName, 48))
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(syslogHeaderField(sink.procID, 128))
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(syslogHeaderField(strings.TrimSpace(record.Context), 32))
+	stringBuilder.WriteString(" ")
+
+	if len(record.Fields) == 0 {
+		stringBuilder.WriteString("-")
+	} else {
+		stringBuilder.WriteString("[")
+		stringBuilder.WriteString(syslogHeaderField(sink.config.StructuredDataID, 32))
+		var paramNames = make(map[string]bool, len(record.Fields))
+		for _, field := range record.Fields {
+			var paramName = sdParamName(field.Key, paramNames)
+			paramNames[paramName] = true
+
+			stringBuilder.WriteString(" ")
+			stringBuilder.WriteString(paramName)
+			stringBuilder.WriteString("=\"")
+			stringBuilder.WriteString(escapeSDParamValue(fieldString(field.Value)))
+			stringBuilder.WriteString("\"")
+		}
+		stringBuilder.WriteString("]")
+	}
+
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(logText)
+
+	return stringBuilder.String()
+}
+
+// formatRFC3164 renders 'record' as an RFC 3164 message. The format has no place for fields, so they follow the log
+// text as 'key=value' pairs
+func (sink *syslogSink) formatRFC3164(record Record, logText string) string {
+	var stringBuilder strings.Builder
+
+	var tag = sanitizeFieldKey(sink.config.AppName, isAlphanumericRune)
+	if len(tag) > 32 {
+		tag = tag[:32]
+	}
+
+	stringBuilder.WriteString("<")
+	stringBuilder.WriteString(strconv.Itoa(syslogPriority(sink.facilityCode, record.Level)))
+	stringBuilder.WriteString(">")
+	stringBuilder.WriteString(record.Time.Format(time.Stamp))
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(syslogHeaderField(sink.config.Hostname, 255))
+	stringBuilder.WriteString(" ")
+	stringBuilder.WriteString(tag)
+	stringBuilder.WriteString("[")
+	stringBuilder.WriteString(sink.procID)
+	stringBuilder.WriteString("]: ")
+	stringBuilder.WriteString(record.Context)
+	stringBuilder.WriteString(logText)
+
+	for _, field := range record.Fields {
+		var value = fieldString(field.Value)
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+
+		stringBuilder.WriteString(" ")
+		stringBuilder.WriteString(sanitizeFieldKey(field.Key, isSDNameRune))
+		stringBuilder.WriteString("=")
+		stringBuilder.WriteString(value)
+	}
+
+	return stringBuilder.String()
+}
+
+// frame returns the bytes sent to the daemon for 'record'. Datagrams carry one message each. On streams, messages are
+// prefixed with their length when octet counting, or else end with a newline, so newlines in the log text are escaped
+func (sink *syslogSink) frame(record Record) []byte {
+	var logText = record.Message
+	if sink.isStream && !sink.config.OctetCounting {
+		logText = applyLinePolicy(logText, LinePolicyEscape, 0)
+	}
+
+	var message string
+	if sink.config.Protocol == SyslogRFC3164 {
+		message = sink.formatRFC3164(record, logText)
+	} else {
+		message = sink.formatRFC5424(record, logText)
+	}
+
+	if !sink.isStream {
+		return []byte(message)
+	}
+
+	if sink.config.OctetCounting {
+		return []byte(strconv.Itoa(len(message)) + " " + message)
+	}
+
+	return []byte(message + "\n")
+}
+
+// deliver sends 'batch' to a TCP daemon, connecting first if needed. The connection is dropped on any error, so the
+// retry starts on a fresh one
+func (sink *syslogSink) deliver(batch [][]byte) error {
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.conn == nil {
+		if err := sink.connect(); err != nil {
+			return err
+		}
+	}
+
+	sink.conn.SetWriteDeadline(time.Now().Add(sink.config.WriteTimeout))
+	if _, err := sink.conn.Write(bytes.Join(batch, nil)); err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+func (sink *syslogSink) Write(record Record) error {
+	if sink.queue != nil {
+		if !sink.queue.enqueue(sink.frame(record)) {
+			return errors.New("Unable to write to syslog because: the sink is closed")
+		}
+
+		return nil
+	}
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	if sink.isClosed {
+		return errors.New("Unable to write to syslog because: the sink is closed")
+	}
+
+	// a write on a connection the daemon closed may fail only once the message is sent, so it is tried on a fresh one
+	for attempt := 0; attempt < 2; attempt++ {
+		if sink.conn == nil {
+			if time.Now().Before(sink.nextDial) {
+				break
+			}
+
+			if err := sink.connect(); err != nil {
+				sink.nextDial = time.Now().Add(syslogRedialDelay)
+				break
+			}
+		}
+
+		sink.conn.SetWriteDeadline(time.Now().Add(sink.config.WriteTimeout))
+		if _, err := sink.conn.Write(sink.frame(record)); err == nil {
+			sink.counters.Delivered++
+			return nil
+		}
+
+		sink.conn.Close()
+		sink.conn = nil
+	}
+
+	sink.counters.Dropped++
+	return nil
+}
+
+// DeliveryCounters returns how many records were delivered to the daemon and how many were dropped. Over TCP, it also
+// tells how many were retried and are still buffered
+func (sink *syslogSink) DeliveryCounters() DeliveryCounters {
+	if sink.queue != nil {
+		return sink.queue.deliveryCounters()
+	}
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	return sink.counters
+}
+
+// Flush waits up to the flush timeout for the records buffered for a TCP daemon to be sent. Other records are never buffered
+func (sink *syslogSink) Flush() error {
+	if sink.queue != nil {
+		sink.queue.flush()
+	}
+
+	return nil
+}
+
+func (sink *syslogSink) Close() error {
+	// the queue delivers under 'mux', so it is drained before the lock is taken
+	if sink.queue != nil {
+		sink.queue.close()
+	}
+
+	sink.mux.Lock()
+	defer sink.mux.Unlock()
+
+	sink.isClosed = true
+	if sink.conn == nil {
+		return nil
+	}
+
+	err := sink.conn.Close()
+	sink.conn = nil
+
+	return err
+}
@@ -0,0 +1,110 @@
+/*
+	File holding the registry that streams records to in-process consumers as they are logged
+*/
+
+package golog
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultSubscriptionBuffer = 100 // The number of records a subscriber's channel holds if not configured
+)
+
+// subscriptionHub hands each written record to the subscribers whose filter selects it. It is shared by every copy of a
+// logger, so subscribing through one copy streams the records logged through all of them
+type subscriptionHub struct {
+	mux         sync.RWMutex  // Guards the fields below. Held for reading while records are handed out
+	subscribers []*subscriber // The current subscribers, in the order they subscribed
+	isClosed    bool          // If true, the logger shut down and no more subscribers are taken
+	count       int32         // The number of subscribers, read without the lock so logging skips the hub when it is 0
+}
+
+// subscriber is a single consumer registered via 'Subscribe'
+type subscriber struct {
+	filter  RecordFilter // Selects the records sent to the consumer
+	records chan Record  // The channel handed to the consumer
+}
+
+// subscribe registers a consumer of the records selected by 'filter', buffering up to 'bufferSize' of them
+func (hub *subscriptionHub) subscribe(filter RecordFilter, bufferSize int) (<-chan Record, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	if bufferSize < 0 {
+		return nil, errors.New("Invalid subscription buffer size '" + strconv.Itoa(bufferSize) + "' provided. The buffer size may not be negative")
+	}
+
+	if bufferSize == 0 {
+		bufferSize = defaultSubscriptionBuffer
+	}
+
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	if hub.isClosed {
+		return nil, errors.New("Unable to subscribe because: the logger is shut down")
+	}
+
+	newSubscriber := &subscriber{filter, make(chan Record, bufferSize)}
+	hub.subscribers = append(hub.subscribers, newSubscriber)
+	atomic.StoreInt32(&hub.count, int32(len(hub.subscribers)))
+
+	return newSubscriber.records, nil
+}
+
+// unsubscribe removes the consumer reading from 'records' and closes its channel. Unknown channels are ignored
+func (hub *subscriptionHub) unsubscribe(records <-chan Record) {
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	for index, existing := range hub.subscribers {
+		if existing.records == records {
+			close(existing.records)
+			hub.subscribers = append(hub.subscribers[:index], hub.subscribers[index+1:]...)
+			atomic.StoreInt32(&hub.count, int32(len(hub.subscribers)))
+			return
+		}
+	}
+}
+
+// publish sends 'record' to every subscriber selecting it. A subscriber whose channel is full misses the record rather
+// than holding up the logger
+func (hub *subscriptionHub) publish(record Record) {
+	if atomic.LoadInt32(&hub.count) == 0 {
+		return
+	}
+
+	hub.mux.RLock()
+	defer hub.mux.RUnlock()
+
+	for _, existing := range hub.subscribers {
+		if !existing.filter.matches(record) {
+			continue
+		}
+
+		select {
+		case existing.records <- record:
+		default:
+		}
+	}
+}
+
+// close closes the channel of every subscriber, ending their reads, and refuses further subscriptions
+func (hub *subscriptionHub) close() {
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	for _, existing := range hub.subscribers {
+		close(existing.records)
+	}
+
+	hub.subscribers = nil
+	hub.isClosed = true
+	atomic.StoreInt32(&hub.count, 0)
+}
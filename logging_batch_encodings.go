@@ -0,0 +1,59 @@
+/*
+	Encodings of the request bodies batches of records are posted in
+*/
+package golog
+
+type LoggingBatchEncoding int
+
+const (
+	BatchNDJSON    LoggingBatchEncoding = iota + 1 // One JSON document per line, sent as 'application/x-ndjson'
+	BatchJSONArray                                 // A JSON array holding every document, sent as 'application/json'
+)
+
+func (encoding LoggingBatchEncoding) IsValidBatchEncoding() bool {
+	return (encoding == BatchNDJSON ||
+		encoding == BatchJSONArray)
+}
+
+// contentType returns the media type of bodies in the encoding
+func (encoding LoggingBatchEncoding) contentType() string {
+	if encoding == BatchJSONArray {
+		return "application/json"
+	}
+
+	return "application/x-ndjson"
+}
+
+// encode returns the body holding the JSON documents of 'batch'. Each document may end with a newline
+func (encoding LoggingBatchEncoding) encode(batch [][]byte) []byte {
+	var size = 2
+	for _, document := range batch {
+		size += len(document) + 1
+	}
+
+	body := make([]byte, 0, size)
+	if encoding == BatchJSONArray {
+		body = append(body, '[')
+	}
+
+	for index, document := range batch {
+		if encoding == BatchJSONArray && index > 0 {
+			body = append(body, ',')
+		}
+
+		if len(document) > 0 && document[len(document)-1] == '\n' {
+			document = document[:len(document)-1]
+		}
+		body = append(body, document...)
+
+		if encoding == BatchNDJSON {
+			body = append(body, '\n')
+		}
+	}
+
+	if encoding == BatchJSONArray {
+		body = append(body, ']')
+	}
+
+	return body
+}
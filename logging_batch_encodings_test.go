@@ -0,0 +1,44 @@
+package golog
+
+import "testing"
+
+func TestIsValidBatchEncodingAcceptsAllValidEncodings(t *testing.T) {
+	if !BatchNDJSON.IsValidBatchEncoding() {
+		t.Errorf("Expected 'BatchNDJSON' to be a valid batch encoding but was not.")
+	}
+
+	if !BatchJSONArray.IsValidBatchEncoding() {
+		t.Errorf("Expected 'BatchJSONArray' to be a valid batch encoding but was not.")
+	}
+}
+
+func TestIsValidBatchEncodingRejectsEncodingsThatAreInvalid(t *testing.T) {
+	// NOTE: Any encoding outside range of 1 -> 2 is invalid, and we tested validity above.
+	var badEncoding LoggingBatchEncoding
+
+	badEncoding = 0
+	if badEncoding.IsValidBatchEncoding() {
+		t.Errorf("Expected invalid batch encoding '%d' to be invalid but it was valid.", badEncoding)
+	}
+
+	badEncoding = 3
+	if badEncoding.IsValidBatchEncoding() {
+		t.Errorf("Expected invalid batch encoding '%d' to be invalid but it was valid.", badEncoding)
+	}
+}
+
+func TestEncodeJoinsDocumentsAsNDJSONOrAnArray(t *testing.T) {
+	batch := [][]byte{[]byte("{\"a\":1}\n"), []byte("{\"b\":2}")}
+
+	if body := string(BatchNDJSON.encode(batch)); body != "{\"a\":1}\n{\"b\":2}\n" {
+		t.Errorf("Expected one document per line but got %q", body)
+	}
+
+	if body := string(BatchJSONArray.encode(batch)); body != "[{\"a\":1},{\"b\":2}]" {
+		t.Errorf("Expected a JSON array but got %q", body)
+	}
+
+	if body := string(BatchJSONArray.encode(nil)); body != "[]" {
+		t.Errorf("Expected an empty JSON array but got %q", body)
+	}
+}
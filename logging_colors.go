@@ -3,20 +3,183 @@
 */
 package golog
 
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
 // These are constants for terminal colors
 type LoggingColor string
 
 const (
-	// Info is left in the native terminal color
-	colorNone  LoggingColor = ""              // No color
-	colorDebug LoggingColor = "\x1B[32m"      // This is green
-	colorErr   LoggingColor = "\x1B[31m"      // This is red
-	colorFatal LoggingColor = "\x1B[0;37;41m" // This is white text on a red background
-	colorPanic LoggingColor = "\x1B[0;37;41m" // This is white text on a red background
-	colorReset LoggingColor = "\x1B[0m"       // resets an applied terminal color
-	colorWarn  LoggingColor = "\x1B[33m"      // This is yellow
+	colorNone  LoggingColor = ""        // No color
+	colorReset LoggingColor = "\x1B[0m" // resets an applied terminal color
 )
 
+// basicColorOffsets maps the color names accepted by a LoggingStyle to their offset in the ANSI color table
+var basicColorOffsets = map[string]int{
+	"black":   0,
+	"red":     1,
+	"green":   2,
+	"yellow":  3,
+	"blue":    4,
+	"magenta": 5,
+	"cyan":    6,
+	"white":   7,
+}
+
+// isTerminal reports if 'file' is attached to a terminal. It is a variable so tests may stub it
+var isTerminal = func(file *os.File) bool {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// LoggingStyle describes how the output of a single logging level is painted.
+//
+// 'Foreground' and 'Background' accept a basic color name ( "black", "red", "green", "yellow", "blue", "magenta", "cyan", "white" ),
+// a 256-color palette index ( "0" through "255" ), or a truecolor hex value ( "#rrggbb" ). An empty string keeps the terminal's native color.
+type LoggingStyle struct {
+	Foreground string // The text color
+	Background string // The background color
+	Bold       bool   // If true, the text is rendered in bold
+}
+
+// LoggingTheme holds the style used for each logging level
+type LoggingTheme struct {
+	Debug   LoggingStyle // Style used for debug output
+	Info    LoggingStyle // Style used for info output
+	Warning LoggingStyle // Style used for warning output
+	Error   LoggingStyle // Style used for error output
+	Fatal   LoggingStyle // Style used for fatal output
+	Panic   LoggingStyle // Style used for panic output
+}
+
 func (color LoggingColor) String() string {
 	return string(color)
 }
+
+// DefaultTheme returns the theme used by the logger when the user does not provide one
+func DefaultTheme() LoggingTheme {
+	return LoggingTheme{
+		Debug:   LoggingStyle{Foreground: "green"},
+		Info:    LoggingStyle{}, // Info is left in the native terminal color
+		Warning: LoggingStyle{Foreground: "yellow"},
+		Error:   LoggingStyle{Foreground: "red"},
+		Fatal:   LoggingStyle{Foreground: "white", Background: "red"},
+		Panic:   LoggingStyle{Foreground: "white", Background: "red"},
+	}
+}
+
+// Color returns the terminal escape sequence that renders this style. An error is returned if either color can not be parsed
+func (style LoggingStyle) Color() (LoggingColor, error) {
+	var parameters []string
+
+	if style.Bold {
+		parameters = append(parameters, "1")
+	}
+
+	foreground, err := colorParameters(style.Foreground, false)
+	if err != nil {
+		return colorNone, err
+	}
+	if foreground != "" {
+		parameters = append(parameters, foreground)
+	}
+
+	background, err := colorParameters(style.Background, true)
+	if err != nil {
+		return colorNone, err
+	}
+	if background != "" {
+		parameters = append(parameters, background)
+	}
+
+	if len(parameters) == 0 {
+		return colorNone, nil
+	}
+
+	return LoggingColor("\x1B[" + strings.Join(parameters, ";") + "m"), nil
+}
+
+// colorParameters converts the color 'spec' into SGR parameters for either the foreground or the background
+func colorParameters(spec string, isBackground bool) (string, error) {
+	var stringBuilder strings.Builder
+
+	var basePrefix = "3"
+	var extendedPrefix = "38"
+	if isBackground {
+		basePrefix = "4"
+		extendedPrefix = "48"
+	}
+
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" {
+		return "", nil
+	}
+
+	if offset, ok := basicColorOffsets[spec]; ok {
+		return basePrefix + strconv.Itoa(offset), nil
+	}
+
+	if strings.HasPrefix(spec, "#") {
+		rgb, err := strconv.ParseUint(spec[1:], 16, 32)
+		if err == nil && len(spec) == 7 {
+			stringBuilder.WriteString(extendedPrefix)
+			stringBuilder.WriteString(";2;")
+			stringBuilder.WriteString(strconv.FormatUint(rgb>>16&0xFF, 10))
+			stringBuilder.WriteString(";")
+			stringBuilder.WriteString(strconv.FormatUint(rgb>>8&0xFF, 10))
+			stringBuilder.WriteString(";")
+			stringBuilder.WriteString(strconv.FormatUint(rgb&0xFF, 10))
+
+			return stringBuilder.String(), nil
+		}
+	} else if index, err := strconv.ParseUint(spec, 10, 8); err == nil {
+		return extendedPrefix + ";5;" + strconv.FormatUint(index, 10), nil
+	}
+
+	stringBuilder.WriteString("Invalid color '")
+	stringBuilder.WriteString(spec)
+	stringBuilder.WriteString("'. Expected a color name, a 256-color index or a '#rrggbb' value.")
+
+	return "", errors.New(stringBuilder.String())
+}
+
+// palette resolves the theme into the escape sequence used for every logging level
+func (theme LoggingTheme) palette() (map[LoggingLevel]LoggingColor, error) {
+	styles := map[LoggingLevel]LoggingStyle{
+		LevelDebug: theme.Debug,
+		LevelInfo:  theme.Info,
+		LevelWarn:  theme.Warning,
+		LevelErr:   theme.Error,
+		LevelFatal: theme.Fatal,
+		LevelPanic: theme.Panic,
+	}
+
+	palette := make(map[LoggingLevel]LoggingColor, len(styles))
+	for level, style := range styles {
+		color, err := style.Color()
+		if err != nil {
+			return nil, errors.New("Invalid theme style for level " + level.String() + ": " + err.Error())
+		}
+		palette[level] = color
+	}
+
+	return palette, nil
+}
+
+// shouldColorizeStream returns true if colored output may be written to 'file'. Color is disabled when the
+// 'NO_COLOR' environment variable is set or when the stream is not a terminal
+func shouldColorizeStream(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	return isTerminal(file)
+}
@@ -1,6 +1,9 @@
 package golog
 
-import "testing"
+import (
+	"os"
+	"testing"
+)
 
 func TestStringProperlyConvertsAllLoggingColorsToAString(t *testing.T) {
 	wantColorForColorNone := ""
@@ -8,33 +11,85 @@ func TestStringProperlyConvertsAllLoggingColorsToAString(t *testing.T) {
 		t.Errorf("Expected colorNone to be %q but got %q", wantColorForColorNone, colorNone.String())
 	}
 
-	wantColorForColorDebug := "\x1B[32m"
-	if colorDebug.String() != wantColorForColorDebug {
-		t.Errorf("Expected colorDebug to be %q but got %q", wantColorForColorDebug, colorDebug.String())
+	wantColorForColorReset := "\x1B[0m"
+	if colorReset.String() != wantColorForColorReset {
+		t.Errorf("Expected colorReset to be %q but got %q", wantColorForColorReset, colorReset.String())
+	}
+}
+
+func TestDefaultThemeProducesTheClassicLevelColors(t *testing.T) {
+	palette, err := DefaultTheme().palette()
+	if err != nil {
+		t.Errorf("Expected default theme to be valid but got error '%s'", err.Error())
+		return
 	}
 
-	wantColorForColorErr := "\x1B[31m"
-	if colorErr.String() != wantColorForColorErr {
-		t.Errorf("Expected colorErr to be %q but got %q", wantColorForColorErr, colorErr.String())
+	wantColors := map[LoggingLevel]string{
+		LevelDebug: "\x1B[32m",
+		LevelInfo:  "",
+		LevelWarn:  "\x1B[33m",
+		LevelErr:   "\x1B[31m",
+		LevelFatal: "\x1B[37;41m",
+		LevelPanic: "\x1B[37;41m",
 	}
 
-	wantColorForColorFatal := "\x1B[0;37;41m"
-	if colorFatal.String() != wantColorForColorFatal {
-		t.Errorf("Expected colorFatal to be %q but got %q", wantColorForColorFatal, colorFatal.String())
+	for level, wantColor := range wantColors {
+		if palette[level].String() != wantColor {
+			t.Errorf("Expected level '%s' to be painted %q but got %q", level, wantColor, palette[level].String())
+		}
 	}
+}
 
-	wantColorForColorPanic := "\x1B[0;37;41m"
-	if colorPanic.String() != wantColorForColorPanic {
-		t.Errorf("Expected colorPanic to be %q but got %q", wantColorForColorPanic, colorPanic.String())
+func TestColorRendersBoldExtendedAndTrueColors(t *testing.T) {
+	style := LoggingStyle{Foreground: "208", Background: "#102030", Bold: true}
+	color, err := style.Color()
+	if err != nil {
+		t.Errorf("Expected style to be valid but got error '%s'", err.Error())
+		return
 	}
 
-	wantColorForColorReset := "\x1B[0m"
-	if colorReset.String() != wantColorForColorReset {
-		t.Errorf("Expected colorReset to be %q but got %q", wantColorForColorReset, colorReset.String())
+	wantColor := "\x1B[1;38;5;208;48;2;16;32;48m"
+	if color.String() != wantColor {
+		t.Errorf("Expected style to render as %q but got %q", wantColor, color.String())
+	}
+}
+
+func TestColorRejectsInvalidColors(t *testing.T) {
+	invalidColors := []string{"purple", "256", "#12345", "#gggggg", "-1"}
+	for _, invalidColor := range invalidColors {
+		style := LoggingStyle{Foreground: invalidColor}
+		if _, err := style.Color(); err == nil {
+			t.Errorf("Expected color '%s' to be rejected but it was accepted", invalidColor)
+		}
+	}
+}
+
+func TestShouldColorizeStreamHonorsNoColorAndTerminalDetection(t *testing.T) {
+	originalIsTerminal := isTerminal
+	originalNoColor, hadNoColor := os.LookupEnv("NO_COLOR")
+	defer func() {
+		isTerminal = originalIsTerminal
+		if hadNoColor {
+			os.Setenv("NO_COLOR", originalNoColor)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}()
+
+	os.Unsetenv("NO_COLOR")
+
+	isTerminal = func(file *os.File) bool { return false }
+	if shouldColorizeStream(os.Stdout) {
+		t.Errorf("Expected output that is not a terminal to be uncolored")
+	}
+
+	isTerminal = func(file *os.File) bool { return true }
+	if !shouldColorizeStream(os.Stdout) {
+		t.Errorf("Expected terminal output to be colored")
 	}
 
-	wantColorForColorWarn := "\x1B[33m"
-	if colorWarn.String() != wantColorForColorWarn {
-		t.Errorf("Expected colorWarn to be %q but got %q", wantColorForColorWarn, colorWarn.String())
+	os.Setenv("NO_COLOR", "1")
+	if shouldColorizeStream(os.Stdout) {
+		t.Errorf("Expected 'NO_COLOR' to disable colored output")
 	}
 }
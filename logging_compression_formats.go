@@ -0,0 +1,57 @@
+/*
+	Compression formats log files are archived in
+*/
+package golog
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+type LoggingCompression int
+
+const (
+	CompressionGzip  LoggingCompression = iota + 1 // Compresses log files into '.gz' files
+	CompressionZlib                                // Compresses log files into '.zz' files
+	CompressionFlate                               // Compresses log files into raw DEFLATE '.deflate' files
+)
+
+func (compression LoggingCompression) IsValidCompression() bool {
+	return (compression == CompressionGzip ||
+		compression == CompressionZlib ||
+		compression == CompressionFlate)
+}
+
+// extension returns the file extension of files compressed with the compression format
+func (compression LoggingCompression) extension() string {
+	switch compression {
+	case CompressionZlib:
+		return ".zz"
+	case CompressionFlate:
+		return ".deflate"
+	}
+
+	return ".gz"
+}
+
+// newWriter returns a writer compressing to 'writer' at 'level', which is one of the 'compress/flate' levels
+func (compression LoggingCompression) newWriter(writer io.Writer, level int) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionZlib:
+		return zlib.NewWriterLevel(writer, level)
+	case CompressionFlate:
+		return flate.NewWriter(writer, level)
+	}
+
+	return gzip.NewWriterLevel(writer, level)
+}
+
+// isValidCompressionLevel returns true if 'level' is unset or one of the levels from 'flate.BestSpeed' to 'flate.BestCompression'
+func isValidCompressionLevel(level int) bool {
+	return level == 0 || (level >= flate.BestSpeed && level <= flate.BestCompression)
+}
+
+// compressionExtensions are the extensions of every compression format, used to recognize compressed archives
+var compressionExtensions = []string{CompressionGzip.extension(), CompressionZlib.extension(), CompressionFlate.extension()}
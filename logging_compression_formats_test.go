@@ -0,0 +1,46 @@
+package golog
+
+import "testing"
+
+func TestIsValidCompressionAcceptsAllValidCompressions(t *testing.T) {
+	if !CompressionGzip.IsValidCompression() {
+		t.Errorf("Expected 'CompressionGzip' to be a valid compression but was not.")
+	}
+
+	if !CompressionZlib.IsValidCompression() {
+		t.Errorf("Expected 'CompressionZlib' to be a valid compression but was not.")
+	}
+
+	if !CompressionFlate.IsValidCompression() {
+		t.Errorf("Expected 'CompressionFlate' to be a valid compression but was not.")
+	}
+}
+
+func TestIsValidCompressionRejectsCompressionsThatAreInvalid(t *testing.T) {
+	// NOTE: Any compression outside range of 1 -> 3 is invalid, and we tested validity above.
+	var badCompression LoggingCompression
+
+	badCompression = 0
+	if badCompression.IsValidCompression() {
+		t.Errorf("Expected invalid compression '%d' to be invalid but it was valid.", badCompression)
+	}
+
+	badCompression = 4
+	if badCompression.IsValidCompression() {
+		t.Errorf("Expected invalid compression '%d' to be invalid but it was valid.", badCompression)
+	}
+}
+
+func TestIsValidCompressionLevelAcceptsUnsetAndFlateLevels(t *testing.T) {
+	for level := 0; level <= 9; level++ {
+		if !isValidCompressionLevel(level) {
+			t.Errorf("Expected compression level '%d' to be valid but it was not", level)
+		}
+	}
+
+	for _, badLevel := range []int{-1, 10} {
+		if isValidCompressionLevel(badLevel) {
+			t.Errorf("Expected compression level '%d' to be invalid but it was valid", badLevel)
+		}
+	}
+}
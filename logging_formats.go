@@ -0,0 +1,53 @@
+/*
+	Output formats the logger can render log messages in
+*/
+package golog
+
+type LoggingFormat int
+
+const (
+	FormatText LoggingFormat = iota + 1 // Plain '[time] LEVEL: message' text lines. The only format that is colorized
+	FormatGELF                          // Graylog Extended Log Format 1.1 JSON documents, one per line
+	FormatCEF                           // ArcSight Common Event Format lines
+	FormatJSON                          // golog's own JSON documents, one per line
+	FormatGoogleCloud                   // JSON documents laid out for Google Cloud Logging's structured logging agent
+	FormatECS                           // JSON documents following the Elastic Common Schema
+	FormatDatadog                       // JSON documents using Datadog's reserved and standard attributes
+	FormatBinary                        // Compact length prefixed binary records ( see the 'binlog' package ). Only applies to log files, the screen receives text
+)
+
+func (format LoggingFormat) IsValidFormat() bool {
+	return (format == FormatText ||
+		format == FormatGELF ||
+		format == FormatCEF ||
+		format == FormatJSON ||
+		format == FormatGoogleCloud ||
+		format == FormatECS ||
+		format == FormatDatadog ||
+		format == FormatBinary)
+}
+
+// isJSON returns true if the format renders records as JSON documents
+func (format LoggingFormat) isJSON() bool {
+	return (format == FormatGELF ||
+		format == FormatJSON ||
+		format == FormatGoogleCloud ||
+		format == FormatECS ||
+		format == FormatDatadog)
+}
+
+// needsCaller returns true if the format writes the source location a message was logged from
+func (format LoggingFormat) needsCaller() bool {
+	return (format == FormatJSON ||
+		format == FormatGoogleCloud ||
+		format == FormatECS ||
+		format == FormatDatadog)
+}
+
+// CEFConfig holds the device values written into the header of every 'FormatCEF' line. Empty values are
+// replaced by golog defaults
+type CEFConfig struct {
+	DeviceVendor  string // The vendor of the device sending the event. Defaults to 'golog'
+	DeviceProduct string // The product sending the event. Defaults to 'golog'
+	DeviceVersion string // The version of the product sending the event. Defaults to '1.0'
+}
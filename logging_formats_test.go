@@ -0,0 +1,347 @@
+package golog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gnikonorov/golog/binlog"
+	"github.com/spf13/afero"
+)
+
+func TestIsValidFormatAcceptsAllValidFormats(t *testing.T) {
+	if !FormatText.IsValidFormat() {
+		t.Errorf("Expected 'FormatText' to be a valid format but was not.")
+	}
+
+	if !FormatGELF.IsValidFormat() {
+		t.Errorf("Expected 'FormatGELF' to be a valid format but was not.")
+	}
+
+	if !FormatCEF.IsValidFormat() {
+		t.Errorf("Expected 'FormatCEF' to be a valid format but was not.")
+	}
+
+	if !FormatJSON.IsValidFormat() {
+		t.Errorf("Expected 'FormatJSON' to be a valid format but was not.")
+	}
+
+	if !FormatGoogleCloud.IsValidFormat() {
+		t.Errorf("Expected 'FormatGoogleCloud' to be a valid format but was not.")
+	}
+
+	if !FormatECS.IsValidFormat() {
+		t.Errorf("Expected 'FormatECS' to be a valid format but was not.")
+	}
+
+	if !FormatDatadog.IsValidFormat() {
+		t.Errorf("Expected 'FormatDatadog' to be a valid format but was not.")
+	}
+
+	if !FormatBinary.IsValidFormat() {
+		t.Errorf("Expected 'FormatBinary' to be a valid format but was not.")
+	}
+}
+
+func TestIsValidFormatRejectsFormatsThatAreInvalid(t *testing.T) {
+	// NOTE: Any format outside range of 1 -> 8 is invalid, and we tested validity above.
+	var badFormat LoggingFormat
+
+	badFormat = 0
+	if badFormat.IsValidFormat() {
+		t.Errorf("Expected invalid format '%d' to be invalid but it was valid.", badFormat)
+	}
+
+	badFormat = 9
+	if badFormat.IsValidFormat() {
+		t.Errorf("Expected invalid format '%d' to be invalid but it was valid.", badFormat)
+	}
+}
+
+func TestFormatGELFProducesAGELFDocument(t *testing.T) {
+	fields := []Field{{"user", "alice"}, {"attempt", 3}, {"id", "abc"}, {"context", "forged"}, {"level_name", "forged"}}
+
+	logTime := time.Unix(1500000000, 250000000)
+	gelfLine := formatGELF(Record{Time: logTime, Level: LevelWarn, Context: "billing", Message: "first line\nsecond line", Fields: fields}, "testhost")
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(gelfLine), &document); err != nil {
+		t.Errorf("Expected GELF output to be valid JSON but got error '%s' for %q", err.Error(), gelfLine)
+		return
+	}
+
+	wantValues := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "testhost",
+		"short_message": "first line",
+		"full_message":  "first line\nsecond line",
+		"timestamp":     1500000000.25,
+		"level":         float64(4),
+		"_context":      "billing",
+		"_user":         "alice",
+		"_attempt":      float64(3),
+		"_id_":          "abc",
+		"_level_name":   "WARNING",
+		"_context_":     "forged",
+		"_level_name_":  "forged",
+	}
+	for key, wantValue := range wantValues {
+		if document[key] != wantValue {
+			t.Errorf("Expected GELF key '%s' to be '%v' but got '%v'", key, wantValue, document[key])
+		}
+	}
+
+	if _, ok := document["_id"]; ok {
+		t.Errorf("Expected reserved GELF key '_id' to not be written")
+	}
+
+	if strings.Count(gelfLine, `"_context"`) != 1 || strings.Count(gelfLine, `"_level_name"`) != 1 {
+		t.Errorf("Expected fields to not repeat the keys golog writes but got %q", gelfLine)
+	}
+}
+
+func TestFormatCEFEscapesHeaderAndExtensionValues(t *testing.T) {
+	cefConfig := CEFConfig{DeviceVendor: "ACME|Corp", DeviceProduct: "shop", DeviceVersion: "2.0"}
+	fields := []Field{{"src-ip", "10.0.0.1"}}
+
+	logTime := time.Unix(1500000000, 0)
+	cefLine := formatCEF(Record{Time: logTime, Level: LevelErr, Message: `a=b\c`, Fields: fields}, "testhost", cefConfig)
+
+	wantLine := `CEF:0|ACME\|Corp|shop|2.0|ERROR|a=b\\c|7|rt=1500000000000 dvchost=testhost msg=a\=b\\c src_ip=10.0.0.1`
+	if cefLine != wantLine {
+		t.Errorf("Expected CEF line %q but got %q", wantLine, cefLine)
+	}
+
+	cefLine = formatCEF(Record{Time: logTime, Level: LevelErr, Message: "red \x1b[31malert\ttabbed\x00"}, "testhost", cefConfig)
+
+	wantLine = `CEF:0|ACME\|Corp|shop|2.0|ERROR|red \\x1b[31malert\\ttabbed\\x00|7|rt=1500000000000 dvchost=testhost msg=red \\x1b[31malert\\ttabbed\\x00`
+	if cefLine != wantLine {
+		t.Errorf("Expected control characters to be spelled out as text in CEF line %q but got %q", wantLine, cefLine)
+	}
+}
+
+func TestFormatCEFRenamesFieldKeysThatAreReservedRepeatedOrEmpty(t *testing.T) {
+	cefConfig := CEFConfig{DeviceVendor: "ACME", DeviceProduct: "shop", DeviceVersion: "2.0"}
+	fields := []Field{{"msg", "forged"}, {"rt", "0"}, {"cat", "billing"}, {"user", "x"}, {"user", "y"}, {"", "anonymous"}}
+
+	logTime := time.Unix(1500000000, 0)
+	cefLine := formatCEF(Record{Time: logTime, Level: LevelInfo, Message: "paid", Context: "shop", Fields: fields}, "testhost", cefConfig)
+
+	wantLine := `CEF:0|ACME|shop|2.0|INFO|paid|3|rt=1500000000000 dvchost=testhost cat=shop msg=paid msg_=forged rt_=0 cat_=billing user=x user_=y field=anonymous`
+	if cefLine != wantLine {
+		t.Errorf("Expected CEF line %q but got %q", wantLine, cefLine)
+	}
+
+	// without a context 'cat' is free for a field
+	cefLine = formatCEF(Record{Time: logTime, Level: LevelInfo, Message: "paid", Fields: []Field{{"cat", "billing"}}}, "testhost", cefConfig)
+	if !strings.HasSuffix(cefLine, " msg=paid cat=billing") {
+		t.Errorf("Expected the field 'cat' to keep its key without a context but got %q", cefLine)
+	}
+}
+
+func TestFormatterWritesStructuredFormatsOnASingleLine(t *testing.T) {
+	formatter, err := NewFormatter(FormatCEF)
+	if err != nil {
+		t.Errorf("Failed to create formatter because: '%s'", err.Error())
+		return
+	}
+
+	logLine := string(formatter.Format(Record{Time: time.Now(), Level: LevelInfo, Message: "one\ntwo"}))
+	if strings.Count(logLine, "\n") != 1 || !strings.HasSuffix(logLine, "\n") {
+		t.Errorf("Expected a single newline terminated line but got %q", logLine)
+	}
+}
+
+func TestNewFormatterRejectsInvalidFormats(t *testing.T) {
+	if _, err := NewFormatter(0); err == nil {
+		t.Errorf("Expected format '0' to be rejected but it was accepted")
+	}
+}
+
+func TestJSONSchemasPlaceMessagePartsUnderThePlatformKeys(t *testing.T) {
+	type schemaExpectation struct {
+		format     LoggingFormat
+		wantValues map[string]interface{}
+		callerKey  string
+	}
+
+	expectations := []schemaExpectation{
+		{FormatJSON, map[string]interface{}{"level": "WARNING", "message": "disk low", "context": "storage", "trace_id": "abc123"}, "caller"},
+		{FormatGoogleCloud, map[string]interface{}{"severity": "WARNING", "message": "disk low", "logging.googleapis.com/trace": "abc123"}, "logging.googleapis.com/sourceLocation"},
+		{FormatECS, map[string]interface{}{"log.level": "warning", "message": "disk low", "log.logger": "storage", "ecs.version": ecsVersion, "trace.id": "abc123"}, "log.origin.file.name"},
+		{FormatDatadog, map[string]interface{}{"status": "warning", "message": "disk low", "logger.name": "storage", "dd.trace_id": "abc123"}, "logger.method_name"},
+	}
+
+	for _, expectation := range expectations {
+		logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "schema.log", LogFormat: expectation.format, IsMock: true}
+		logger, err := SetupLoggerFromStruct(&logConfig)
+		if err != nil {
+			t.Errorf("Failed to set up logger because: '%s'", err.Error())
+			return
+		}
+		logger.SetContext("storage")
+		logger.SetField("trace_id", "abc123")
+		logger.SetField("free_bytes", 1024)
+
+		logger.Warning("disk low")
+
+		logger.Flush()
+
+		fileBytes, err := afero.ReadFile(logger.osHandle, "/logs/schema.log")
+		if err != nil {
+			t.Errorf("Failed to read log file because: '%s'", err.Error())
+			return
+		}
+
+		var document map[string]interface{}
+		if err := json.Unmarshal(fileBytes, &document); err != nil {
+			t.Errorf("Expected format '%d' to produce valid JSON but got error '%s' for %q", expectation.format, err.Error(), string(fileBytes))
+			continue
+		}
+
+		for key, wantValue := range expectation.wantValues {
+			if document[key] != wantValue {
+				t.Errorf("Expected format '%d' to write '%v' under '%s' but got '%v'", expectation.format, wantValue, key, document[key])
+			}
+		}
+
+		if !strings.Contains(string(fileBytes), "logging_formats_test.go") {
+			t.Errorf("Expected format '%d' to write the caller of the log method under '%s' but got %q", expectation.format, expectation.callerKey, string(fileBytes))
+		}
+	}
+}
+
+func TestGoogleCloudSchemaWritesTheContextAsALabel(t *testing.T) {
+	fields := []Field{{"logging.googleapis.com/operation", "forged"}}
+
+	jsonLine := formatJSON(Record{Time: time.Now(), Level: LevelFatal, Context: "storage", Message: "down", Fields: fields}, "testhost", jsonSchemaGoogleCloud)
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonLine), &document); err != nil {
+		t.Errorf("Expected valid JSON but got error '%s' for %q", err.Error(), jsonLine)
+		return
+	}
+
+	labels, ok := document["logging.googleapis.com/labels"].(map[string]interface{})
+	if !ok || labels["context"] != "storage" {
+		t.Errorf("Expected the context to be written as a label but got %q", jsonLine)
+	}
+
+	if document["severity"] != "CRITICAL" {
+		t.Errorf("Expected FATAL to map to severity 'CRITICAL' but got '%v'", document["severity"])
+	}
+
+	if _, ok := document["logging.googleapis.com/operation"]; ok {
+		t.Errorf("Expected fields to not be able to write Cloud Logging special keys but got %q", jsonLine)
+	}
+}
+
+func TestJSONSchemasRenameFieldsThatWouldRepeatAKeyTheSchemaWrote(t *testing.T) {
+	fields := []Field{{"ecs.version", "forged"}, {"log.origin.function", "forged"}, {"trace.id", "forged"}, {"trace_id", "abc123"}}
+	record := Record{Time: time.Now(), Level: LevelInfo, Message: "checkout", Fields: fields, CallerFile: "shop.go", CallerLine: 7, CallerFunction: "main.checkout"}
+
+	jsonLine := formatJSON(record, "testhost", jsonSchemaECS)
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonLine), &document); err != nil {
+		t.Errorf("Expected valid JSON but got error '%s' for %q", err.Error(), jsonLine)
+		return
+	}
+
+	for _, key := range []string{"ecs.version", "log.origin.function", "trace.id"} {
+		if strings.Count(jsonLine, `"`+key+`":`) != 1 {
+			t.Errorf("Expected key '%s' to be written once but got %q", key, jsonLine)
+		}
+	}
+
+	wantValues := map[string]interface{}{"ecs.version": ecsVersion, "ecs.version_": "forged", "log.origin.function": "main.checkout", "log.origin.function_": "forged", "trace.id": "abc123", "trace.id_": "forged"}
+	for key, wantValue := range wantValues {
+		if document[key] != wantValue {
+			t.Errorf("Expected '%v' under '%s' but got '%v'", wantValue, key, document[key])
+		}
+	}
+}
+
+func TestJSONFormatRenamesFieldKeysRepeatedInTheFieldsObject(t *testing.T) {
+	fields := []Field{{"user", "x"}, {"user", "y"}, {"user_", "z"}}
+	record := Record{Time: time.Now(), Level: LevelInfo, Message: "login", Fields: fields}
+
+	jsonLine := formatJSON(record, "testhost", jsonSchemaGolog)
+
+	var document struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(jsonLine), &document); err != nil {
+		t.Errorf("Expected valid JSON but got error '%s' for %q", err.Error(), jsonLine)
+		return
+	}
+
+	if strings.Count(jsonLine, `"user":`) != 1 {
+		t.Errorf("Expected key 'user' to be written once but got %q", jsonLine)
+	}
+
+	wantValues := map[string]interface{}{"user": "x", "user_": "y", "user__": "z"}
+	for key, wantValue := range wantValues {
+		if document.Fields[key] != wantValue {
+			t.Errorf("Expected '%v' under '%s' but got '%v' in %q", wantValue, key, document.Fields[key], jsonLine)
+		}
+	}
+}
+
+func TestBinaryFormatWritesDecodableRecordsToTheLogFile(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "binary.log", LogFormat: FormatBinary, IsMock: true}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+	logger.SetContext("worker")
+	logger.SetField("job", 42)
+
+	logger.Info("started")
+	logger.Err("failed")
+
+	logger.Flush()
+
+	fileHandle, err := logger.osHandle.Open("/logs/binary.log")
+	if err != nil {
+		t.Errorf("Failed to open log file because: '%s'", err.Error())
+		return
+	}
+	defer fileHandle.Close()
+
+	decoder := binlog.NewDecoder(fileHandle)
+	for _, wantMessage := range []string{"started", "failed"} {
+		record, err := decoder.Decode()
+		if err != nil {
+			t.Errorf("Expected a binary record but got error '%s'", err.Error())
+			return
+		}
+
+		if record.Message != wantMessage || record.Context != "worker" || len(record.Fields) != 1 || record.Fields[0].Value != int64(42) {
+			t.Errorf("Expected record for '%s' with context and fields but got '%v'", wantMessage, record)
+		}
+	}
+}
+
+func TestBinaryFormatIsRejectedForScreenOnlyLoggers(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeScreen, LogFileStartupAction: FileActionNone, LogFormat: FormatBinary, IsMock: true}
+	if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+		t.Errorf("Expected the binary format to be rejected for 'ModeScreen'")
+	}
+}
+
+func TestIsJSONRecognizesTheJSONFormats(t *testing.T) {
+	for _, format := range []LoggingFormat{FormatGELF, FormatJSON, FormatGoogleCloud, FormatECS, FormatDatadog} {
+		if !format.isJSON() {
+			t.Errorf("Expected format '%d' to render JSON but it did not", format)
+		}
+	}
+
+	for _, format := range []LoggingFormat{FormatText, FormatCEF, FormatBinary} {
+		if format.isJSON() {
+			t.Errorf("Expected format '%d' not to render JSON but it did", format)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Framings separating records sent over stream connections
+*/
+package golog
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+type LoggingFraming int
+
+const (
+	FramingNewline      LoggingFraming = iota + 1 // Ends every record with a newline. Newlines in log text must be escaped, as the text and structured formats do
+	FramingLengthPrefix                           // Prefixes every record with its length as a 4 byte big endian integer
+)
+
+func (framing LoggingFraming) IsValidFraming() bool {
+	return (framing == FramingNewline ||
+		framing == FramingLengthPrefix)
+}
+
+// frame returns 'payload' framed for a stream. The trailing newline formatters end records with is not part of the payload
+func (framing LoggingFraming) frame(payload []byte) []byte {
+	payload = bytes.TrimSuffix(payload, []byte("\n"))
+
+	if framing == FramingLengthPrefix {
+		framed := make([]byte, 4, 4+len(payload))
+		binary.BigEndian.PutUint32(framed, uint32(len(payload)))
+		return append(framed, payload...)
+	}
+
+	framed := make([]byte, 0, len(payload)+1)
+	framed = append(framed, payload...)
+	return append(framed, '\n')
+}
@@ -0,0 +1,46 @@
+package golog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIsValidFramingAcceptsAllValidFramings(t *testing.T) {
+	if !FramingNewline.IsValidFraming() {
+		t.Errorf("Expected 'FramingNewline' to be a valid framing but was not.")
+	}
+
+	if !FramingLengthPrefix.IsValidFraming() {
+		t.Errorf("Expected 'FramingLengthPrefix' to be a valid framing but was not.")
+	}
+}
+
+func TestIsValidFramingRejectsFramingsThatAreInvalid(t *testing.T) {
+	// NOTE: Any framing outside range of 1 -> 2 is invalid, and we tested validity above.
+	var badFraming LoggingFraming
+
+	badFraming = 0
+	if badFraming.IsValidFraming() {
+		t.Errorf("Expected invalid framing '%d' to be invalid but it was valid.", badFraming)
+	}
+
+	badFraming = 3
+	if badFraming.IsValidFraming() {
+		t.Errorf("Expected invalid framing '%d' to be invalid but it was valid.", badFraming)
+	}
+}
+
+func TestFrameReplacesTheTrailingNewlineWithTheFraming(t *testing.T) {
+	if framed := FramingNewline.frame([]byte("{\"a\":1}\n")); string(framed) != "{\"a\":1}\n" {
+		t.Errorf("Expected a single trailing newline but got %q", framed)
+	}
+
+	if framed := FramingNewline.frame([]byte("no newline")); string(framed) != "no newline\n" {
+		t.Errorf("Expected a newline to be added but got %q", framed)
+	}
+
+	expected := []byte{0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o'}
+	if framed := FramingLengthPrefix.frame([]byte("hello\n")); !bytes.Equal(framed, expected) {
+		t.Errorf("Expected %v but got %v", expected, framed)
+	}
+}
@@ -3,18 +3,133 @@
 */
 package golog
 
+import (
+	"errors"
+)
+
 // Logging levels for the logger
 type LoggingLevel string
 
 const (
-	levelDebug LoggingLevel = "DEBUG"   // This level should be used debug information
-	levelErr   LoggingLevel = "ERROR"   // A recoverable error
-	levelFatal LoggingLevel = "FATAL"   // Non-recoverable error.
-	levelInfo  LoggingLevel = "INFO"    // Non severe log information. Should be used for things like user input
-	levelPanic LoggingLevel = "PANIC"   // Akin to an exception. Logs and throws a panic
-	levelWarn  LoggingLevel = "WARNING" // Indicator of potential problems
+	LevelDebug LoggingLevel = "DEBUG"   // This level should be used debug information
+	LevelErr   LoggingLevel = "ERROR"   // A recoverable error
+	LevelFatal LoggingLevel = "FATAL"   // Non-recoverable error.
+	LevelInfo  LoggingLevel = "INFO"    // Non severe log information. Should be used for things like user input
+	LevelPanic LoggingLevel = "PANIC"   // Akin to an exception. Logs and throws a panic
+	LevelWarn  LoggingLevel = "WARNING" // Indicator of potential problems
 )
 
+// LevelFilter selects the levels of the records an output writes. The zero value lets every level through
+type LevelFilter struct {
+	MinLevel LoggingLevel   // Records below this level are dropped. If unset, no level is dropped for being too low
+	Allow    []LoggingLevel // If not empty, only records at one of these levels are written
+	Deny     []LoggingLevel // Records at one of these levels are never written
+}
+
+func (level LoggingLevel) IsValidLevel() bool {
+	return level.rank() > 0
+}
+
+// rank orders the logging levels by severity, from 1 for 'LevelDebug' to 6 for 'LevelPanic'. Unknown levels rank 0
+func (level LoggingLevel) rank() int {
+	switch level {
+	case LevelDebug:
+		return 1
+	case LevelInfo:
+		return 2
+	case LevelWarn:
+		return 3
+	case LevelErr:
+		return 4
+	case LevelFatal:
+		return 5
+	case LevelPanic:
+		return 6
+	}
+
+	return 0
+}
+
 func (level LoggingLevel) String() string {
 	return string(level)
 }
+
+// syslogSeverity returns the syslog ( RFC 5424 ) severity matching the logging level
+func (level LoggingLevel) syslogSeverity() int {
+	switch level {
+	case LevelDebug:
+		return 7 // debug
+	case LevelInfo:
+		return 6 // informational
+	case LevelWarn:
+		return 4 // warning
+	case LevelErr:
+		return 3 // error
+	case LevelFatal:
+		return 2 // critical
+	case LevelPanic:
+		return 1 // alert
+	}
+
+	return 5 // notice
+}
+
+// cefSeverity returns the CEF severity, from 0 to 10, matching the logging level
+func (level LoggingLevel) cefSeverity() int {
+	switch level {
+	case LevelDebug:
+		return 1
+	case LevelInfo:
+		return 3
+	case LevelWarn:
+		return 5
+	case LevelErr:
+		return 7
+	case LevelFatal:
+		return 9
+	case LevelPanic:
+		return 10
+	}
+
+	return 0
+}
+
+// validate returns an error if the filter refers to a level that does not exist
+func (filter LevelFilter) validate() error {
+	if filter.MinLevel != "" && !filter.MinLevel.IsValidLevel() {
+		return errors.New("Invalid minimum level '" + filter.MinLevel.String() + "' provided. See levels in 'logging_levels.go'")
+	}
+
+	for _, level := range append(append([]LoggingLevel{}, filter.Allow...), filter.Deny...) {
+		if !level.IsValidLevel() {
+			return errors.New("Invalid level '" + level.String() + "' provided. See levels in 'logging_levels.go'")
+		}
+	}
+
+	return nil
+}
+
+// allows returns true if records at 'level' pass the filter
+func (filter LevelFilter) allows(level LoggingLevel) bool {
+	if filter.MinLevel != "" && level.rank() < filter.MinLevel.rank() {
+		return false
+	}
+
+	for _, deniedLevel := range filter.Deny {
+		if level == deniedLevel {
+			return false
+		}
+	}
+
+	if len(filter.Allow) == 0 {
+		return true
+	}
+
+	for _, allowedLevel := range filter.Allow {
+		if level == allowedLevel {
+			return true
+		}
+	}
+
+	return false
+}
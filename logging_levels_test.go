@@ -1,35 +1,112 @@
 package golog
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
 
 func TestStringProperlyConvertsAllLoggingLevelsToAString(t *testing.T) {
 	wantStringForLevelDebug := "DEBUG"
-	if levelDebug.String() != wantStringForLevelDebug {
-		t.Errorf("Expected levelDebug to be '%s' but got '%s'", wantStringForLevelDebug, levelDebug.String())
+	if LevelDebug.String() != wantStringForLevelDebug {
+		t.Errorf("Expected LevelDebug to be '%s' but got '%s'", wantStringForLevelDebug, LevelDebug.String())
 	}
 
 	wantStringForLevelErr := "ERROR"
-	if levelErr.String() != wantStringForLevelErr {
-		t.Errorf("Expected levelErr to be '%s' but got '%s'", wantStringForLevelErr, levelErr.String())
+	if LevelErr.String() != wantStringForLevelErr {
+		t.Errorf("Expected LevelErr to be '%s' but got '%s'", wantStringForLevelErr, LevelErr.String())
 	}
 
 	wantStringForLevelFatal := "FATAL"
-	if levelFatal.String() != wantStringForLevelFatal {
-		t.Errorf("Expected levelFatal to be '%s' but got '%s'", wantStringForLevelFatal, levelFatal.String())
+	if LevelFatal.String() != wantStringForLevelFatal {
+		t.Errorf("Expected LevelFatal to be '%s' but got '%s'", wantStringForLevelFatal, LevelFatal.String())
 	}
 
 	wantStringForLevelInfo := "INFO"
-	if levelInfo.String() != wantStringForLevelInfo {
-		t.Errorf("Expected levelInfo to be '%s' but got '%s'", wantStringForLevelInfo, levelInfo.String())
+	if LevelInfo.String() != wantStringForLevelInfo {
+		t.Errorf("Expected LevelInfo to be '%s' but got '%s'", wantStringForLevelInfo, LevelInfo.String())
 	}
 
 	wantStringForLevelPanic := "PANIC"
-	if levelPanic.String() != wantStringForLevelPanic {
-		t.Errorf("Expected levelPanic to be '%s' but got '%s'", wantStringForLevelPanic, levelPanic.String())
+	if LevelPanic.String() != wantStringForLevelPanic {
+		t.Errorf("Expected LevelPanic to be '%s' but got '%s'", wantStringForLevelPanic, LevelPanic.String())
 	}
 
 	wantStringForLevelWarn := "WARNING"
-	if levelWarn.String() != wantStringForLevelWarn {
-		t.Errorf("Expected levelWarn to be '%s' but got '%s'", wantStringForLevelWarn, levelWarn.String())
+	if LevelWarn.String() != wantStringForLevelWarn {
+		t.Errorf("Expected LevelWarn to be '%s' but got '%s'", wantStringForLevelWarn, LevelWarn.String())
+	}
+}
+
+func TestLevelFilterAppliesMinimumLevelAllowAndDenyLists(t *testing.T) {
+	type filterExpectation struct {
+		filter      LevelFilter
+		level       LoggingLevel
+		wantAllowed bool
+	}
+
+	expectations := []filterExpectation{
+		{LevelFilter{}, LevelDebug, true},
+		{LevelFilter{MinLevel: LevelWarn}, LevelInfo, false},
+		{LevelFilter{MinLevel: LevelWarn}, LevelWarn, true},
+		{LevelFilter{MinLevel: LevelWarn}, LevelPanic, true},
+		{LevelFilter{Allow: []LoggingLevel{LevelInfo}}, LevelInfo, true},
+		{LevelFilter{Allow: []LoggingLevel{LevelInfo}}, LevelErr, false},
+		{LevelFilter{Deny: []LoggingLevel{LevelFatal}}, LevelFatal, false},
+		{LevelFilter{MinLevel: LevelDebug, Allow: []LoggingLevel{LevelErr}, Deny: []LoggingLevel{LevelErr}}, LevelErr, false},
+	}
+
+	for _, expectation := range expectations {
+		if expectation.filter.allows(expectation.level) != expectation.wantAllowed {
+			t.Errorf("Expected filter '%v' allowing level '%s' to be '%t'", expectation.filter, expectation.level, expectation.wantAllowed)
+		}
+	}
+}
+
+func TestSetupRejectsLevelFiltersWithUnknownLevels(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeScreen, LogFileStartupAction: FileActionNone, IsMock: true, ScreenLevels: LevelFilter{MinLevel: "VERBOSE"}}
+	if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+		t.Errorf("Expected a filter with an unknown minimum level to be rejected")
+	}
+
+	logConfig = LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionNone, LogDirectory: "/logs", LogFile: "test.log", IsMock: true, FileLevels: LevelFilter{Deny: []LoggingLevel{"debug"}}}
+	if _, err := SetupLoggerFromStruct(&logConfig); err == nil {
+		t.Errorf("Expected a filter denying an unknown level to be rejected")
+	}
+}
+
+func TestFileLevelsFromAJSONProfileFilterTheLogFile(t *testing.T) {
+	var loggingConfigs []LoggingConfig
+	profile := `[{"name": "routed", "logMode": 1, "logFileStartupAction": 1, "logDirectory": "/logs", "logFile": "routed.log", "isMock": true, "fileLevels": {"minLevel": "WARNING", "deny": ["FATAL"]}}]`
+	if err := json.Unmarshal([]byte(profile), &loggingConfigs); err != nil {
+		t.Errorf("Failed to decode profile because: '%s'", err.Error())
+		return
+	}
+
+	logger, err := SetupLoggerFromStruct(&loggingConfigs[0])
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warning("warning")
+	logger.Err("error")
+	logger.Fatal("fatal")
+
+	logger.Flush()
+
+	fileBytes, err := afero.ReadFile(logger.osHandle, "/logs/routed.log")
+	if err != nil {
+		t.Errorf("Failed to read log file because: '%s'", err.Error())
+		return
+	}
+
+	logLines := strings.Split(strings.TrimSuffix(string(fileBytes), "\n"), "\n")
+	if len(logLines) != 2 || !strings.HasSuffix(logLines[0], "WARNING: warning") || !strings.HasSuffix(logLines[1], "ERROR: error") {
+		t.Errorf("Expected only the warning and error lines in the log file but got %q", string(fileBytes))
 	}
 }
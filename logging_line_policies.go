@@ -0,0 +1,103 @@
+/*
+	Policies controlling how newlines and control characters inside log text are written
+*/
+package golog
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type LoggingLinePolicy int
+
+const (
+	LinePolicyEscape LoggingLinePolicy = iota + 1 // Escapes newlines, control and ANSI characters ( e.g.: '\n', '\x1b' ) so every message stays on one line
+	LinePolicyIndent                              // Keeps newlines but indents continuation lines under the log header. Other control characters are escaped
+	LinePolicyNone                                // Writes the log text untouched. Only use this if log text never contains untrusted input
+)
+
+func (linePolicy LoggingLinePolicy) IsValidLinePolicy() bool {
+	return (linePolicy == LinePolicyEscape ||
+		linePolicy == LinePolicyIndent ||
+		linePolicy == LinePolicyNone)
+}
+
+// isControlRune returns true for C0 control characters, DEL and C1 control characters
+func isControlRune(r rune) bool {
+	return r < 0x20 || r == 0x7F || (r >= 0x80 && r < 0xA0)
+}
+
+// writeEscapedRune writes the escaped form of control rune 'r' to 'stringBuilder'
+func writeEscapedRune(stringBuilder *strings.Builder, r rune) {
+	switch r {
+	case '\n':
+		stringBuilder.WriteString("\\n")
+	case '\r':
+		stringBuilder.WriteString("\\r")
+	case '\t':
+		stringBuilder.WriteString("\\t")
+	default:
+		var hexDigits = strconv.FormatInt(int64(r), 16)
+		if r < 0x80 {
+			stringBuilder.WriteString("\\x")
+		} else {
+			stringBuilder.WriteString("\\u00")
+		}
+		if len(hexDigits) < 2 {
+			stringBuilder.WriteString("0")
+		}
+		stringBuilder.WriteString(hexDigits)
+	}
+}
+
+// EscapeLogText returns 'logText' with newlines, control and ANSI characters escaped as 'LinePolicyEscape' does, for
+// tools writing log text read back from somewhere else to a terminal
+func EscapeLogText(logText string) string {
+	return applyLinePolicy(logText, LinePolicyEscape, 0)
+}
+
+// applyLinePolicy returns 'logText' made safe for writing according to 'linePolicy'. 'indentWidth' is the number of
+// columns continuation lines are indented by when 'linePolicy' is 'LinePolicyIndent'
+func applyLinePolicy(logText string, linePolicy LoggingLinePolicy, indentWidth int) string {
+	if linePolicy == LinePolicyNone {
+		return logText
+	}
+
+	// fast path, most log text contains nothing that needs to be changed
+	var needsChange = false
+	for _, r := range logText {
+		if isControlRune(r) || r == utf8.RuneError {
+			needsChange = true
+			break
+		}
+	}
+	if !needsChange {
+		return logText
+	}
+
+	var stringBuilder strings.Builder
+	stringBuilder.Grow(len(logText) + 16)
+
+	for index, r := range logText {
+		if r == utf8.RuneError {
+			// invalid utf8 is escaped byte by byte so it can't smuggle in a control sequence
+			if _, size := utf8.DecodeRuneInString(logText[index:]); size == 1 {
+				stringBuilder.WriteString("\\x")
+				stringBuilder.WriteString(strconv.FormatInt(int64(logText[index]), 16))
+				continue
+			}
+		}
+
+		if !isControlRune(r) {
+			stringBuilder.WriteRune(r)
+		} else if r == '\n' && linePolicy == LinePolicyIndent {
+			stringBuilder.WriteString("\n")
+			stringBuilder.WriteString(strings.Repeat(" ", indentWidth))
+		} else {
+			writeEscapedRune(&stringBuilder, r)
+		}
+	}
+
+	return stringBuilder.String()
+}
@@ -0,0 +1,94 @@
+package golog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestIsValidLinePolicyAcceptsAllValidLinePolicies(t *testing.T) {
+	if !LinePolicyEscape.IsValidLinePolicy() {
+		t.Errorf("Expected 'LinePolicyEscape' to be a valid line policy but was not.")
+	}
+
+	if !LinePolicyIndent.IsValidLinePolicy() {
+		t.Errorf("Expected 'LinePolicyIndent' to be a valid line policy but was not.")
+	}
+
+	if !LinePolicyNone.IsValidLinePolicy() {
+		t.Errorf("Expected 'LinePolicyNone' to be a valid line policy but was not.")
+	}
+}
+
+func TestIsValidLinePolicyRejectsLinePoliciesThatAreInvalid(t *testing.T) {
+	// NOTE: Any policy outside range of 1 -> 3 is invalid, and we tested validity above.
+	var badLinePolicy LoggingLinePolicy
+
+	badLinePolicy = 0
+	if badLinePolicy.IsValidLinePolicy() {
+		t.Errorf("Expected invalid line policy '%d' to be invalid but it was valid.", badLinePolicy)
+	}
+
+	badLinePolicy = 4
+	if badLinePolicy.IsValidLinePolicy() {
+		t.Errorf("Expected invalid line policy '%d' to be invalid but it was valid.", badLinePolicy)
+	}
+}
+
+func TestApplyLinePolicyEscapesNewlinesAndControlCharacters(t *testing.T) {
+	logText := "first\nsecond\r\t\x1B[31mred\x00"
+	wantText := "first\\nsecond\\r\\t\\x1b[31mred\\x00"
+
+	gotText := applyLinePolicy(logText, LinePolicyEscape, 10)
+	if gotText != wantText {
+		t.Errorf("Expected %q to be escaped as %q but got %q", logText, wantText, gotText)
+	}
+}
+
+func TestApplyLinePolicyIndentsContinuationLines(t *testing.T) {
+	logText := "first\nsecond\x1B"
+	wantText := "first\n    second\\x1b"
+
+	gotText := applyLinePolicy(logText, LinePolicyIndent, 4)
+	if gotText != wantText {
+		t.Errorf("Expected %q to be indented as %q but got %q", logText, wantText, gotText)
+	}
+}
+
+func TestApplyLinePolicyLeavesTextUntouchedWhenPolicyIsNone(t *testing.T) {
+	logText := "first\nsecond\x1B"
+
+	gotText := applyLinePolicy(logText, LinePolicyNone, 4)
+	if gotText != logText {
+		t.Errorf("Expected %q to be left untouched but got %q", logText, gotText)
+	}
+}
+
+func TestWriteLogDoesNotAllowForgedEntriesOrFormatVerbs(t *testing.T) {
+	logConfig := LoggingConfig{LogMode: ModeFile, LogFileStartupAction: FileActionAppend, LogDirectory: "/logs", LogFile: "test.log", IsMock: true}
+	logger, err := SetupLoggerFromStruct(&logConfig)
+	if err != nil {
+		t.Errorf("Failed to set up logger because: '%s'", err.Error())
+		return
+	}
+
+	logger.Info("100% done\n[2020-01-01 00:00:00] FATAL: forged")
+
+	logger.Flush()
+
+	fileBytes, err := afero.ReadFile(logger.osHandle, "/logs/test.log")
+	if err != nil {
+		t.Errorf("Failed to read log file because: '%s'", err.Error())
+		return
+	}
+
+	logLines := strings.Split(strings.TrimSuffix(string(fileBytes), "\n"), "\n")
+	if len(logLines) != 1 {
+		t.Errorf("Expected a single log line but got %d: %q", len(logLines), string(fileBytes))
+	}
+
+	if !strings.HasSuffix(logLines[0], "INFO: 100% done\\n[2020-01-01 00:00:00] FATAL: forged") {
+		t.Errorf("Expected log line to contain the escaped message but got %q", logLines[0])
+	}
+}
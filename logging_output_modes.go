@@ -15,6 +15,9 @@ const (
 	ModeBoth                                // ModeBoth indicates information will be outted to both file and screen
 )
 
+// modeSinksOnly is the mode of loggers set up without a logging mode, which only write to the sinks of their configuration
+const modeSinksOnly LoggingOutputMode = -1
+
 func (mode LoggingOutputMode) IsValidMode() bool {
 	return (mode == ModeFile   ||
 	        mode == ModeScreen ||
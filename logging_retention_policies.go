@@ -0,0 +1,64 @@
+/*
+	Policies limiting how many rotated and compressed log archives are kept
+*/
+package golog
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy limits the log archives kept next to the log file. Archives are the files created by rotation and by
+// 'FileActionCompress'. Limits left unset are not enforced, and the oldest archives are always deleted first
+type RetentionPolicy struct {
+	MaxArchives   int           // The number of archives kept
+	MaxAge        time.Duration // Archives last modified longer ago than this are deleted
+	MaxTotalBytes int64         // The size the log file and its archives may take up together
+}
+
+// logArchive is a log archive found on disk
+type logArchive struct {
+	path    string    // The full path of the archive
+	size    int64     // The size of the archive in bytes
+	modTime time.Time // The time the archive was last modified
+}
+
+// validate returns an error if the policy holds a negative limit
+func (policy RetentionPolicy) validate() error {
+	if policy.MaxArchives < 0 || policy.MaxAge < 0 || policy.MaxTotalBytes < 0 {
+		return errors.New("Invalid retention policy provided. Limits may not be negative")
+	}
+
+	return nil
+}
+
+// expiredArchives returns the archives of 'archives' the policy deletes at 'now', oldest first. 'logFileSize' is the
+// size of the log file, which counts against 'MaxTotalBytes' but is never deleted
+func (policy RetentionPolicy) expiredArchives(archives []logArchive, logFileSize int64, now time.Time) []logArchive {
+	newestFirst := append([]logArchive(nil), archives...)
+	sort.SliceStable(newestFirst, func(i, j int) bool {
+		return newestFirst[i].modTime.After(newestFirst[j].modTime)
+	})
+
+	var totalBytes = logFileSize
+	var expiredFrom = len(newestFirst)
+	for index, archive := range newestFirst {
+		totalBytes += archive.size
+
+		if (policy.MaxArchives > 0 && index >= policy.MaxArchives) ||
+			(policy.MaxAge > 0 && now.Sub(archive.modTime) > policy.MaxAge) ||
+			(policy.MaxTotalBytes > 0 && totalBytes > policy.MaxTotalBytes) {
+			// every archive older than this one goes as well
+			expiredFrom = index
+			break
+		}
+	}
+
+	var expired []logArchive
+	for index := len(newestFirst) - 1; index >= expiredFrom; index-- {
+		expired = append(expired, newestFirst[index])
+	}
+
+	return expired
+}
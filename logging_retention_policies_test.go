@@ -0,0 +1,63 @@
+package golog
+
+import (
+	"testing"
+	"time"
+)
+
+func makeLogArchives(now time.Time, count int) []logArchive {
+	var archives []logArchive
+	for index := 0; index < count; index++ {
+		// archive 0 is the newest, and each archive is an hour older and 100 bytes in size
+		archives = append(archives, logArchive{"/logs/app.log." + string(rune('a'+index)), 100, now.Add(-time.Duration(index+1) * time.Hour)})
+	}
+
+	return archives
+}
+
+func TestValidateRejectsNegativeRetentionLimits(t *testing.T) {
+	badPolicies := []RetentionPolicy{{MaxArchives: -1}, {MaxAge: -time.Hour}, {MaxTotalBytes: -1}}
+	for _, badPolicy := range badPolicies {
+		if badPolicy.validate() == nil {
+			t.Errorf("Expected retention policy '%v' to be rejected but it was accepted", badPolicy)
+		}
+	}
+
+	if (RetentionPolicy{}).validate() != nil {
+		t.Errorf("Expected an empty retention policy to be valid")
+	}
+}
+
+func TestExpiredArchivesEnforcesEachLimitOldestFirst(t *testing.T) {
+	type retentionExpectation struct {
+		policy      RetentionPolicy
+		wantExpired []string
+	}
+
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	archives := makeLogArchives(now, 4)
+
+	expectations := []retentionExpectation{
+		{RetentionPolicy{}, nil},
+		{RetentionPolicy{MaxArchives: 2}, []string{"/logs/app.log.d", "/logs/app.log.c"}},
+		{RetentionPolicy{MaxAge: 150 * time.Minute}, []string{"/logs/app.log.d", "/logs/app.log.c"}},
+		// the log file's 50 bytes count against the quota
+		{RetentionPolicy{MaxTotalBytes: 300}, []string{"/logs/app.log.d", "/logs/app.log.c"}},
+		{RetentionPolicy{MaxArchives: 3, MaxAge: 90 * time.Minute}, []string{"/logs/app.log.d", "/logs/app.log.c", "/logs/app.log.b"}},
+	}
+
+	for _, expectation := range expectations {
+		expired := expectation.policy.expiredArchives(archives, 50, now)
+		if len(expired) != len(expectation.wantExpired) {
+			t.Errorf("Expected policy '%v' to expire %v but got %v", expectation.policy, expectation.wantExpired, expired)
+			continue
+		}
+
+		for index, archive := range expired {
+			if archive.path != expectation.wantExpired[index] {
+				t.Errorf("Expected policy '%v' to expire %v but got %v", expectation.policy, expectation.wantExpired, expired)
+				break
+			}
+		}
+	}
+}
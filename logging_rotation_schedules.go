@@ -0,0 +1,101 @@
+/*
+	Schedules for rotating log files at wall-clock boundaries
+*/
+package golog
+
+import (
+	"errors"
+	"time"
+)
+
+type LoggingRotationInterval int
+
+const (
+	RotateHourly LoggingRotationInterval = iota + 1 // Rotates the log file at the start of every hour
+	RotateDaily                                     // Rotates the log file every day at 'AtTime'
+	RotateWeekly                                    // Rotates the log file every week on 'Weekday' at 'AtTime'
+	RotateEvery                                     // Rotates the log file every 'Every', counted from the Unix epoch
+)
+
+// RotationSchedule describes when the log file is rotated, regardless of its size
+type RotationSchedule struct {
+	Interval        LoggingRotationInterval // How often the log file is rotated
+	AtTime          string                  // The local time of day, as 'HH:MM', daily and weekly rotations happen at. If unset, midnight is used
+	Weekday         time.Weekday            // The day of the week weekly rotations happen on. If unset, Sunday is used
+	Every           time.Duration           // The time between rotations when 'Interval' is 'RotateEvery'
+	FilenamePattern string                  // The name rotated files are given, as a 'time.Format' layout applied to the start of the period the file covers ( e.g.: 'app-2006-01-02.log' ). If unset, the rotation time is appended to the log file's name
+}
+
+func (interval LoggingRotationInterval) IsValidRotationInterval() bool {
+	return (interval == RotateHourly ||
+		interval == RotateDaily ||
+		interval == RotateWeekly ||
+		interval == RotateEvery)
+}
+
+// validate returns an error if the schedule can't be followed
+func (schedule RotationSchedule) validate() error {
+	if !schedule.Interval.IsValidRotationInterval() {
+		return errors.New("Invalid rotation interval provided. See intervals in 'logging_rotation_schedules.go'")
+	}
+
+	if schedule.AtTime != "" {
+		if _, err := time.Parse("15:04", schedule.AtTime); err != nil {
+			return errors.New("Invalid rotation time '" + schedule.AtTime + "' provided. Use the 'HH:MM' format")
+		}
+	}
+
+	if schedule.Weekday < time.Sunday || schedule.Weekday > time.Saturday {
+		return errors.New("Invalid rotation weekday provided. Use 0 ( Sunday ) through 6 ( Saturday )")
+	}
+
+	if schedule.Interval == RotateEvery && schedule.Every <= 0 {
+		return errors.New("A positive 'Every' duration is required when rotating with 'RotateEvery'")
+	}
+
+	return nil
+}
+
+// periodStart returns the start of the rotation period 't' falls in
+func (schedule RotationSchedule) periodStart(t time.Time) time.Time {
+	switch schedule.Interval {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case RotateEvery:
+		return t.Truncate(schedule.Every)
+	}
+
+	// validated, so the time of day parses
+	var hour, minute = 0, 0
+	if schedule.AtTime != "" {
+		atTime, _ := time.Parse("15:04", schedule.AtTime)
+		hour, minute = atTime.Hour(), atTime.Minute()
+	}
+
+	start := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, t.Location())
+	if start.After(t) {
+		start = start.AddDate(0, 0, -1)
+	}
+
+	if schedule.Interval == RotateWeekly {
+		for start.Weekday() != schedule.Weekday {
+			start = start.AddDate(0, 0, -1)
+		}
+	}
+
+	return start
+}
+
+// nextPeriodStart returns the start of the rotation period following the one starting at 'periodStart'
+func (schedule RotationSchedule) nextPeriodStart(periodStart time.Time) time.Time {
+	switch schedule.Interval {
+	case RotateHourly:
+		return periodStart.Add(time.Hour)
+	case RotateDaily:
+		return schedule.periodStart(periodStart.AddDate(0, 0, 1))
+	case RotateWeekly:
+		return schedule.periodStart(periodStart.AddDate(0, 0, 7))
+	}
+
+	return periodStart.Add(schedule.Every)
+}
@@ -0,0 +1,85 @@
+package golog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsValidRotationIntervalAcceptsAllValidIntervals(t *testing.T) {
+	if !RotateHourly.IsValidRotationInterval() {
+		t.Errorf("Expected 'RotateHourly' to be a valid rotation interval but was not.")
+	}
+
+	if !RotateDaily.IsValidRotationInterval() {
+		t.Errorf("Expected 'RotateDaily' to be a valid rotation interval but was not.")
+	}
+
+	if !RotateWeekly.IsValidRotationInterval() {
+		t.Errorf("Expected 'RotateWeekly' to be a valid rotation interval but was not.")
+	}
+
+	if !RotateEvery.IsValidRotationInterval() {
+		t.Errorf("Expected 'RotateEvery' to be a valid rotation interval but was not.")
+	}
+}
+
+func TestIsValidRotationIntervalRejectsIntervalsThatAreInvalid(t *testing.T) {
+	// NOTE: Any interval outside range of 1 -> 4 is invalid, and we tested validity above.
+	var badInterval LoggingRotationInterval
+
+	badInterval = 0
+	if badInterval.IsValidRotationInterval() {
+		t.Errorf("Expected invalid rotation interval '%d' to be invalid but it was valid.", badInterval)
+	}
+
+	badInterval = 5
+	if badInterval.IsValidRotationInterval() {
+		t.Errorf("Expected invalid rotation interval '%d' to be invalid but it was valid.", badInterval)
+	}
+}
+
+func TestRotationScheduleValidateRejectsSchedulesThatCantBeFollowed(t *testing.T) {
+	badSchedules := []RotationSchedule{
+		{Interval: RotateDaily, AtTime: "25:00"},
+		{Interval: RotateDaily, AtTime: "noon"},
+		{Interval: RotateWeekly, Weekday: 7},
+		{Interval: RotateEvery},
+	}
+
+	for _, badSchedule := range badSchedules {
+		if badSchedule.validate() == nil {
+			t.Errorf("Expected schedule '%v' to be rejected but it was accepted", badSchedule)
+		}
+	}
+}
+
+func TestRotationSchedulePeriodsStartAtWallClockBoundaries(t *testing.T) {
+	type periodExpectation struct {
+		schedule      RotationSchedule
+		wantStart     time.Time
+		wantNextStart time.Time
+	}
+
+	// a Wednesday
+	logTime := time.Date(2020, time.January, 15, 10, 30, 45, 0, time.UTC)
+
+	expectations := []periodExpectation{
+		{RotationSchedule{Interval: RotateHourly}, time.Date(2020, time.January, 15, 10, 0, 0, 0, time.UTC), time.Date(2020, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{RotationSchedule{Interval: RotateDaily}, time.Date(2020, time.January, 15, 0, 0, 0, 0, time.UTC), time.Date(2020, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{RotationSchedule{Interval: RotateDaily, AtTime: "12:00"}, time.Date(2020, time.January, 14, 12, 0, 0, 0, time.UTC), time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)},
+		{RotationSchedule{Interval: RotateWeekly, Weekday: time.Monday, AtTime: "06:00"}, time.Date(2020, time.January, 13, 6, 0, 0, 0, time.UTC), time.Date(2020, time.January, 20, 6, 0, 0, 0, time.UTC)},
+		{RotationSchedule{Interval: RotateEvery, Every: 15 * time.Minute}, time.Date(2020, time.January, 15, 10, 30, 0, 0, time.UTC), time.Date(2020, time.January, 15, 10, 45, 0, 0, time.UTC)},
+	}
+
+	for _, expectation := range expectations {
+		start := expectation.schedule.periodStart(logTime)
+		if !start.Equal(expectation.wantStart) {
+			t.Errorf("Expected schedule '%v' to start its period at '%s' but got '%s'", expectation.schedule, expectation.wantStart, start)
+		}
+
+		nextStart := expectation.schedule.nextPeriodStart(start)
+		if !nextStart.Equal(expectation.wantNextStart) {
+			t.Errorf("Expected schedule '%v' to start its next period at '%s' but got '%s'", expectation.schedule, expectation.wantNextStart, nextStart)
+		}
+	}
+}
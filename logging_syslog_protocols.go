@@ -0,0 +1,46 @@
+/*
+	Syslog message formats and facilities
+*/
+package golog
+
+import (
+	"errors"
+)
+
+type LoggingSyslogProtocol int
+
+const (
+	SyslogRFC5424 LoggingSyslogProtocol = iota + 1 // The current syslog format, with structured data
+	SyslogRFC3164                                  // The legacy BSD syslog format, still expected by some daemons
+)
+
+func (protocol LoggingSyslogProtocol) IsValidSyslogProtocol() bool {
+	return (protocol == SyslogRFC5424 ||
+		protocol == SyslogRFC3164)
+}
+
+// syslogFacilities maps the names of the syslog facilities to their codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogFacilityCode returns the code of the facility named 'facility', or 'user' if it is empty
+func syslogFacilityCode(facility string) (int, error) {
+	if facility == "" {
+		return syslogFacilities["user"], nil
+	}
+
+	code, ok := syslogFacilities[facility]
+	if !ok {
+		return 0, errors.New("Invalid syslog facility '" + facility + "' provided. Use a name such as 'user', 'daemon' or 'local0'")
+	}
+
+	return code, nil
+}
+
+// syslogPriority returns the PRI value of a message at 'level' from 'facilityCode'
+func syslogPriority(facilityCode int, level LoggingLevel) int {
+	return facilityCode*8 + level.syslogSeverity()
+}
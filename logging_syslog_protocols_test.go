@@ -0,0 +1,53 @@
+package golog
+
+import "testing"
+
+func TestIsValidSyslogProtocolAcceptsAllValidProtocols(t *testing.T) {
+	if !SyslogRFC5424.IsValidSyslogProtocol() {
+		t.Errorf("Expected 'SyslogRFC5424' to be a valid syslog protocol but was not.")
+	}
+
+	if !SyslogRFC3164.IsValidSyslogProtocol() {
+		t.Errorf("Expected 'SyslogRFC3164' to be a valid syslog protocol but was not.")
+	}
+}
+
+func TestIsValidSyslogProtocolRejectsProtocolsThatAreInvalid(t *testing.T) {
+	// NOTE: Any protocol outside range of 1 -> 2 is invalid, and we tested validity above.
+	var badProtocol LoggingSyslogProtocol
+
+	badProtocol = 0
+	if badProtocol.IsValidSyslogProtocol() {
+		t.Errorf("Expected invalid syslog protocol '%d' to be invalid but it was valid.", badProtocol)
+	}
+
+	badProtocol = 3
+	if badProtocol.IsValidSyslogProtocol() {
+		t.Errorf("Expected invalid syslog protocol '%d' to be invalid but it was valid.", badProtocol)
+	}
+}
+
+func TestSyslogFacilityCodeDefaultsToUserAndRejectsUnknownNames(t *testing.T) {
+	code, err := syslogFacilityCode("")
+	if err != nil || code != 1 {
+		t.Errorf("Expected an unset facility to be 'user' ( 1 ) but got '%d' and error '%v'", code, err)
+	}
+
+	code, err = syslogFacilityCode("local7")
+	if err != nil || code != 23 {
+		t.Errorf("Expected facility 'local7' to be 23 but got '%d' and error '%v'", code, err)
+	}
+
+	if _, err = syslogFacilityCode("nonsense"); err == nil {
+		t.Errorf("Expected facility 'nonsense' to be rejected but it was accepted")
+	}
+}
+
+func TestSyslogPriorityCombinesFacilityAndSeverity(t *testing.T) {
+	var expectedPriorities = map[LoggingLevel]int{LevelPanic: 129, LevelFatal: 130, LevelErr: 131, LevelWarn: 132, LevelInfo: 134, LevelDebug: 135}
+	for level, expectedPriority := range expectedPriorities {
+		if priority := syslogPriority(16, level); priority != expectedPriority {
+			t.Errorf("Expected level '%s' from facility 'local0' to have priority %d but got %d", level, expectedPriority, priority)
+		}
+	}
+}